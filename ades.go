@@ -0,0 +1,520 @@
+// Public domain.
+
+package mpcformat
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/soniakeys/coord"
+	"github.com/soniakeys/observation"
+	"github.com/soniakeys/unit"
+)
+
+// ParseADESPSV parses observations in the PSV (pipe separated values)
+// encoding of the ADES (Astrometry Data Exchange Standard) format, sending
+// each observation on the first returned channel.
+//
+// Lines starting with '#' start a header block or data section and lines
+// starting with '!' are header keywords.  These are skipped.  The first
+// other line following a '#' line holds the field names for the following
+// data rows.  Rows of a "# radar" section, or with delay or doppler fields,
+// are skipped as radar observations are not represented by
+// observation.VObs.
+//
+// Optical data rows are mapped to observation types as with ParseObs80.
+// The designation is taken from field permID, provID, or trkSub, the first
+// that is not blank.  Fields stn, obsTime, ra, and dec are required.  RA
+// and Dec are decimal degrees.  Field mag, if present, is normalized to V
+// from field band with DefaultBandCorrections.  Fields rmsRA, rmsDec, and
+// rmsMag are validated as numbers if present but are not otherwise
+// represented.  Roving observer locations are taken from fields rovLon,
+// rovLat, and rovAlt; satellite offsets from fields pos1, pos2, and pos3 in
+// the units of field sys, either ICRF_KM (the default) or ICRF_AU.
+//
+// Parse errors are sent on the error channel and parsing continues with the
+// next line.  Both channels are closed when r is exhausted or on a read
+// error, which is sent on the error channel.
+//
+// The caller must receive from both channels until both are closed.
+func ParseADESPSV(r io.Reader, ocm observation.ParallaxMap) (<-chan ParsedObs80, <-chan error) {
+	oc := make(chan ParsedObs80)
+	ec := make(chan error)
+	go func() {
+		defer close(ec)
+		defer close(oc)
+		s := bufio.NewScanner(r)
+		var cols []string // field names, nil until read
+		radar := false
+		n := 0
+		for s.Scan() {
+			n++
+			line := s.Text()
+			t := strings.TrimSpace(line)
+			switch {
+			case t == "":
+				continue
+			case t[0] == '#':
+				cols = nil
+				radar = strings.TrimSpace(t[1:]) == "radar"
+				continue
+			case t[0] == '!':
+				continue
+			}
+			f := splitPSV(line)
+			if cols == nil {
+				cols = f
+				for _, c := range cols {
+					if c == "delay" || c == "doppler" {
+						radar = true
+					}
+				}
+				continue
+			}
+			if radar {
+				continue
+			}
+			if len(f) != len(cols) {
+				ec <- &obs80LineError{n, fmt.Errorf(
+					"ParseADESPSV: %d fields, header has %d", len(f), len(cols))}
+				continue
+			}
+			row := make(map[string]string, len(cols))
+			for i, c := range cols {
+				row[c] = f[i]
+			}
+			desig, o, err := parseADESOptical(row, ocm)
+			if err != nil {
+				ec <- &obs80LineError{n, fmt.Errorf("ParseADESPSV: %v", err)}
+				continue
+			}
+			oc <- ParsedObs80{desig, o}
+		}
+		if err := s.Err(); err != nil {
+			ec <- err
+		}
+	}()
+	return oc, ec
+}
+
+// adesFieldError is an error in a single ADES field.
+type adesFieldError struct {
+	field  string
+	value  string
+	reason string // Missing, Invalid, Unknown, or Unsupported
+}
+
+func (e *adesFieldError) Error() string {
+	if e.value == "" {
+		return e.reason + " " + e.field
+	}
+	return fmt.Sprintf("%s %s (%s)", e.reason, e.field, e.value)
+}
+
+// splitPSV splits a PSV line into trimmed fields.
+func splitPSV(line string) []string {
+	f := strings.Split(line, "|")
+	for i := range f {
+		f[i] = strings.TrimSpace(f[i])
+	}
+	return f
+}
+
+// parseADESOptical parses the fields of an ADES optical observation.
+func parseADESOptical(row map[string]string, ocm observation.ParallaxMap) (desig string, o observation.VObs, err error) {
+	for _, k := range []string{"permID", "provID", "trkSub"} {
+		if desig = row[k]; desig != "" {
+			break
+		}
+	}
+	if desig == "" {
+		return "", nil, &adesFieldError{"permID", "", "Missing"}
+	}
+	mjd, err := parseADESTime(row["obsTime"])
+	if err != nil {
+		return "", nil, err
+	}
+	ra, err := adesFloat(row, "ra", true)
+	if err != nil {
+		return "", nil, err
+	}
+	dec, err := adesFloat(row, "dec", true)
+	if err != nil {
+		return "", nil, err
+	}
+	for _, k := range []string{"rmsRA", "rmsDec", "rmsMag"} {
+		if _, err = adesFloat(row, k, false); err != nil {
+			return "", nil, err
+		}
+	}
+	mag, err := adesFloat(row, "mag", false)
+	if err != nil {
+		return "", nil, err
+	}
+	if math.IsNaN(mag) {
+		mag = 0
+	} else {
+		mag += adesBandCorrection(row["band"])
+	}
+	stn := row["stn"]
+	switch par, ok := ocm[stn]; {
+	case stn == RovingObscode:
+		r := &RovingObs{}
+		if r.Lon, err = adesFloat(row, "rovLon", true); err != nil {
+			return "", nil, err
+		}
+		if r.Lat, err = adesFloat(row, "rovLat", true); err != nil {
+			return "", nil, err
+		}
+		if r.Alt, err = adesFloat(row, "rovAlt", false); err != nil {
+			return "", nil, err
+		}
+		if math.IsNaN(r.Alt) {
+			r.Alt = 0
+		}
+		o = r
+	case stn == "":
+		return "", nil, &adesFieldError{"stn", "", "Missing"}
+	case !ok:
+		return "", nil, &adesFieldError{"stn", stn, "Unknown"}
+	case par == nil:
+		s := &observation.SatObs{Sat: stn}
+		if s.Offset, err = adesOffset(row); err != nil {
+			return "", nil, err
+		}
+		o = s
+	default:
+		o = &observation.SiteObs{Par: par}
+	}
+	m := o.Meas()
+	m.MJD = mjd
+	m.RA = unit.RAFromDeg(ra)
+	m.Dec = unit.AngleFromDeg(dec)
+	m.VMag = mag
+	m.Qual = stn
+	return desig, o, nil
+}
+
+// adesFloat parses field k of row.  A blank or missing field is an error
+// if required, otherwise it is returned as NaN.
+func adesFloat(row map[string]string, k string, required bool) (float64, error) {
+	f := row[k]
+	if f == "" {
+		if required {
+			return 0, &adesFieldError{k, "", "Missing"}
+		}
+		return math.NaN(), nil
+	}
+	v, err := strconv.ParseFloat(f, 64)
+	if err != nil {
+		return 0, &adesFieldError{k, f, "Invalid"}
+	}
+	return v, nil
+}
+
+// adesOffset parses the geocentric position of a satellite observatory,
+// returned in AU.
+func adesOffset(row map[string]string) (c coord.Cart, err error) {
+	var sf float64
+	switch sys := row["sys"]; sys {
+	case "", "ICRF_KM":
+		sf = 1 / 149.59787e6
+	case "ICRF_AU":
+		sf = 1
+	default:
+		return c, &adesFieldError{"sys", sys, "Unsupported"}
+	}
+	var p [3]float64
+	for i, k := range []string{"pos1", "pos2", "pos3"} {
+		if p[i], err = adesFloat(row, k, true); err != nil {
+			return
+		}
+	}
+	return coord.Cart{X: p[0] * sf, Y: p[1] * sf, Z: p[2] * sf}, nil
+}
+
+// adesBandCorrection returns the correction to V for an ADES band, using
+// the first character of the band with DefaultBandCorrections.
+func adesBandCorrection(band string) float64 {
+	if band != "" {
+		if c, ok := DefaultBandCorrections[band[0]]; ok {
+			return c
+		}
+	}
+	return DefaultBandCorrections[0]
+}
+
+// parseADESTime parses an ADES obsTime, an ISO 8601 UTC time such as
+// 2016-01-07T12:34:56.12Z, returning an MJD.
+func parseADESTime(s string) (float64, error) {
+	if s == "" {
+		return 0, &adesFieldError{"obsTime", "", "Missing"}
+	}
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return 0, &adesFieldError{"obsTime", s, "Invalid"}
+	}
+	return TimeToMJD(t), nil
+}
+
+// ADESBlockType identifies a type of data block of the ADES format.
+type ADESBlockType int
+
+// ADES block types
+const (
+	BlockOptical ADESBlockType = iota
+	BlockSatellite
+	BlockRadar
+)
+
+var adesBlockNames = [...]string{"optical", "satellite", "radar"}
+
+// String returns the ADES name of the block type.
+func (b ADESBlockType) String() string {
+	if b < 0 || int(b) >= len(adesBlockNames) {
+		return fmt.Sprintf("ADESBlockType(%d)", int(b))
+	}
+	return adesBlockNames[b]
+}
+
+// WriteADESPSV writes observations to w in the ADES PSV format.
+//
+// A header with observatory code obsCode is written, then a block header
+// line for block, the field names, and a row for each observation.  Field
+// stn is taken from o.Meas().Qual, or is obsCode if that is blank.  RA and
+// Dec are written in decimal degrees with decimal places matching the
+// precision of the measurement.  The precision is that of the fewest
+// decimal places of seconds of time or arc, up to 3, that represent the
+// value, as for an observation parsed from the 80 column format.  Other
+// values are written with 6 decimal places, about .004 arc seconds.
+// The obsTime is written to the millisecond.  A nonzero VMag is written with
+// band V.  Designations are not available from observation.VObs and
+// designation fields are not written.
+//
+// For BlockSatellite, observations must be *observation.SatObs and
+// offsets are written in km with sys ICRF_KM.  BlockRadar is not supported
+// as radar observations are not represented by observation.VObs.
+func WriteADESPSV(w io.Writer, obsv []observation.VObs, obsCode string, block ADESBlockType) error {
+	switch block {
+	case BlockOptical, BlockSatellite:
+	case BlockRadar:
+		return errors.New("WriteADESPSV: Radar block not supported")
+	default:
+		return fmt.Errorf("WriteADESPSV: Invalid block type (%d)", int(block))
+	}
+	cols := "stn|obsTime|ra|dec|mag|band"
+	if block == BlockSatellite {
+		cols += "|sys|pos1|pos2|pos3"
+	}
+	b := bufio.NewWriter(w)
+	writeADESHeader(b, obsCode, block, cols)
+	for i, o := range obsv {
+		m := o.Meas()
+		stn := m.Qual
+		if stn == "" {
+			stn = obsCode
+		}
+		writeADESPosition(b, stn, m, valueDigits(m.RA.Deg(), 15),
+			valueDigits(m.Dec.Deg(), 1))
+		if m.VMag != 0 {
+			fmt.Fprintf(b, "%.2f|V", m.VMag)
+		} else {
+			b.WriteString("|")
+		}
+		if block == BlockSatellite {
+			s, ok := o.(*observation.SatObs)
+			if !ok {
+				return fmt.Errorf("WriteADESPSV: Observation %d type %T "+
+					"in satellite block", i, o)
+			}
+			const km = 149.59787e6 // km per AU
+			fmt.Fprintf(b, "|ICRF_KM|%.4f|%.4f|%.4f",
+				s.Offset.X*km, s.Offset.Y*km, s.Offset.Z*km)
+		}
+		b.WriteString("\n")
+	}
+	return b.Flush()
+}
+
+// writeADESHeader writes the PSV version line and a block header.
+func writeADESHeader(b *bufio.Writer, obsCode string, block ADESBlockType, cols string) {
+	b.WriteString("# version=2017\n")
+	writeADESBlock(b, obsCode, block, cols)
+}
+
+// writeADESBlock writes the PSV block header for observatory obsCode and
+// the field names cols.
+func writeADESBlock(b *bufio.Writer, obsCode string, block ADESBlockType, cols string) {
+	fmt.Fprintf(b, "# observatory\n! mpcCode %s\n# %s\n%s\n",
+		obsCode, block, cols)
+}
+
+// writeADESPosition writes PSV fields stn, obsTime, ra, and dec of m,
+// each followed by a separator.  RA and Dec are written with raDigits and
+// decDigits decimal places.
+func writeADESPosition(b *bufio.Writer, stn string, m *observation.VMeas,
+	raDigits, decDigits int) {
+	fmt.Fprintf(b, "%s|%s|%.*f|%+.*f|", stn,
+		MJDToTime(m.MJD).Round(time.Millisecond).
+			Format("2006-01-02T15:04:05.000Z"),
+		raDigits, m.RA.Deg(), decDigits, m.Dec.Deg())
+}
+
+// obs80Digits returns the decimal places of degrees that represent the
+// precision of sexagesimal field f of an 80 column observation.  The
+// first component of f is in units of deg degrees.
+func obs80Digits(f string, deg float64) int {
+	parts := strings.Fields(f)
+	if len(parts) == 0 {
+		return 0
+	}
+	lc := deg
+	for range parts[1:] {
+		lc /= 60
+	}
+	last := parts[len(parts)-1]
+	if i := strings.IndexByte(last, '.'); i >= 0 {
+		lc *= math.Pow(10, -float64(len(last)-i-1))
+	}
+	return lcDigits(lc)
+}
+
+// valueDigits returns the decimal places of degrees that represent the
+// precision of angle v in degrees, taken as the fewest decimal places of
+// seconds, up to 3, that represent v.  Seconds are of a leading unit of
+// deg degrees.  If no such precision is found, 6 is returned.
+func valueDigits(v, deg float64) int {
+	s := math.Abs(v) / deg * 3600
+	for p, lc := 1., deg/3600; p <= 1000; p, lc = p*10, lc/10 {
+		if math.Abs(s*p-math.Floor(s*p+.5)) < 1e-4 {
+			return lcDigits(lc)
+		}
+	}
+	return 6
+}
+
+// lcDigits returns the decimal places that represent least count lc.
+func lcDigits(lc float64) int {
+	if d := int(math.Ceil(-math.Log10(lc) - 1e-9)); d > 0 {
+		return d
+	}
+	return 0
+}
+
+// ADESSkipErrors is the error returned by Obs80ToADESPSV for lines that
+// were not converted.
+type ADESSkipErrors []error
+
+func (e ADESSkipErrors) Error() string {
+	if len(e) == 1 {
+		return e[0].Error()
+	}
+	return fmt.Sprintf("%v (and %d more errors)", e[0], len(e)-1)
+}
+
+// Obs80ToADESPSV converts observations in the MPC 80 column format read
+// from r to the ADES PSV format, written to w.
+//
+// Lines are parsed with ParseObs80Full against ocm.  An optical block is
+// started for each run of observations from the same observatory.
+//
+// The designation is written to permID, provID, or trkSub.  A packed
+// number in columns 1-5 is unpacked to permID.  A packed provisional or
+// survey designation in columns 6-12, or a packed comet designation in
+// columns 5-12, is unpacked to provID.  Any other designation in columns
+// 6-12, such as a temporary designation of the NEO Confirmation Page, is
+// written to trkSub.
+//
+// Field mag is the magnitude as reported, and band is the band character
+// of the 80 column format when it is a standard ADES band.  Fields stn
+// and obsTime are written as by WriteADESPSV.  Fields ra and dec are
+// decimal degrees with the decimal places that represent the precision of
+// the 80 column fields.  Seconds of RA to .01 and seconds of Dec to .1,
+// for example, are written to five decimal places.
+//
+// Lines that fail to parse are skipped, as are satellite and roving
+// observer observations, which need the second line of the 80 column
+// format.  Other lines are still converted and written; the skipped lines
+// are then returned as ADESSkipErrors.  Read and write errors are returned
+// immediately.
+func Obs80ToADESPSV(r io.Reader, w io.Writer, ocm observation.ParallaxMap) error {
+	b := bufio.NewWriter(w)
+	b.WriteString("# version=2017\n")
+	s := bufio.NewScanner(r)
+	n := 0
+	stn := ""
+	started := false
+	var skipped ADESSkipErrors
+	for s.Scan() {
+		n++
+		line := s.Text()
+		if line == "" {
+			continue
+		}
+		f, err := ParseObs80Full(line, ocm)
+		if err != nil {
+			skipped = append(skipped, &obs80LineError{n, err})
+			continue
+		}
+		if _, ok := f.Obs.(*observation.SiteObs); !ok {
+			skipped = append(skipped, &obs80LineError{n,
+				fmt.Errorf("Obs80ToADESPSV: %T not supported", f.Obs)})
+			continue
+		}
+		m := f.Obs.Meas()
+		if !started || m.Qual != stn {
+			stn, started = m.Qual, true
+			writeADESBlock(b, stn, BlockOptical,
+				"permID|provID|trkSub|stn|obsTime|ra|dec|mag|band")
+		}
+		permID, provID, trkSub := adesDesig(line)
+		b.WriteString(permID + "|" + provID + "|" + trkSub + "|")
+		writeADESPosition(b, m.Qual, m,
+			obs80Digits(line[32:44], 15), obs80Digits(line[44:56], 1))
+		var band string
+		if adesBands[string(f.Band)] {
+			band = string(f.Band)
+		}
+		if f.OrigMag != 0 {
+			fmt.Fprintf(b, "%.2f|%s\n", f.OrigMag, band)
+		} else {
+			b.WriteString("|\n")
+		}
+	}
+	if err := s.Err(); err != nil {
+		return err
+	}
+	if err := b.Flush(); err != nil {
+		return err
+	}
+	if len(skipped) > 0 {
+		return skipped
+	}
+	return nil
+}
+
+// adesDesig returns the ADES designation fields for the designation
+// columns of 80 column observation line80.
+func adesDesig(line80 string) (permID, provID, trkSub string) {
+	if num := strings.TrimSpace(line80[:5]); num != "" {
+		permID, _ = PackedDesig(num).Unpack()
+	}
+	if c := line80[4:12]; isPackedComet(c) {
+		provID, _ = PackedDesig(c).Unpack()
+		return
+	}
+	prov := strings.TrimSpace(line80[5:12])
+	switch DesigType(prov) {
+	case DesigProvisional, DesigSurvey:
+		provID, _ = PackedDesig(prov).Unpack()
+	default:
+		trkSub = prov
+	}
+	return
+}
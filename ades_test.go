@@ -0,0 +1,178 @@
+// Public domain.
+
+package mpcformat_test
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/soniakeys/coord"
+	"github.com/soniakeys/mpcformat"
+	"github.com/soniakeys/observation"
+)
+
+const adesPSV = `# version=2017
+# observatory
+! mpcCode 291
+# submitter
+! name J. Doe
+permID |provID     |trkSub  |mode|stn |obsTime                 |ra         |dec        |rmsRA|rmsDec|mag  |band|sys    |pos1      |pos2      |pos3      |rovLon   |rovLat  |rovAlt
+       |2016 AB1   |        |CCD |291 |2016-01-07T12:00:00.00Z | 123.456789| -12.345678|0.123|0.123 |20.1 |G   |       |          |          |          |         |        |
+433    |           |        |CCD |250 |2016-01-07T18:00:00Z    |  10.5     |  +5.25    |     |      |     |    |ICRF_KM|-5634.1   |-2466.2   |-2499.8   |         |        |
+       |           |abc123  |CCD |247 |2016-01-08T00:00:00Z    |  20       |  30       |     |      |18.0 |V   |       |          |          |          |248.904  |32.417  |2525
+       |2016 AB1   |        |CCD |291 |2016-01-07T12:30:00Z    | bad       | -12.345678|     |      |     |    |       |          |          |          |         |        |
+       |2016 AB1   |        |CCD |999 |2016-01-07T12:30:00Z    | 123.45    | -12.345678|     |      |     |    |       |          |          |          |         |        |
+# radar
+permID |stn |obsTime             |delay
+433    |253 |2016-01-09T00:00:00Z|12.5
+`
+
+func TestParseADESPSV(t *testing.T) {
+	if pMapErr != nil {
+		t.Skip(pMapErr)
+	}
+	oc, ec := mpcformat.ParseADESPSV(strings.NewReader(adesPSV), pMap)
+	var got []mpcformat.ParsedObs80
+	var nErr int
+	for oc != nil || ec != nil {
+		select {
+		case p, ok := <-oc:
+			if !ok {
+				oc = nil
+				continue
+			}
+			got = append(got, p)
+		case _, ok := <-ec:
+			if !ok {
+				ec = nil
+				continue
+			}
+			nErr++
+		}
+	}
+	if len(got) != 3 || nErr != 2 {
+		t.Fatalf("got %d observations, %d errors, want 3, 2", len(got), nErr)
+	}
+	// optical
+	s, ok := got[0].Obs.(*observation.SiteObs)
+	if !ok || got[0].Desig != "2016 AB1" || s.Par != pMap["291"] {
+		t.Fatalf("obs 0 = %+v", got[0])
+	}
+	if s.MJD != 57394.5 || s.Qual != "291" ||
+		math.Abs(s.RA.Deg()-123.456789) > 1e-9 ||
+		math.Abs(s.Dec.Deg()+12.345678) > 1e-9 {
+		t.Fatalf("obs 0 meas = %+v", s.VMeas)
+	}
+	if math.Abs(s.VMag-20.5) > 1e-9 { // G takes the default correction
+		t.Fatalf("obs 0 VMag = %g", s.VMag)
+	}
+	// satellite
+	sat, ok := got[1].Obs.(*observation.SatObs)
+	if !ok || got[1].Desig != "433" || sat.Sat != "250" ||
+		math.Abs(sat.Offset.X+5634.1/149.59787e6) > 1e-15 {
+		t.Fatalf("obs 1 = %+v", got[1].Obs)
+	}
+	// roving
+	r, ok := got[2].Obs.(*mpcformat.RovingObs)
+	if !ok || got[2].Desig != "abc123" || r.Lon != 248.904 ||
+		r.Lat != 32.417 || r.Alt != 2525 || r.VMag != 18 {
+		t.Fatalf("obs 2 = %+v", got[2].Obs)
+	}
+}
+
+func TestWriteADESPSV(t *testing.T) {
+	if pMapErr != nil {
+		t.Skip(pMapErr)
+	}
+	_, o1, err := mpcformat.ParseObs80(strings.TrimSuffix(o1, "\n"),
+		mpcformat.ParallaxMapResolver(pMap))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b strings.Builder
+	err = mpcformat.WriteADESPSV(&b, []observation.VObs{o1}, "291",
+		mpcformat.BlockOptical)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `# version=2017
+# observatory
+! mpcCode 291
+# optical
+stn|obsTime|ra|dec|mag|band
+291|2004-09-16T03:38:57.984Z|243.29821|+20.87325|21.10|V
+`
+	if b.String() != want {
+		t.Fatalf("got\n%s\nwant\n%s", b.String(), want)
+	}
+	// values not of the 80 column format get 6 decimal places
+	m := &observation.SiteObs{VMeas: observation.VMeas{MJD: 57394.5,
+		Equa: coord.Equa{RA: 1, Dec: .5}}}
+	b.Reset()
+	if err = mpcformat.WriteADESPSV(&b, []observation.VObs{m}, "291",
+		mpcformat.BlockOptical); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(b.String(), "|57.295780|+28.647890|") {
+		t.Fatalf("6 decimal places:\n%s", b.String())
+	}
+	if err = mpcformat.WriteADESPSV(&b, []observation.VObs{o1}, "291",
+		mpcformat.BlockSatellite); err == nil {
+		t.Fatal("site observation in satellite block: no error")
+	}
+	if err = mpcformat.WriteADESPSV(&b, nil, "291",
+		mpcformat.BlockRadar); err == nil {
+		t.Fatal("radar block: no error")
+	}
+	// satellite offset in km
+	s := &observation.SatObs{Sat: "250"}
+	s.MJD = 57394.5
+	s.Offset.X = 1e-5
+	b.Reset()
+	if err = mpcformat.WriteADESPSV(&b, []observation.VObs{s}, "250",
+		mpcformat.BlockSatellite); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(b.String(), "|ICRF_KM|1495.9787|0.0000|0.0000\n") {
+		t.Fatalf("satellite block:\n%s", b.String())
+	}
+}
+
+func TestObs80ToADESPSV(t *testing.T) {
+	if pMapErr != nil {
+		t.Skip(pMapErr)
+	}
+	num := "00433       " + o1[12:]
+	prov := "     K08K42F" + o1[12:]
+	// one more decimal place in RA and Dec
+	prec := o1[:32] + "16 13 11.571+20 52 23.72" + o1[56:]
+	var b strings.Builder
+	err := mpcformat.Obs80ToADESPSV(
+		strings.NewReader(o1+bad+num+prov+prec+o2), &b, pMap)
+	var skipped mpcformat.ADESSkipErrors
+	if !errors.As(err, &skipped) || len(skipped) != 1 ||
+		!strings.HasPrefix(skipped[0].Error(), "line 2:") {
+		t.Fatalf("err = %v, want line 2 skipped", err)
+	}
+	want := `# version=2017
+# observatory
+! mpcCode 291
+# optical
+permID|provID|trkSub|stn|obsTime|ra|dec|mag|band
+||NE00030|291|2004-09-16T03:38:57.984Z|243.29821|+20.87325|21.10|V
+433|||291|2004-09-16T03:38:57.984Z|243.29821|+20.87325|21.10|V
+|2008 KF42||291|2004-09-16T03:38:57.984Z|243.29821|+20.87325|21.10|V
+||NE00030|291|2004-09-16T03:38:57.984Z|243.298213|+20.873256|21.10|V
+# observatory
+! mpcCode 704
+# optical
+permID|provID|trkSub|stn|obsTime|ra|dec|mag|band
+||NE00199|704|2007-02-09T05:48:58.176Z|92.02525|+43.22394|20.10|
+||NE00199|704|2007-02-09T06:05:58.560Z|92.02296|+43.21714|20.10|
+`
+	if b.String() != want {
+		t.Fatalf("got\n%s\nwant\n%s", b.String(), want)
+	}
+}
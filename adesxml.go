@@ -0,0 +1,221 @@
+// Public domain.
+
+package mpcformat
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/soniakeys/observation"
+)
+
+// ADESObservation is an optical observation of the ADES XML format.
+//
+// Fields hold element text as found in the XML.  Desig and Obs are set by
+// ParseADESXML from the other fields, as by ParseADESPSV.
+type ADESObservation struct {
+	PermID  string `xml:"permID"`
+	ProvID  string `xml:"provID"`
+	TrkSub  string `xml:"trkSub"`
+	ObsID   string `xml:"obsID"`
+	TrkID   string `xml:"trkID"`
+	Mode    string `xml:"mode"`
+	Stn     string `xml:"stn"`
+	Sys     string `xml:"sys"`
+	Ctr     string `xml:"ctr"`
+	Pos1    string `xml:"pos1"`
+	Pos2    string `xml:"pos2"`
+	Pos3    string `xml:"pos3"`
+	RovLon  string `xml:"rovLon"`
+	RovLat  string `xml:"rovLat"`
+	RovAlt  string `xml:"rovAlt"`
+	ObsTime string `xml:"obsTime"`
+	RA      string `xml:"ra"`
+	Dec     string `xml:"dec"`
+	RmsRA   string `xml:"rmsRA"`
+	RmsDec  string `xml:"rmsDec"`
+	RmsCorr string `xml:"rmsCorr"`
+	AstCat  string `xml:"astCat"`
+	Mag     string `xml:"mag"`
+	RmsMag  string `xml:"rmsMag"`
+	Band    string `xml:"band"`
+	PhotCat string `xml:"photCat"`
+	Notes   string `xml:"notes"`
+	Remarks string `xml:"remarks"`
+
+	Residual *ADESResidual `xml:"opticalResidual"`
+
+	Desig string           `xml:"-"`
+	Obs   observation.VObs `xml:"-"`
+}
+
+// ADESResidual holds the residuals of an ADES optical observation against
+// an orbit.
+type ADESResidual struct {
+	OrbProd string `xml:"orbProd"`
+	OrbID   string `xml:"orbID"`
+	ResRA   string `xml:"resRA"`
+	ResDec  string `xml:"resDec"`
+	SelAst  string `xml:"selAst"`
+	SigRA   string `xml:"sigRA"`
+	SigDec  string `xml:"sigDec"`
+	SigCorr string `xml:"sigCorr"`
+	ResMag  string `xml:"resMag"`
+	SelPhot string `xml:"selPhot"`
+	SigMag  string `xml:"sigMag"`
+}
+
+// ADESValidationError describes a problem with an observation of an ADES
+// XML document.
+type ADESValidationError struct {
+	Index  int    // index of the observation in the document, or -1
+	Field  string // ADES field name, or blank for document errors
+	Value  string // field value
+	Reason string
+}
+
+func (e ADESValidationError) Error() string {
+	switch {
+	case e.Index < 0:
+		return "ADES: " + e.Reason
+	case e.Value == "":
+		return fmt.Sprintf("ADES observation %d: %s %s",
+			e.Index, e.Reason, e.Field)
+	}
+	return fmt.Sprintf("ADES observation %d: %s %s (%s)",
+		e.Index, e.Reason, e.Field, e.Value)
+}
+
+// ADESValidationErrors is the error returned by ParseADESXML for an
+// invalid document.
+type ADESValidationErrors []ADESValidationError
+
+func (e ADESValidationErrors) Error() string {
+	if len(e) == 1 {
+		return e[0].Error()
+	}
+	return fmt.Sprintf("%v (and %d more errors)", e[0], len(e)-1)
+}
+
+// adesBands are the standard ADES photometric bands.
+var adesBands = map[string]bool{
+	"Vj": true, "Rc": true, "Ic": true, "Bj": true, "Uj": true,
+	"Sg": true, "Sr": true, "Si": true, "Sz": true,
+	"Pg": true, "Pr": true, "Pi": true, "Pz": true, "Py": true, "Pw": true,
+	"Ao": true, "Ac": true, "Gb": true, "Gr": true, "G": true,
+	"Lu": true, "Lg": true, "Lr": true, "Li": true, "Lz": true, "Ly": true,
+	"U": true, "B": true, "V": true, "R": true, "I": true,
+	"J": true, "H": true, "K": true, "Y": true, "W": true, "C": true,
+	"u": true, "g": true, "r": true, "i": true, "z": true, "y": true,
+	"w": true, "c": true, "o": true,
+}
+
+// adesModes are the standard ADES observation modes.
+var adesModes = map[string]bool{
+	"CCD": true, "CMO": true, "VID": true, "PHO": true, "ENC": true,
+	"PMT": true, "MIC": true, "MER": true, "TDI": true, "OCC": true,
+	"UNK": true,
+}
+
+// ParseADESXML parses optical observations of an ADES XML document.
+//
+// Observations are read from the optical elements of
+// ades/obsBlock/obsData.  An optical element may contain an
+// opticalResidual element.  Observations are mapped to observation types
+// as with ParseADESPSV.
+//
+// Fields are validated for presence of required fields, numeric values,
+// ranges of RA, Dec, and uncertainties, and the standard values of band
+// and mode.  Valid observations are returned.  If any are invalid, or if
+// the document cannot be read, the error is ADESValidationErrors.
+func ParseADESXML(r io.Reader, ocm observation.ParallaxMap) ([]*ADESObservation, error) {
+	var doc struct {
+		Blocks []struct {
+			Optical []*ADESObservation `xml:"obsData>optical"`
+		} `xml:"obsBlock"`
+	}
+	if err := xml.NewDecoder(r).Decode(&doc); err != nil {
+		reason := "Malformed XML"
+		var se *xml.SyntaxError
+		if errors.As(err, &se) {
+			reason = fmt.Sprintf("Malformed XML at line %d", se.Line)
+		}
+		return nil, ADESValidationErrors{{Index: -1, Reason: reason}}
+	}
+	var valid []*ADESObservation
+	var verr ADESValidationErrors
+	i := 0
+	for _, b := range doc.Blocks {
+		for _, a := range b.Optical {
+			if e := a.validate(i, ocm); len(e) > 0 {
+				verr = append(verr, e...)
+			} else {
+				valid = append(valid, a)
+			}
+			i++
+		}
+	}
+	if len(verr) > 0 {
+		return valid, verr
+	}
+	return valid, nil
+}
+
+// validate checks a, setting Desig and Obs if valid.
+func (a *ADESObservation) validate(i int, ocm observation.ParallaxMap) (verr ADESValidationErrors) {
+	invalid := func(field, value, reason string) {
+		verr = append(verr, ADESValidationError{i, field, value, reason})
+	}
+	row := a.row()
+	if b := row["band"]; b != "" && !adesBands[b] {
+		invalid("band", b, "Nonstandard")
+	}
+	if m := row["mode"]; m != "" && !adesModes[m] {
+		invalid("mode", m, "Nonstandard")
+	}
+	inRange := func(field string, min, max float64) {
+		if v, err := strconv.ParseFloat(row[field], 64); err == nil &&
+			(v < min || v > max) {
+			invalid(field, row[field], "Out of range")
+		}
+	}
+	inRange("ra", 0, 360)
+	inRange("dec", -90, 90)
+	for _, f := range []string{"rmsRA", "rmsDec", "rmsMag"} {
+		inRange(f, math.SmallestNonzeroFloat64, math.Inf(1))
+	}
+	desig, o, err := parseADESOptical(row, ocm)
+	if err != nil {
+		if fe, ok := err.(*adesFieldError); ok {
+			invalid(fe.field, fe.value, fe.reason)
+		} else {
+			invalid("", "", err.Error())
+		}
+	}
+	if len(verr) == 0 {
+		a.Desig, a.Obs = desig, o
+	}
+	return
+}
+
+// row returns the trimmed fields of a keyed by ADES field name.
+func (a *ADESObservation) row() map[string]string {
+	row := map[string]string{
+		"permID": a.PermID, "provID": a.ProvID, "trkSub": a.TrkSub,
+		"mode": a.Mode, "stn": a.Stn, "sys": a.Sys,
+		"pos1": a.Pos1, "pos2": a.Pos2, "pos3": a.Pos3,
+		"rovLon": a.RovLon, "rovLat": a.RovLat, "rovAlt": a.RovAlt,
+		"obsTime": a.ObsTime, "ra": a.RA, "dec": a.Dec,
+		"rmsRA": a.RmsRA, "rmsDec": a.RmsDec,
+		"mag": a.Mag, "rmsMag": a.RmsMag, "band": a.Band,
+	}
+	for k, v := range row {
+		row[k] = strings.TrimSpace(v)
+	}
+	return row
+}
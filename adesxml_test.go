@@ -0,0 +1,98 @@
+// Public domain.
+
+package mpcformat_test
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/soniakeys/mpcformat"
+	"github.com/soniakeys/observation"
+)
+
+const adesXML = `<?xml version="1.0" encoding="UTF-8"?>
+<ades version="2017">
+  <obsBlock>
+    <obsContext>
+      <observatory><mpcCode>291</mpcCode></observatory>
+    </obsContext>
+    <obsData>
+      <optical>
+        <provID>2016 AB1</provID>
+        <mode>CCD</mode>
+        <stn>291</stn>
+        <obsTime>2016-01-07T12:00:00Z</obsTime>
+        <ra>123.456789</ra>
+        <dec>-12.345678</dec>
+        <rmsRA>0.12</rmsRA>
+        <mag>20.1</mag>
+        <band>V</band>
+        <opticalResidual>
+          <orbProd>JPL</orbProd>
+          <resRA>0.05</resRA>
+          <resDec>-0.02</resDec>
+        </opticalResidual>
+      </optical>
+      <optical>
+        <provID>2016 AB1</provID>
+        <mode>CCD</mode>
+        <stn>291</stn>
+        <obsTime>2016-01-07T12:30:00Z</obsTime>
+        <ra>400</ra>
+        <dec>-12.3</dec>
+        <band>Q</band>
+      </optical>
+      <optical>
+        <mode>CCD</mode>
+        <stn>291</stn>
+        <obsTime>2016-01-07T13:00:00Z</obsTime>
+        <ra>123.5</ra>
+        <dec>-12.3</dec>
+      </optical>
+    </obsData>
+  </obsBlock>
+</ades>
+`
+
+func TestParseADESXML(t *testing.T) {
+	if pMapErr != nil {
+		t.Skip(pMapErr)
+	}
+	obs, err := mpcformat.ParseADESXML(strings.NewReader(adesXML), pMap)
+	verr, ok := err.(mpcformat.ADESValidationErrors)
+	if !ok {
+		t.Fatalf("error type %T, want ADESValidationErrors", err)
+	}
+	want := []mpcformat.ADESValidationError{
+		{1, "band", "Q", "Nonstandard"},
+		{1, "ra", "400", "Out of range"},
+		{2, "permID", "", "Missing"},
+	}
+	if len(verr) != len(want) {
+		t.Fatalf("got errors %v", verr)
+	}
+	for i, e := range want {
+		if verr[i] != e {
+			t.Fatalf("error %d = %#v, want %#v", i, verr[i], e)
+		}
+	}
+	if len(obs) != 1 {
+		t.Fatalf("got %d valid observations, want 1", len(obs))
+	}
+	a := obs[0]
+	s, ok := a.Obs.(*observation.SiteObs)
+	if !ok || a.Desig != "2016 AB1" || s.MJD != 57394.5 ||
+		math.Abs(s.RA.Deg()-123.456789) > 1e-9 {
+		t.Fatalf("observation = %+v", a)
+	}
+	if a.Residual == nil || a.Residual.OrbProd != "JPL" ||
+		a.Residual.ResRA != "0.05" {
+		t.Fatalf("residual = %+v", a.Residual)
+	}
+	_, err = mpcformat.ParseADESXML(strings.NewReader("<ades><obsBlock>"),
+		pMap)
+	if _, ok := err.(mpcformat.ADESValidationErrors); !ok {
+		t.Fatalf("malformed XML error %v type %T", err, err)
+	}
+}
@@ -4,14 +4,53 @@ package mpcformat
 
 import (
 	"bufio"
+	"compress/gzip"
+	"context"
 	"errors"
 	"fmt"
 	"io"
+	"sort"
+	"strings"
 
 	"github.com/soniakeys/observation"
 )
 
-type ArcError struct{ error }
+// ArcError is a non-fatal error returned by ArcSplitter and related
+// functions.  LineNum is the 1-based line number of the input stream where
+// the error occurred, or 0 if unknown.  ColStart is the Go-like starting
+// column of the field that failed to parse, or -1 if unknown or not
+// applicable.
+type ArcError struct {
+	error
+	LineNum  int
+	ColStart int
+}
+
+// newArcError returns an ArcError for err at line, with ColStart from err
+// if available.
+func newArcError(err error, line int) ArcError {
+	e := ArcError{err, line, -1}
+	var pe *ParseError
+	if errors.As(err, &pe) {
+		e.ColStart = pe.Position
+	}
+	return e
+}
+
+// Error returns the error message, prefixed with the line number if known.
+func (e ArcError) Error() string {
+	if e.LineNum == 0 {
+		return e.error.Error()
+	}
+	return fmt.Sprintf("line %d: %v", e.LineNum, e.error)
+}
+
+// ArcSplitterStats reports progress of an arc splitter.
+type ArcSplitterStats struct {
+	Lines  int // lines read
+	Arcs   int // arcs returned
+	Errors int // ArcErrors returned
+}
 
 // ArcSplitter returns a function that splits an observation stream by
 // designation, yielding parsed observation arcs.
@@ -32,7 +71,129 @@ type ArcError struct{ error }
 //
 // - Other errors should be considered fatal and the split function should not
 // be called again.
-func ArcSplitter(rObs io.Reader, pMap observation.ParallaxMap) func() (*observation.Arc, error) {
+//
+// The two lines of a satellite or roving observer observation must be
+// consecutive.  The observation of line 1 is completed with data from line
+// 2 and returned as a single observation.  A line 2 without a preceding
+// line 1 is an ArcError, as is a line 2 that fails to parse; in this case
+// the observation of line 1 is dropped.
+//
+// Options opts modify splitting.  With no options the behavior is as
+// above.  With MaxObs, longer arcs are returned as consecutive arcs of the
+// same designation.  See ArcSplitterOptions for other options.
+func ArcSplitter(rObs io.Reader, pMap observation.ParallaxMap,
+	opts ...ArcSplitterOption) func() (*observation.Arc, error) {
+	var o ArcSplitterOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	f, _ := arcSplitterWithStats(rObs, pMap, o.Filter)
+	return o.wrapSplit(f)
+}
+
+// wrapSplit returns split function f modified by Ctx, OnError,
+// ContinueOnError, and MaxObs.
+func (o *ArcSplitterOptions) wrapSplit(f func() (*observation.Arc, error)) func() (*observation.Arc, error) {
+	var (
+		desig string
+		rest  []observation.VObs // observations yet to return
+	)
+	return func() (*observation.Arc, error) {
+		for len(rest) == 0 {
+			if o.Ctx != nil {
+				select {
+				case <-o.Ctx.Done():
+					return nil, fmt.Errorf("ArcSplitter: %w", o.Ctx.Err())
+				default:
+				}
+			}
+			a, err := f()
+			if ae, ok := err.(ArcError); ok {
+				if o.OnError != nil {
+					o.OnError(ae)
+				}
+				if o.ContinueOnError {
+					continue
+				}
+			}
+			if err != nil || o.MaxObs <= 0 || len(a.Obs) <= o.MaxObs {
+				return a, err
+			}
+			desig = a.Desig
+			rest = a.Obs
+		}
+		n := len(rest)
+		if n > o.MaxObs {
+			n = o.MaxObs
+		}
+		frag := &observation.Arc{Desig: desig, Obs: rest[:n:n]}
+		rest = rest[n:]
+		return frag, nil
+	}
+}
+
+// ArcSplitterWithStats returns a split function as ArcSplitter, and
+// statistics that are updated by each call to the split function.
+//
+// The statistics may be read between calls to the split function, for
+// example to report progress through a large file.
+func ArcSplitterWithStats(rObs io.Reader, pMap observation.ParallaxMap) (func() (*observation.Arc, error), *ArcSplitterStats) {
+	return arcSplitterWithStats(rObs, pMap, nil)
+}
+
+func arcSplitterWithStats(rObs io.Reader, pMap observation.ParallaxMap,
+	filter func(string) bool) (func() (*observation.Arc, error), *ArcSplitterStats) {
+	st := &ArcSplitterStats{}
+	split := arcSplitter(rObs, pMap, st, filter)
+	return func() (*observation.Arc, error) {
+		a, err := split()
+		switch err.(type) {
+		case nil:
+			st.Arcs++
+		case ArcError:
+			st.Errors++
+		}
+		return a, err
+	}, st
+}
+
+// ArcSplitterContext returns a split function as ArcSplitter that stops
+// when ctx is done.
+//
+// Ctx is checked at the start of each call.  If ctx is done, the split
+// function returns a fatal error wrapping ctx.Err(), which can be tested
+// with errors.Is.  An arc being read when ctx becomes done is completed and
+// returned normally.
+//
+// It is equivalent to ArcSplitter with WithContext(ctx).
+func ArcSplitterContext(ctx context.Context, rObs io.Reader, pMap observation.ParallaxMap) func() (*observation.Arc, error) {
+	return ArcSplitter(rObs, pMap, WithContext(ctx))
+}
+
+// ArcSplitterGzip returns a split function as ArcSplitter, decompressing
+// r if it is gzip compressed.
+//
+// Gzip data is recognized by its magic number; other data is read as plain
+// text.  An error is returned if r has the gzip magic number but the gzip
+// header is invalid.  A corrupt gzip stream otherwise results in a fatal
+// error from the split function.
+func ArcSplitterGzip(r io.Reader, pMap observation.ParallaxMap) (func() (*observation.Arc, error), error) {
+	br := bufio.NewReader(r)
+	if m, _ := br.Peek(2); len(m) == 2 && m[0] == 0x1f && m[1] == 0x8b {
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		return ArcSplitter(zr, pMap), nil
+	}
+	return ArcSplitter(br, pMap), nil
+}
+
+// arcSplitter is the split function of ArcSplitter.  Lines of observations
+// with designations not selected by filter, if not nil, are counted but
+// otherwise ignored.
+func arcSplitter(rObs io.Reader, pMap observation.ParallaxMap,
+	st *ArcSplitterStats, filter func(string) bool) func() (*observation.Arc, error) {
 	s := bufio.NewScanner(rObs)
 	var a observation.Arc // arc under construction
 	var (                 // values that may be carried from last call
@@ -54,10 +215,10 @@ func ArcSplitter(rObs io.Reader, pMap observation.ParallaxMap) func() (*observat
 	arc:
 		for {
 			scanOk := s.Scan()
-			if !scanOk {
-				if err = s.Err(); err != nil {
-					return nil, err
-				}
+			if scanOk {
+				st.Lines++
+			} else if err = s.Err(); err != nil {
+				return nil, err
 			}
 			line := s.Text()
 			switch len(line) {
@@ -73,26 +234,50 @@ func ArcSplitter(rObs io.Reader, pMap observation.ParallaxMap) func() (*observat
 				}
 				fallthrough
 			default:
-				err = ArcError{fmt.Errorf("observation line length = %d, want 80",
-					len(line))}
+				err = newArcError(fmt.Errorf(
+					"observation line length = %d, want 80", len(line)), st.Lines)
 				break arc
 			}
-			if line[14] == 's' {
+			if filter != nil && !filter(strings.TrimSpace(line[:12])) {
+				continue
+			}
+			// Line 2 of a two-line observation must immediately follow
+			// line 1.  Line 1 is already in the arc; if line 2 is bad,
+			// line 1 is removed from the arc as well.  A line 2 without a
+			// line 1 is an ArcError.
+			switch line[14] {
+			case 's':
 				s, ok := o.(*observation.SatObs)
 				if !ok {
-					err = ArcError{errors.New(
-						"space-based observation line 2 without line 1")}
+					err = newArcError(errors.New(
+						"space-based observation line 2 without line 1"), st.Lines)
 					break arc
 				}
 				if err = ParseSat2(line, desig, s); err != nil {
-					// TODO maybe back off that last S obs too?
+					err = newArcError(err, st.Lines)
+					a.Obs = a.Obs[:len(a.Obs)-1]
 					break arc
 				}
-				continue // (it's already in the list)
+				o = nil // line 1 is complete, no more line 2 allowed
+				continue
+			case 'v':
+				r, ok := o.(*RovingObs)
+				if !ok {
+					err = newArcError(errors.New(
+						"roving observation line 2 without line 1"), st.Lines)
+					break arc
+				}
+				if err = ParseRoving2(line, desig, r); err != nil {
+					err = newArcError(err, st.Lines)
+					a.Obs = a.Obs[:len(a.Obs)-1]
+					break arc
+				}
+				o = nil
+				continue
 			}
-			switch desig, o, err = ParseObs80(line, pMap); {
+			switch desig, o, err = ParseObs80(line, ParallaxMapResolver(pMap)); {
 			case err != nil:
-				err = ArcError{err}
+				err = newArcError(err, st.Lines)
 				break arc
 			case len(a.Obs) == 0:
 				a.Desig = desig // begin new arc
@@ -113,3 +298,392 @@ func ArcSplitter(rObs io.Reader, pMap observation.ParallaxMap) func() (*observat
 		return &a, e
 	}
 }
+
+// ArcSplitterOptions configures arc splitting.
+//
+// Options apply to ArcSplitter, SortedArcSplitter, and
+// ArcSplitterWithOptions, except MaxLines, which applies only to
+// SortedArcSplitter.
+type ArcSplitterOptions struct {
+	// MaxLines limits the number of input lines SortedArcSplitter will
+	// read.  0 means unlimited.
+	MaxLines int
+
+	// MaxObs limits the number of observations in returned arcs.  0 means
+	// unlimited.
+	MaxObs int
+
+	// Filter, if not nil, selects designations to keep.  Observation lines
+	// with other designations are skipped without being fully parsed.
+	// The designation is that of columns 0-12, with blanks trimmed.
+	Filter func(desig string) bool
+
+	// Ctx, if not nil, stops the split function when done.  The split
+	// function then returns a fatal error wrapping Ctx.Err().
+	Ctx context.Context
+
+	// OnError, if not nil, is called with each ArcError.
+	OnError func(ArcError)
+
+	// ContinueOnError, if true, skips ArcErrors rather than returning
+	// them.  They are still passed to OnError.
+	ContinueOnError bool
+}
+
+// ArcSplitterOption sets a field of ArcSplitterOptions.
+type ArcSplitterOption func(*ArcSplitterOptions)
+
+// MaxLines returns an ArcSplitterOption setting MaxLines.
+func MaxLines(n int) ArcSplitterOption {
+	return func(o *ArcSplitterOptions) { o.MaxLines = n }
+}
+
+// MaxObs returns an ArcSplitterOption setting MaxObs.
+func MaxObs(n int) ArcSplitterOption {
+	return func(o *ArcSplitterOptions) { o.MaxObs = n }
+}
+
+// WithMaxObs returns an ArcSplitterOption setting MaxObs.  It is the same
+// as MaxObs.
+func WithMaxObs(n int) ArcSplitterOption { return MaxObs(n) }
+
+// WithDesigFilter returns an ArcSplitterOption keeping only designations
+// selected by f.  It is combined with any other filter option so that both
+// must select a designation.
+func WithDesigFilter(f func(desig string) bool) ArcSplitterOption {
+	return addArcFilter(f)
+}
+
+// WithErrorCallback returns an ArcSplitterOption setting OnError.
+func WithErrorCallback(f func(ArcError)) ArcSplitterOption {
+	return func(o *ArcSplitterOptions) { o.OnError = f }
+}
+
+// WithContext returns an ArcSplitterOption setting Ctx.
+func WithContext(ctx context.Context) ArcSplitterOption {
+	return func(o *ArcSplitterOptions) { o.Ctx = ctx }
+}
+
+// WithContinueOnError returns an ArcSplitterOption setting
+// ContinueOnError.
+func WithContinueOnError(c bool) ArcSplitterOption {
+	return func(o *ArcSplitterOptions) { o.ContinueOnError = c }
+}
+
+// DesigPrefixFilter returns an ArcSplitterOption keeping only designations
+// beginning with one of prefixes.  It is combined with any other filter
+// option so that both must select a designation.
+func DesigPrefixFilter(prefixes ...string) ArcSplitterOption {
+	return addArcFilter(func(desig string) bool {
+		for _, p := range prefixes {
+			if strings.HasPrefix(desig, p) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// NumRangeFilter returns an ArcSplitterOption keeping only numbered objects
+// with numbers from min to max inclusive.  Numbers are decoded with
+// UnpackNumber.  It is combined with any other filter option so that both
+// must select a designation.
+func NumRangeFilter(min, max int) ArcSplitterOption {
+	return addArcFilter(func(desig string) bool {
+		n, err := UnpackNumber(desig)
+		return err == nil && n >= min && n <= max
+	})
+}
+
+func addArcFilter(f func(string) bool) ArcSplitterOption {
+	return func(o *ArcSplitterOptions) {
+		if g := o.Filter; g != nil {
+			o.Filter = func(desig string) bool { return g(desig) && f(desig) }
+		} else {
+			o.Filter = f
+		}
+	}
+}
+
+// SortedArcSplitter returns a function that yields observation arcs as
+// ArcSplitter, but without requiring the stream to be grouped by
+// designation.
+//
+// On the first call, the entire stream is read and buffered.  Arcs are then
+// returned in order of designation, with observations of each arc in order
+// of MJD.  Parse errors are returned first, as ArcErrors, in input order.
+// Unlike ArcSplitter, each returned arc is newly allocated.
+//
+// All options apply.  If the stream has more than MaxLines lines, counting
+// lines skipped by Filter, a fatal error is returned.  MaxObs, Filter, Ctx,
+// OnError, and ContinueOnError are as for ArcSplitter.  Ctx is also checked
+// while reading the stream.
+func SortedArcSplitter(r io.Reader, pMap observation.ParallaxMap,
+	opts ...ArcSplitterOption) func() (*observation.Arc, error) {
+	var o ArcSplitterOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	var (
+		arcs  []*observation.Arc
+		errs  []error
+		fatal error
+		read  bool
+	)
+	return o.wrapSplit(func() (*observation.Arc, error) {
+		if !read {
+			read = true
+			arcs, errs, fatal = readSortedArcs(r, pMap, &o)
+		}
+		switch {
+		case len(errs) > 0:
+			e := errs[0]
+			errs = errs[1:]
+			return nil, e
+		case fatal != nil:
+			return nil, fatal
+		case len(arcs) == 0:
+			return nil, io.EOF
+		}
+		a := arcs[0]
+		arcs = arcs[1:]
+		return a, nil
+	})
+}
+
+func readSortedArcs(r io.Reader, pMap observation.ParallaxMap,
+	o *ArcSplitterOptions) (arcs []*observation.Arc, errs []error, err error) {
+	sc := NewObs80Scanner(r, pMap)
+	sc.keep = o.Filter
+	var obs []ParsedObs80
+	for sc.Scan() {
+		if o.MaxLines > 0 && sc.n > o.MaxLines {
+			return nil, nil, fmt.Errorf(
+				"SortedArcSplitter: more than %d lines", o.MaxLines)
+		}
+		if o.Ctx != nil {
+			select {
+			case <-o.Ctx.Done():
+				return nil, nil, fmt.Errorf("SortedArcSplitter: %w",
+					o.Ctx.Err())
+			default:
+			}
+		}
+		desig, ob := sc.Observation()
+		if ob == nil {
+			le := sc.Err().(*obs80LineError)
+			errs = append(errs, newArcError(le.err, le.n))
+			continue
+		}
+		obs = append(obs, ParsedObs80{desig, ob})
+	}
+	if err = sc.Err(); err != nil {
+		return nil, nil, err
+	}
+	sort.SliceStable(obs, func(i, j int) bool {
+		if obs[i].Desig != obs[j].Desig {
+			return obs[i].Desig < obs[j].Desig
+		}
+		return obs[i].Obs.Meas().MJD < obs[j].Obs.Meas().MJD
+	})
+	var a *observation.Arc
+	for _, p := range obs {
+		if a == nil || p.Desig != a.Desig {
+			a = &observation.Arc{Desig: p.Desig}
+			arcs = append(arcs, a)
+		}
+		a.Obs = append(a.Obs, p.Obs)
+	}
+	return arcs, errs, nil
+}
+
+// ArcSplitterChan runs ArcSplitter in a goroutine, sending arcs on the
+// first returned channel and errors on the second.
+//
+// Both channels have a buffer of 1.  ArcErrors are sent on the error
+// channel and splitting continues.  At EOF, or after sending a fatal error,
+// both channels are closed.  Arcs sent are newly allocated.  Options opts
+// are as for ArcSplitter.
+//
+// The caller must receive from both channels until both are closed, or
+// stop the goroutine by cancelling a context given with WithContext.  To
+// receive arcs only, use WithContinueOnError, with WithErrorCallback if
+// ArcErrors are of interest; the error channel then receives only a fatal
+// error.
+func ArcSplitterChan(rObs io.Reader, pMap observation.ParallaxMap,
+	opts ...ArcSplitterOption) (<-chan *observation.Arc, <-chan error) {
+	var o ArcSplitterOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	var done <-chan struct{} // nil, never ready, without a context
+	if o.Ctx != nil {
+		done = o.Ctx.Done()
+	}
+	ac := make(chan *observation.Arc, 1)
+	ec := make(chan error, 1)
+	go func() {
+		defer close(ec)
+		defer close(ac)
+		f := ArcSplitter(rObs, pMap, opts...)
+		for {
+			a, err := f()
+			switch err.(type) {
+			case nil:
+				// ArcSplitter reuses its arc, send a copy
+				select {
+				case ac <- &observation.Arc{
+					Desig: a.Desig,
+					Obs:   append([]observation.VObs{}, a.Obs...),
+				}:
+				case <-done:
+					return
+				}
+			case ArcError:
+				select {
+				case ec <- err:
+				case <-done:
+					return
+				}
+			default:
+				if err != io.EOF {
+					select {
+					case ec <- err:
+					case <-done:
+					}
+				}
+				return
+			}
+		}
+	}()
+	return ac, ec
+}
+
+// SplitArc is an arc returned by ArcSplitterWithOptions.
+type SplitArc struct {
+	observation.Arc
+	// Continuation is true if the arc continues observations of the
+	// previously returned arc, which was limited by MaxObs.
+	Continuation bool
+}
+
+// ArcSplitterWithOptions returns a function that yields observation arcs as
+// ArcSplitter, with options.
+//
+// When an arc has more than opts.MaxObs observations, it is returned in
+// fragments of MaxObs observations, the last possibly fewer.  Fragments
+// after the first have Continuation set.  Arcs not selected by opts.Filter
+// are skipped.  Errors are as for ArcSplitter, with options Ctx, OnError,
+// and ContinueOnError.
+// Each returned arc is newly allocated.
+func ArcSplitterWithOptions(r io.Reader, pMap observation.ParallaxMap,
+	opts ArcSplitterOptions) func() (*SplitArc, error) {
+	f := ArcSplitter(r, pMap, func(o *ArcSplitterOptions) {
+		*o = opts
+		o.MaxObs = 0 // fragments are made here, with Continuation
+	})
+	var (
+		desig string
+		rest  []observation.VObs // observations yet to return
+		cont  bool
+	)
+	return func() (*SplitArc, error) {
+		if len(rest) == 0 {
+			a, err := f()
+			if err != nil {
+				return nil, err
+			}
+			desig = a.Desig
+			rest = append([]observation.VObs{}, a.Obs...)
+			cont = false
+		}
+		n := len(rest)
+		if opts.MaxObs > 0 && n > opts.MaxObs {
+			n = opts.MaxObs
+		}
+		sa := &SplitArc{
+			Arc:          observation.Arc{Desig: desig, Obs: rest[:n:n]},
+			Continuation: cont,
+		}
+		rest = rest[n:]
+		cont = true
+		return sa, nil
+	}
+}
+
+// MergeArcs returns a new arc with the observations of a and b, sorted by
+// MJD.
+//
+// Observations with the same MJD and observatory code are duplicates and
+// only the first, from a if in both, is kept.  The two lines of a satellite
+// or roving observer observation are parsed as a single observation and so
+// stay together.  An error is returned if the designations differ.
+func MergeArcs(a, b *observation.Arc) (*observation.Arc, error) {
+	if a.Desig != b.Desig {
+		return nil, fmt.Errorf("MergeArcs: designations differ (%s, %s)",
+			a.Desig, b.Desig)
+	}
+	all := make([]observation.VObs, 0, len(a.Obs)+len(b.Obs))
+	all = append(append(all, a.Obs...), b.Obs...)
+	sort.SliceStable(all, func(i, j int) bool {
+		return all[i].Meas().MJD < all[j].Meas().MJD
+	})
+	m := &observation.Arc{Desig: a.Desig, Obs: all[:0]}
+	type key struct {
+		mjd  float64
+		code string
+	}
+	seen := map[key]bool{}
+	for _, o := range all {
+		k := key{o.Meas().MJD, o.Meas().Qual}
+		if !seen[k] {
+			seen[k] = true
+			m.Obs = append(m.Obs, o)
+		}
+	}
+	return m, nil
+}
+
+// FilterArc returns a new arc with the observations of arc for which keep
+// returns true.  The designation is preserved.
+//
+// Keep is called once per observation.  A satellite observation is a single
+// *observation.SatObs holding data from both lines, so the lines are kept or
+// removed together.  Note though that a SatObs parsed from line 1 alone,
+// as by ParseObs80, has a zero Offset; FilterArc does not check this.
+func FilterArc(arc *observation.Arc, keep func(observation.VObs) bool) *observation.Arc {
+	f := &observation.Arc{Desig: arc.Desig}
+	for _, o := range arc.Obs {
+		if keep(o) {
+			f.Obs = append(f.Obs, o)
+		}
+	}
+	return f
+}
+
+// ArcObservers returns the unique observatory codes of the observations of
+// arc, in order of first appearance.
+//
+// The code of an *observation.SatObs is taken from Sat, that of other
+// observations from Meas().Qual.
+func ArcObservers(arc *observation.Arc) []string {
+	var codes []string
+	seen := map[string]bool{}
+	for _, o := range arc.Obs {
+		c := obsObserver(o)
+		if !seen[c] {
+			seen[c] = true
+			codes = append(codes, c)
+		}
+	}
+	return codes
+}
+
+// obsObserver returns the observatory code of o as described for
+// ArcObservers.
+func obsObserver(o observation.VObs) string {
+	if s, ok := o.(*observation.SatObs); ok {
+		return s.Sat
+	}
+	return o.Meas().Qual
+}
@@ -4,10 +4,16 @@ package mpcformat_test
 
 import (
 	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
 	"io"
+	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/soniakeys/mpcformat"
+	"github.com/soniakeys/observation"
 )
 
 const (
@@ -30,6 +36,14 @@ const (
 	satDesig = "03620"
 	sat      = `03620         S1996 08 30.51477 21 07 31.918-05 22 00.82                27764250
 03620         s1996 08 30.51477 1 -  344.3553 - 6919.1239 +  872.2948   27764250
+`
+	// satellite line 2 with a bad offset
+	satBad2 = `03620         s1996 08 30.51477 1 -  344.3x53 - 6919.1239 +  872.2948   27764250
+`
+	// two-line roving observer obs
+	rovDesig = "K08K42F"
+	rov      = `     K08K42F  V2008 05 29.31938 15 35 25.23 -15 47 39.5          16.9 V      247
+     K08K42F  v2008 05 29.31938   248.904000 +32.417000  2525                247
 `
 	short = `NE00030 C2004 09 16.15206 16 13 11.57 +20 52 23.7 21.1 V 291
 `
@@ -62,11 +76,33 @@ var arcTests = []struct {
 	{"satellite", sat, []arcRes{
 		{satDesig, 1, true},
 	}},
+	{"roving", rov + o1, []arcRes{
+		{rovDesig, 1, true},
+		{o1Desig, 1, true},
+	}},
 	{"mix", o3 + sat + sat + o1, []arcRes{
 		{o3Desig, 3, true},
 		{satDesig, 2, true},
 		{o1Desig, 1, true},
 	}},
+	{"satellite pairs", sat + sat + sat, []arcRes{
+		{satDesig, 3, true},
+	}},
+	{"satellite line 2 without line 1", sat[81:] + o1, []arcRes{
+		{"", 0, false},
+		{o1Desig, 1, true},
+	}},
+	{"satellite line 2 repeated", sat + sat[81:] + o1, []arcRes{
+		{satDesig, 1, true},
+		{"", 0, false},
+		{o1Desig, 1, true},
+	}},
+	{"satellite bad line 2", o3 + sat + sat[:81] + satBad2 + o1, []arcRes{
+		{o3Desig, 3, true},
+		{satDesig, 1, true},
+		{"", 0, false},
+		{o1Desig, 1, true},
+	}},
 	{"bad", bad, []arcRes{
 		{"", 0, false},
 	}},
@@ -126,3 +162,429 @@ func TestArcSplitter(t *testing.T) {
 		}
 	}
 }
+
+func TestSortedArcSplitter(t *testing.T) {
+	// interleaved designations, o2 lines reversed
+	in := o2[81:] + o1 + bad + o3 + o2[:81] + sat
+	f := mpcformat.SortedArcSplitter(bytes.NewBufferString(in), pMap)
+	if _, err := f(); err == nil {
+		t.Fatal("SortedArcSplitter: want parse error first")
+	} else if _, ok := err.(mpcformat.ArcError); !ok {
+		t.Fatalf("SortedArcSplitter error type %T, want ArcError", err)
+	}
+	for _, want := range []arcRes{
+		{satDesig, 1, true},
+		{o1Desig, 1, true},
+		{o2Desig, 2, true},
+		{o3Desig, 3, true},
+	} {
+		a, err := f()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if a.Desig != want.desig || len(a.Obs) != want.nObs {
+			t.Fatalf("SortedArcSplitter arc %s, %d obs, want %s, %d",
+				a.Desig, len(a.Obs), want.desig, want.nObs)
+		}
+		for i := 1; i < len(a.Obs); i++ {
+			if a.Obs[i].Meas().MJD < a.Obs[i-1].Meas().MJD {
+				t.Fatalf("SortedArcSplitter arc %s not sorted by MJD", a.Desig)
+			}
+		}
+	}
+	if _, err := f(); err != io.EOF {
+		t.Fatalf("SortedArcSplitter read past end err = %v, want io.EOF", err)
+	}
+	f = mpcformat.SortedArcSplitter(bytes.NewBufferString(in), pMap,
+		mpcformat.MaxLines(5))
+	if _, err := f(); err == nil {
+		t.Fatal("SortedArcSplitter: want MaxLines error")
+	} else if _, ok := err.(mpcformat.ArcError); ok {
+		t.Fatal("SortedArcSplitter MaxLines error should be fatal")
+	}
+	// MaxLines counts lines skipped by Filter
+	f = mpcformat.SortedArcSplitter(bytes.NewBufferString(in), pMap,
+		mpcformat.MaxLines(5), mpcformat.DesigPrefixFilter(o3Desig))
+	if _, err := f(); err == nil {
+		t.Fatal("SortedArcSplitter: want MaxLines error with filter")
+	}
+	// other options
+	var nErr int
+	f = mpcformat.SortedArcSplitter(bytes.NewBufferString(in), pMap,
+		mpcformat.DesigPrefixFilter(o3Desig), mpcformat.MaxObs(2),
+		mpcformat.WithContinueOnError(true),
+		mpcformat.WithErrorCallback(func(mpcformat.ArcError) { nErr++ }))
+	for _, n := range []int{2, 1} {
+		if a, err := f(); err != nil || a.Desig != o3Desig || len(a.Obs) != n {
+			t.Fatalf("SortedArcSplitter with options: %v, %v, want %d obs",
+				a, err, n)
+		}
+	}
+	if _, err := f(); err != io.EOF || nErr != 1 {
+		t.Fatalf("SortedArcSplitter with options: %v, %d errors", err, nErr)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	f = mpcformat.SortedArcSplitter(bytes.NewBufferString(in), pMap,
+		mpcformat.WithContext(ctx))
+	if _, err := f(); !errors.Is(err, context.Canceled) {
+		t.Fatalf("SortedArcSplitter with canceled context: %v", err)
+	}
+}
+
+func TestArcSplitterChan(t *testing.T) {
+	ac, ec := mpcformat.ArcSplitterChan(
+		bytes.NewBufferString(o1+short+sat+bad+o3), pMap)
+	var got []arcRes
+	for ac != nil || ec != nil {
+		select {
+		case a, ok := <-ac:
+			if !ok {
+				ac = nil
+				continue
+			}
+			got = append(got, arcRes{a.Desig, len(a.Obs), true})
+		case err, ok := <-ec:
+			if !ok {
+				ec = nil
+				continue
+			}
+			if _, ok := err.(mpcformat.ArcError); !ok {
+				t.Fatalf("ArcSplitterChan error %v type %T, want ArcError",
+					err, err)
+			}
+			got = append(got, arcRes{})
+		}
+	}
+	// order between channels is not defined, but arcs are in order
+	var desigs []string
+	nErr := 0
+	for _, r := range got {
+		if r.ok {
+			desigs = append(desigs, r.desig)
+		} else {
+			nErr++
+		}
+	}
+	if strings.Join(desigs, " ") != o1Desig+" "+satDesig+" "+o3Desig ||
+		nErr != 2 {
+		t.Fatalf("ArcSplitterChan got %v", got)
+	}
+	// ranging over arcs only
+	var nErr2 int
+	ac, ec = mpcformat.ArcSplitterChan(
+		bytes.NewBufferString(o1+short+sat+bad+bad+o3), pMap,
+		mpcformat.WithContinueOnError(true),
+		mpcformat.WithErrorCallback(func(mpcformat.ArcError) { nErr2++ }))
+	desigs = desigs[:0]
+	for a := range ac {
+		desigs = append(desigs, a.Desig)
+	}
+	if err := <-ec; err != nil || len(desigs) != 3 || nErr2 != 3 {
+		t.Fatalf("ArcSplitterChan arcs only: %v, %d errors, %v",
+			desigs, nErr2, err)
+	}
+	// stopping early
+	ctx, cancel := context.WithCancel(context.Background())
+	ac, _ = mpcformat.ArcSplitterChan(
+		bytes.NewBufferString(o1+bad+bad+bad+o2+o3), pMap,
+		mpcformat.WithContext(ctx))
+	<-ac
+	cancel()
+	for range ac { // closes without receiving errors
+	}
+}
+
+func TestArcSplitterWithOptions(t *testing.T) {
+	f := mpcformat.ArcSplitterWithOptions(bytes.NewBufferString(o3+o1+o2),
+		pMap, mpcformat.ArcSplitterOptions{MaxObs: 2})
+	for _, want := range []struct {
+		desig string
+		nObs  int
+		cont  bool
+	}{
+		{o3Desig, 2, false},
+		{o3Desig, 1, true},
+		{o1Desig, 1, false},
+		{o2Desig, 2, false},
+	} {
+		a, err := f()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if a.Desig != want.desig || len(a.Obs) != want.nObs ||
+			a.Continuation != want.cont {
+			t.Fatalf("ArcSplitterWithOptions = %s, %d obs, %t, want %+v",
+				a.Desig, len(a.Obs), a.Continuation, want)
+		}
+	}
+	if _, err := f(); err != io.EOF {
+		t.Fatalf("ArcSplitterWithOptions read past end err = %v", err)
+	}
+	var o mpcformat.ArcSplitterOptions
+	mpcformat.MaxObs(0)(&o)
+	f = mpcformat.ArcSplitterWithOptions(bytes.NewBufferString(o3), pMap, o)
+	if a, err := f(); err != nil || len(a.Obs) != 3 || a.Continuation {
+		t.Fatalf("MaxObs 0: %+v, %v", a, err)
+	}
+}
+
+func TestArcFilters(t *testing.T) {
+	const num = `00433         C2014 09 03.40285 02 53 00.70 +10 38 30.3          12.2 V      703
+`
+	in := o3 + num + sat + o1 + bad + o2
+	for _, tc := range []struct {
+		opts []mpcformat.ArcSplitterOption
+		want []string
+	}{
+		{nil, []string{o3Desig, "00433", satDesig, o1Desig, o2Desig}},
+		{[]mpcformat.ArcSplitterOption{
+			mpcformat.DesigPrefixFilter("NE001", "NE002")},
+			[]string{o3Desig, o2Desig}},
+		{[]mpcformat.ArcSplitterOption{mpcformat.NumRangeFilter(1, 1000)},
+			[]string{"00433"}},
+		{[]mpcformat.ArcSplitterOption{mpcformat.NumRangeFilter(1, 5000)},
+			[]string{"00433", satDesig}},
+		{[]mpcformat.ArcSplitterOption{
+			mpcformat.NumRangeFilter(1, 5000),
+			mpcformat.DesigPrefixFilter("036")},
+			[]string{satDesig}},
+	} {
+		var o mpcformat.ArcSplitterOptions
+		for _, opt := range tc.opts {
+			opt(&o)
+		}
+		f := mpcformat.ArcSplitterWithOptions(bytes.NewBufferString(in), pMap, o)
+		var got []string
+		nErr := 0
+		for {
+			a, err := f()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				// line numbers are of the input, not the filtered stream
+				if ae, ok := err.(mpcformat.ArcError); !ok || ae.LineNum != 8 {
+					t.Fatalf("err = %v, want ArcError at line 8", err)
+				}
+				nErr++
+				continue
+			}
+			got = append(got, a.Desig)
+		}
+		if strings.Join(got, " ") != strings.Join(tc.want, " ") || nErr != 1 {
+			t.Fatalf("filtered arcs %v, %d errors, want %v, 1 error",
+				got, nErr, tc.want)
+		}
+	}
+}
+
+func TestArcSplitterSatPairs(t *testing.T) {
+	f := mpcformat.ArcSplitter(bytes.NewBufferString(sat+sat+sat), pMap)
+	a, err := f()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, o := range a.Obs {
+		s, ok := o.(*observation.SatObs)
+		if !ok || s.Offset.X == 0 {
+			t.Fatalf("obs %d: %T without line 2 offset", i, o)
+		}
+	}
+}
+
+func TestArcSplitterWithStats(t *testing.T) {
+	// lines: o1 1, short 2, sat 3-4, bad 5, o3 6-8
+	f, st := mpcformat.ArcSplitterWithStats(
+		bytes.NewBufferString(o1+short+sat+bad+o3), pMap)
+	var lines []int
+	for {
+		_, err := f()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			ae, ok := err.(mpcformat.ArcError)
+			if !ok {
+				t.Fatal(err)
+			}
+			if !strings.HasPrefix(ae.Error(), "line ") {
+				t.Fatalf("ArcError message %q without line number", ae)
+			}
+			lines = append(lines, ae.LineNum)
+		}
+	}
+	if len(lines) != 2 || lines[0] != 2 || lines[1] != 5 {
+		t.Fatalf("ArcError line numbers %v, want [2 5]", lines)
+	}
+	if *st != (mpcformat.ArcSplitterStats{Lines: 8, Arcs: 3, Errors: 2}) {
+		t.Fatalf("ArcSplitterStats = %+v", *st)
+	}
+	g := mpcformat.SortedArcSplitter(bytes.NewBufferString(o1+short), pMap)
+	if _, err := g(); err == nil || err.(mpcformat.ArcError).LineNum != 2 {
+		t.Fatalf("SortedArcSplitter err = %v, want line 2", err)
+	}
+}
+
+func TestArcSplitterContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	f := mpcformat.ArcSplitterContext(ctx,
+		bytes.NewBufferString(o1+o2+o3), pMap)
+	a, err := f()
+	if err != nil || a.Desig != o1Desig {
+		t.Fatalf("first arc %v, %v", a, err)
+	}
+	cancel()
+	for i := 0; i < 2; i++ {
+		a, err = f()
+		if !errors.Is(err, context.Canceled) || a != nil {
+			t.Fatalf("after cancel: %v, %v, want context.Canceled", a, err)
+		}
+		if _, ok := err.(mpcformat.ArcError); ok {
+			t.Fatal("cancellation error is an ArcError")
+		}
+	}
+}
+
+func TestArcSplitterOptions(t *testing.T) {
+	var nErr int
+	f := mpcformat.ArcSplitter(bytes.NewBufferString(o1+bad+o3+o2+short), pMap,
+		mpcformat.WithMaxObs(2),
+		mpcformat.WithDesigFilter(func(d string) bool { return d != o2Desig }),
+		mpcformat.WithErrorCallback(func(mpcformat.ArcError) { nErr++ }),
+		mpcformat.WithContinueOnError(true))
+	var got []arcRes
+	for {
+		a, err := f()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, arcRes{a.Desig, len(a.Obs), true})
+	}
+	want := []arcRes{{o1Desig, 1, true}, {o3Desig, 2, true}, {o3Desig, 1, true}}
+	if !reflect.DeepEqual(got, want) || nErr != 2 {
+		t.Fatalf("got %v, %d errors, want %v, 2", got, nErr, want)
+	}
+	// no options
+	f = mpcformat.ArcSplitter(bytes.NewBufferString(bad+o3), pMap)
+	if _, err := f(); err == nil {
+		t.Fatal("no error without options")
+	}
+	if a, err := f(); err != nil || len(a.Obs) != 3 {
+		t.Fatalf("got %v, %v", a, err)
+	}
+}
+
+func TestArcSplitterGzip(t *testing.T) {
+	var z bytes.Buffer
+	zw := gzip.NewWriter(&z)
+	zw.Write([]byte(o1 + o2))
+	zw.Close()
+	for _, in := range [][]byte{z.Bytes(), []byte(o1 + o2)} {
+		f, err := mpcformat.ArcSplitterGzip(bytes.NewReader(in), pMap)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for {
+			a, err := f()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, a.Desig)
+		}
+		if strings.Join(got, " ") != o1Desig+" "+o2Desig {
+			t.Fatalf("ArcSplitterGzip arcs %v", got)
+		}
+	}
+	if _, err := mpcformat.ArcSplitterGzip(
+		bytes.NewReader([]byte{0x1f, 0x8b, 0, 0}), pMap); err == nil {
+		t.Fatal("ArcSplitterGzip accepted bad gzip header")
+	}
+}
+
+func TestMergeArcs(t *testing.T) {
+	parse := func(obs string) *observation.Arc {
+		a, err := mpcformat.ArcSplitter(bytes.NewBufferString(obs), pMap)()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return a
+	}
+	lines := strings.SplitAfter(o3, "\n")
+	// overlapping, out of order pieces
+	a := parse(lines[2] + lines[0])
+	b := parse(lines[1] + lines[2])
+	m, err := mpcformat.MergeArcs(a, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Desig != o3Desig || len(m.Obs) != 3 {
+		t.Fatalf("MergeArcs = %s, %d obs, want %s, 3",
+			m.Desig, len(m.Obs), o3Desig)
+	}
+	for i := 1; i < len(m.Obs); i++ {
+		if m.Obs[i].Meas().MJD <= m.Obs[i-1].Meas().MJD {
+			t.Fatal("MergeArcs result not sorted by MJD")
+		}
+	}
+	if _, err = mpcformat.MergeArcs(a, parse(o1)); err == nil {
+		t.Fatal("MergeArcs accepted different designations")
+	}
+}
+
+func TestFilterArc(t *testing.T) {
+	a, err := mpcformat.ArcSplitter(bytes.NewBufferString(o3), pMap)()
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := mpcformat.FilterArc(a, func(o observation.VObs) bool {
+		return o.Meas().VMag > 21.5
+	})
+	if f.Desig != o3Desig || len(f.Obs) != 2 || len(a.Obs) != 3 {
+		t.Fatalf("FilterArc = %s, %d obs, want %s, 2",
+			f.Desig, len(f.Obs), o3Desig)
+	}
+}
+
+func TestArcObservers(t *testing.T) {
+	a, err := mpcformat.ArcSplitter(bytes.NewBufferString(o3), pMap)()
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.Obs = append(a.Obs, &observation.SatObs{Sat: "250"})
+	if got := mpcformat.ArcObservers(a); !reflect.DeepEqual(got,
+		[]string{"291", "250"}) {
+		t.Fatalf("ArcObservers = %v, want [291 250]", got)
+	}
+}
+
+func TestArcErrorColStart(t *testing.T) {
+	badRA := o1[:32] + "1x" + o1[34:]
+	badCode := o1[:77] + "XXX\n"
+	for _, tc := range []struct {
+		obs string
+		col int
+	}{
+		{badRA, 32},
+		{badCode, 77},
+		{sat[:81] + satBad2, 34},
+		{short, -1},
+	} {
+		_, err := mpcformat.ArcSplitter(bytes.NewBufferString(tc.obs), pMap)()
+		ae, ok := err.(mpcformat.ArcError)
+		if !ok {
+			t.Fatalf("%q: error %v, want ArcError", tc.obs, err)
+		}
+		if ae.ColStart != tc.col {
+			t.Fatalf("%q: ColStart = %d, want %d", tc.obs, ae.ColStart, tc.col)
+		}
+	}
+}
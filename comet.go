@@ -0,0 +1,154 @@
+// Public domain.
+
+package mpcformat
+
+import (
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/soniakeys/coord"
+	"github.com/soniakeys/observation"
+)
+
+// CometObs represents a comet observation with a magnitude of a specified
+// type.  It satisfies the observation.VObs interface.
+type CometObs struct {
+	observation.VMeas
+	Par       *observation.ParallaxConst
+	CometType byte // 'N' nucleus, 'C' coma, 0 unspecified
+}
+
+// Meas satisfies a method of the observation.VObs interface.
+func (o *CometObs) Meas() *observation.VMeas {
+	return &o.VMeas
+}
+
+// EarthObserverVect satisfies a method of the observation.VObs interface.
+func (o *CometObs) EarthObserverVect() coord.Cart {
+	return observation.EarthObserverVect(o.MJD, o.Par)
+}
+
+// ParseObs80Comet parses a comet observation line in the MPC 80 column
+// format.
+//
+// Columns 65-71 may hold a magnitude followed by a comet magnitude code,
+// TN for nucleus or TC for coma, as in "16.5TN".  The magnitude is stored
+// in VMag without band correction and the code in CometType.  Otherwise the
+// line is parsed as by ParseObs80 and CometType is 0.  The observatory code
+// must exist in ocm with parallax constants.  (Column numbers here are
+// Go-like.)
+func ParseObs80Comet(line80 string, ocm observation.ParallaxMap) (desig string,
+	o *CometObs, err error) {
+	var ct byte
+	var mag float64
+	if len(line80) == 80 {
+		ts := strings.TrimSpace(line80[65:71])
+		switch {
+		case strings.HasSuffix(ts, "TN"):
+			ct = 'N'
+		case strings.HasSuffix(ts, "TC"):
+			ct = 'C'
+		}
+		if ct != 0 {
+			ts = strings.TrimSpace(ts[:len(ts)-2])
+			if mag, err = strconv.ParseFloat(ts, 64); err != nil {
+				return "", nil, newParseError(ErrBadMag, ts, 65,
+					"ParseObs80Comet: Invalid mag (%s)", ts)
+			}
+			line80 = line80[:65] + "      " + line80[71:]
+		}
+	}
+	desig, vo, err := ParseObs80(line80, ParallaxMapResolver(ocm))
+	if err != nil {
+		return "", nil, err
+	}
+	so, ok := vo.(*observation.SiteObs)
+	if !ok {
+		return "", nil, newParseError(ErrUnknownObscode, line80[77:80], 77,
+			"ParseObs80Comet: No parallax constants for observatory code (%s)",
+			line80[77:80])
+	}
+	o = &CometObs{VMeas: so.VMeas, Par: so.Par, CometType: ct}
+	if ct != 0 {
+		o.VMag = mag
+	}
+	return desig, o, nil
+}
+
+// CometObs80 represents a comet observation with coma measurements from a
+// second line.
+//
+// ComaDiamArcmin is NaN and DegreeCond is -1 when not measured.
+type CometObs80 struct {
+	observation.SiteObs
+	ComaDiamArcmin float64 // coma diameter, arc minutes
+	DegreeCond     int     // degree of condensation, DC, 0-9
+}
+
+// ParseCometObs80 parses a comet observation of the MPC 80 column format
+// with an optional second line of coma measurements.
+//
+// Line 1 is parsed as by ParseObs80Comet.  A '2' in note 1, column 13,
+// marks the magnitude as that of the total nucleus.  Such a magnitude, or
+// one with a comet magnitude code, is stored in VMag without band
+// correction.
+//
+// An empty line2 means no coma measurement.  Otherwise line2 must have 80
+// characters with designation, date, and observatory code matching line 1.
+// The coma diameter in arc minutes is taken from columns 32-37 and the
+// degree of condensation from column 39.  Either may be blank.  (Column
+// numbers here are Go-like.)
+func ParseCometObs80(line1, line2 string, ocm observation.ParallaxMap) (desig string,
+	o *CometObs80, err error) {
+	desig, c, err := ParseObs80Comet(line1, ocm)
+	if err != nil {
+		return "", nil, err
+	}
+	o = &CometObs80{
+		SiteObs:        observation.SiteObs{VMeas: c.VMeas, Par: c.Par},
+		ComaDiamArcmin: math.NaN(),
+		DegreeCond:     -1,
+	}
+	if line1[13] == '2' && c.CometType == 0 {
+		if ts := strings.TrimSpace(line1[65:70]); ts != "" {
+			// already validated by ParseObs80Comet
+			o.VMag, _ = strconv.ParseFloat(ts, 64)
+		}
+	}
+	if line2 == "" {
+		return desig, o, nil
+	}
+	if len(line2) != 80 {
+		return "", nil, newParseError(ErrShortLine, line2, -1,
+			"ParseCometObs80: line 2 requires 80 characters")
+	}
+	switch d2 := strings.TrimSpace(line2[:12]); {
+	case d2 != desig:
+		return "", nil, newParseError(ErrInvalidField, d2, 0,
+			"ParseCometObs80: line 2 designation = %s, line 1 was %s",
+			d2, desig)
+	case line2[15:32] != line1[15:32]:
+		return "", nil, newParseError(ErrBadDate, line2[15:32], 15,
+			"ParseCometObs80: line 2 date %s different from line 1",
+			line2[15:32])
+	case line2[77:80] != line1[77:80]:
+		return "", nil, newParseError(ErrInvalidField, line2[77:80], 77,
+			"ParseCometObs80: line 2 obscode = %s, line 1 was %s",
+			line2[77:80], line1[77:80])
+	}
+	if ts := strings.TrimSpace(line2[32:38]); ts != "" {
+		if o.ComaDiamArcmin, err = strconv.ParseFloat(ts, 64); err != nil {
+			return "", nil, newParseError(ErrInvalidField, ts, 32,
+				"ParseCometObs80: Invalid coma diameter (%s)", ts)
+		}
+	}
+	switch dc := line2[39]; {
+	case dc >= '0' && dc <= '9':
+		o.DegreeCond = int(dc - '0')
+	case dc != ' ':
+		return "", nil, newParseError(ErrInvalidField, line2[39:40], 39,
+			"ParseCometObs80: Invalid degree of condensation (%c)", dc)
+	}
+	return desig, o, nil
+}
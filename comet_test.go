@@ -0,0 +1,92 @@
+// Public domain.
+
+package mpcformat_test
+
+import (
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/soniakeys/mpcformat"
+	"github.com/soniakeys/observation"
+)
+
+func TestParseObs80Comet(t *testing.T) {
+	if pMapErr != nil {
+		t.Skip(pMapErr)
+	}
+	const line = "    CK14Q020  C2014 09 03.40285 02 53 00.70 +10 38 30.3          16.5TN      703"
+	for _, tc := range []struct {
+		mag  string
+		vmag float64
+		ct   byte
+	}{
+		{"16.5TN", 16.5, 'N'},
+		{" 9.1TC", 9.1, 'C'},
+		{"16.5 V", 16.5, 0},
+		{"      ", 0, 0},
+	} {
+		desig, o, err := mpcformat.ParseObs80Comet(line[:65]+tc.mag+line[71:],
+			pMap)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if desig != "CK14Q020" || o.VMag != tc.vmag || o.CometType != tc.ct ||
+			o.Par != pMap["703"] {
+			t.Fatalf("ParseObs80Comet(%q) = %q, %+v", tc.mag, desig, o)
+		}
+		var _ observation.VObs = o
+	}
+	for _, mag := range []string{"16.xTN", "16.5TX"} {
+		if _, _, err := mpcformat.ParseObs80Comet(line[:65]+mag+line[71:],
+			pMap); err == nil {
+			t.Fatalf("ParseObs80Comet accepted %q", mag)
+		}
+	}
+}
+
+func TestParseCometObs80(t *testing.T) {
+	if pMapErr != nil {
+		t.Skip(pMapErr)
+	}
+	const line1 = "    CK14Q020 2C2014 09 03.40285 02 53 00.70 +10 38 30.3          16.5 N      703"
+	const line2 = "    CK14Q020  C2014 09 03.40285   2.5  6                                     703"
+	desig, o, err := mpcformat.ParseCometObs80(line1, line2, pMap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if desig != "CK14Q020" || o.ComaDiamArcmin != 2.5 || o.DegreeCond != 6 ||
+		o.VMag != 16.5 || o.Par != pMap["703"] {
+		t.Fatalf("got %q, %+v", desig, o)
+	}
+	var _ observation.VObs = o
+	_, o, err = mpcformat.ParseCometObs80(line1, "", pMap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !math.IsNaN(o.ComaDiamArcmin) || o.DegreeCond != -1 {
+		t.Fatalf("no line 2: %+v", o)
+	}
+	// without the note 1 '2', the magnitude is band corrected
+	_, o, err = mpcformat.ParseCometObs80(line1[:13]+" "+line1[14:], "", pMap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o.VMag == 16.5 {
+		t.Fatalf("no total nucleus flag: %+v", o)
+	}
+	for _, bad := range []string{
+		line2[:30],
+		"    CK14Q021" + line2[12:],
+		line2[:16] + "3" + line2[17:],
+		line2[:32] + "  2.x " + line2[38:],
+		line2[:39] + "x" + line2[40:],
+		line2[:77] + "704",
+	} {
+		_, _, err := mpcformat.ParseCometObs80(line1, bad, pMap)
+		var pe *mpcformat.ParseError
+		if !errors.As(err, &pe) {
+			t.Errorf("ParseCometObs80 line 2 %q: err = %v", bad, err)
+		}
+	}
+}
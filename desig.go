@@ -0,0 +1,390 @@
+// Public domain.
+
+package mpcformat
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// base-62 digits used in packed numbers and designations.
+const b62 = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+func b62Digit(c byte) (int, bool) {
+	switch {
+	case c >= '0' && c <= '9':
+		return int(c - '0'), true
+	case c >= 'A' && c <= 'Z':
+		return int(c-'A') + 10, true
+	case c >= 'a' && c <= 'z':
+		return int(c-'a') + 36, true
+	}
+	return 0, false
+}
+
+// UnpackNumber unpacks a packed minor planet number.
+//
+// Numbers through 99999 are packed as five digits.  Numbers through 619999
+// use a leading letter, A-Z then a-z, to represent the ten-thousands.
+// Numbers 620000 and above are packed as a tilde followed by four base-62
+// digits, giving the amount over 620000.
+//
+// A plain decimal number of any width is also accepted.
+func UnpackNumber(s string) (int, error) {
+	switch {
+	case len(s) == 0:
+	case s[0] == '~':
+		if len(s) != 5 {
+			break
+		}
+		n := 0
+		for i := 1; i < 5; i++ {
+			d, ok := b62Digit(s[i])
+			if !ok {
+				return 0, fmt.Errorf("Can't unpack number %s", s)
+			}
+			n = n*62 + d
+		}
+		return 620000 + n, nil
+	case s[0] >= '0' && s[0] <= '9':
+		if n, err := strconv.Atoi(s); err == nil && n >= 0 {
+			return n, nil
+		}
+	default:
+		if len(s) != 5 {
+			break
+		}
+		h, ok := b62Digit(s[0])
+		if !ok {
+			break
+		}
+		n, err := strconv.Atoi(s[1:])
+		if err != nil || n < 0 {
+			break
+		}
+		return h*10000 + n, nil
+	}
+	return 0, fmt.Errorf("Can't unpack number %s", s)
+}
+
+// PackNumber packs a minor planet number into the five character form
+// used by MPC formats.
+//
+// See UnpackNumber for a description of the packed forms.
+func PackNumber(n int) (string, error) {
+	switch {
+	case n < 0:
+	case n < 100000:
+		return fmt.Sprintf("%05d", n), nil
+	case n < 620000:
+		return fmt.Sprintf("%c%04d", b62[n/10000], n%10000), nil
+	case n < 620000+62*62*62*62:
+		n -= 620000
+		b := []byte("~0000")
+		for i := 4; i > 0; i-- {
+			b[i] = b62[n%62]
+			n /= 62
+		}
+		return string(b), nil
+	}
+	return "", fmt.Errorf("Can't pack number %d", n)
+}
+
+// IsNEOCPDesig returns true if desig has the form of a temporary designation
+// of the NEO Confirmation Page, such as P10yv7l.
+//
+// These are one to seven letters and digits starting with a letter, and not
+// of the form of a packed number, packed provisional designation, or packed
+// survey designation.
+func IsNEOCPDesig(desig string) bool {
+	if len(desig) == 0 || len(desig) > 7 || !isLetter(desig[0]) {
+		return false
+	}
+	for i := 0; i < len(desig); i++ {
+		if _, ok := b62Digit(desig[i]); !ok {
+			return false
+		}
+	}
+	switch len(desig) {
+	case 5: // packed number, A0345
+		return !allDigits(desig[1:])
+	case 7: // packed provisional or survey designation
+		return !isPackedProvisional(desig) && !isPackedSurvey(desig)
+	}
+	return true
+}
+
+// isPackedProvisional returns true if s has the form of a packed
+// provisional designation, such as K08K42F.
+func isPackedProvisional(s string) bool {
+	if len(s) != 7 {
+		return false
+	}
+	_, ok := b62Digit(s[4])
+	return (s[0] == 'I' || s[0] == 'J' || s[0] == 'K') &&
+		allDigits(s[1:3]) && s[3] >= 'A' && s[3] <= 'Y' && ok &&
+		allDigits(s[5:6]) && s[6] >= 'A' && s[6] <= 'Z'
+}
+
+// isPackedSurvey returns true if s has the form of a packed survey
+// designation, such as PLS2040.
+func isPackedSurvey(s string) bool {
+	if len(s) != 7 {
+		return false
+	}
+	switch s[:3] {
+	case "PLS", "T1S", "T2S", "T3S":
+		return allDigits(s[3:])
+	}
+	return false
+}
+
+// isPackedComet returns true if s has the form of a packed comet
+// designation, either numbered, such as 0001P, or provisional, such as
+// CJ95O010.
+func isPackedComet(s string) bool {
+	switch len(s) {
+	case 5:
+		return allDigits(s[:4]) && (s[4] == 'P' || s[4] == 'D')
+	case 8:
+		f := s[7]
+		return strings.IndexByte("PCDXAI", s[0]) >= 0 &&
+			isPackedProvisional(s[1:7]+"A") &&
+			(f == '0' || f >= 'a' && f <= 'z')
+	}
+	return false
+}
+
+// DesigKind is a kind of minor planet or comet designation.
+type DesigKind int
+
+// DesigKind values.
+const (
+	DesigUnknown DesigKind = iota
+	DesigNumbered
+	DesigProvisional
+	DesigSurvey
+	DesigComet
+)
+
+// DesigType returns the kind of packed designation packed.
+func DesigType(packed string) DesigKind {
+	switch {
+	case isPackedComet(packed):
+		return DesigComet
+	case len(packed) == 5:
+		if _, err := UnpackNumber(packed); err == nil {
+			return DesigNumbered
+		}
+	case isPackedProvisional(packed):
+		return DesigProvisional
+	case isPackedSurvey(packed):
+		return DesigSurvey
+	}
+	return DesigUnknown
+}
+
+var (
+	reNumbered    = regexp.MustCompile(`^(?:\((\d+)\)(?: .*)?|(\d+))$`)
+	reNumComet    = regexp.MustCompile(`^0*(\d{1,4})([PD])(?:/.*)?$`)
+	reProvisional = regexp.MustCompile(`^(\d{4}) ([A-Z])([A-Z])(\d*)$`)
+	reSurvey      = regexp.MustCompile(`^(\d{4}) (P-L|T-1|T-2|T-3)$`)
+	reComet       = regexp.MustCompile(
+		`^([PCDXAI])/(\d{4}) ([A-Z])(\d+)(?:-([A-Z]))?(?: .*)?$`)
+)
+
+// NormalizeDesig returns the packed form of a designation.
+//
+// Accepted are numbers, with or without parentheses and a following name,
+// as "(99942) Apophis" or "99942"; provisional designations as "1999 XA";
+// survey designations as "2040 P-L"; comet designations as "C/1995 O1" or
+// "1P/Halley"; and designations already packed.
+func NormalizeDesig(s string) (packed string, err error) {
+	s = strings.TrimSpace(s)
+	if m := reNumbered.FindStringSubmatch(s); m != nil {
+		n, err := strconv.Atoi(m[1] + m[2])
+		if err != nil {
+			return "", fmt.Errorf("Invalid designation %s", s)
+		}
+		return PackNumber(n)
+	}
+	if m := reNumComet.FindStringSubmatch(s); m != nil {
+		n, _ := strconv.Atoi(m[1])
+		return fmt.Sprintf("%04d%s", n, m[2]), nil
+	}
+	if m := reProvisional.FindStringSubmatch(s); m != nil {
+		return packProvisional(m[1], m[2], m[3], m[4], s)
+	}
+	if m := reSurvey.FindStringSubmatch(s); m != nil {
+		return m[2][:1] + m[2][2:] + "S" + m[1], nil
+	}
+	if m := reComet.FindStringSubmatch(s); m != nil {
+		p, err := packProvisional(m[2], m[3], "A", m[4], s)
+		if err != nil {
+			return "", err
+		}
+		f := "0"
+		if m[5] != "" {
+			f = strings.ToLower(m[5])
+		}
+		return m[1] + p[:6] + f, nil
+	}
+	if DesigType(s) != DesigUnknown {
+		return s, nil
+	}
+	return "", fmt.Errorf("Invalid designation %s", s)
+}
+
+// packProvisional packs the year, half-month letter, second letter, and
+// cycle count of a provisional designation.  Argument s is the designation
+// for error messages.
+func packProvisional(year, half, second, cycle, s string) (string, error) {
+	y, _ := strconv.Atoi(year)
+	n := 0
+	if cycle != "" {
+		n, _ = strconv.Atoi(cycle)
+	}
+	if y < 1800 || y > 2099 || half[0] == 'I' || half[0] == 'Z' ||
+		second[0] == 'I' || n > 619 {
+		return "", fmt.Errorf("Invalid designation %s", s)
+	}
+	return fmt.Sprintf("%c%02d%s%c%d%s",
+		'A'+y/100-10, y%100, half, b62[n/10], n%10, second), nil
+}
+
+func isLetter(c byte) bool {
+	return c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z'
+}
+
+func allDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// CompareDesig compares designations a and b in the order of MPCORB.DAT,
+// returning a negative number if a sorts before b, 0 if they are the same,
+// and a positive number if a sorts after b.
+//
+// Designations may be packed or unpacked and are packed with
+// NormalizeDesig.  Numbered objects sort first, by number, then
+// provisional designations by year, half-month, and order within the
+// half-month.  Survey designations, comets, and unrecognized designations
+// follow, each sorted by packed form or by text.
+func CompareDesig(a, b string) int {
+	pa, ka := desigSortKey(a)
+	pb, kb := desigSortKey(b)
+	switch {
+	case ka != kb:
+		return int(ka) - int(kb)
+	case ka == DesigNumbered:
+		na, _ := UnpackNumber(pa)
+		nb, _ := UnpackNumber(pb)
+		return na - nb
+	}
+	// packed provisional designations sort as text: the cycle count of
+	// characters 4-5 precedes the second letter of character 6.
+	return strings.Compare(pa, pb)
+}
+
+// DesigLess returns true if a sorts before b by CompareDesig.
+func DesigLess(a, b string) bool { return CompareDesig(a, b) < 0 }
+
+// desigSortKey returns the packed form of desig and its kind, with
+// DesigUnknown moved to sort last.
+func desigSortKey(desig string) (string, DesigKind) {
+	p, err := NormalizeDesig(desig)
+	if err != nil {
+		return desig, DesigComet + 1
+	}
+	return p, DesigType(p)
+}
+
+// PackedDesig is a designation in the packed form of MPCORB.DAT, as
+// returned by NormalizeDesig.
+type PackedDesig string
+
+// NewPackedFromNumber returns the packed designation of minor planet
+// number n.
+func NewPackedFromNumber(n int) (PackedDesig, error) {
+	p, err := PackNumber(n)
+	return PackedDesig(p), err
+}
+
+// NewPackedFromProvisional returns the packed designation of readable
+// provisional designation readable, such as "2008 KF42".
+func NewPackedFromProvisional(readable string) (PackedDesig, error) {
+	m := reProvisional.FindStringSubmatch(strings.TrimSpace(readable))
+	if m == nil {
+		return "", fmt.Errorf("Invalid provisional designation %s", readable)
+	}
+	p, err := packProvisional(m[1], m[2], m[3], m[4], readable)
+	return PackedDesig(p), err
+}
+
+// String returns d as a string.
+func (d PackedDesig) String() string { return string(d) }
+
+// IsNumbered returns true if d is a packed minor planet number.
+func (d PackedDesig) IsNumbered() bool {
+	return DesigType(string(d)) == DesigNumbered
+}
+
+// IsProvisional returns true if d is a packed provisional designation.
+func (d PackedDesig) IsProvisional() bool {
+	return DesigType(string(d)) == DesigProvisional
+}
+
+// Number returns the minor planet number of d and true if d is numbered.
+func (d PackedDesig) Number() (int, bool) {
+	if !d.IsNumbered() {
+		return 0, false
+	}
+	n, err := UnpackNumber(string(d))
+	return n, err == nil
+}
+
+// Unpack returns the readable form of d, the inverse of NormalizeDesig.
+//
+// Numbers are returned without parentheses, as "433".
+func (d PackedDesig) Unpack() (string, error) {
+	s := string(d)
+	switch DesigType(s) {
+	case DesigNumbered:
+		n, _ := UnpackNumber(s)
+		return strconv.Itoa(n), nil
+	case DesigProvisional:
+		return unpackProvisional(s), nil
+	case DesigSurvey:
+		return s[3:] + " " + s[:1] + "-" + s[1:2], nil
+	case DesigComet:
+		if len(s) == 5 {
+			n, _ := strconv.Atoi(s[:4])
+			return strconv.Itoa(n) + s[4:], nil
+		}
+		u := unpackProvisional(s[1:7] + "A")
+		u = s[:1] + "/" + u[:6] + u[7:] // drop second letter
+		if f := s[7]; f != '0' {
+			u += "-" + string(f-'a'+'A')
+		}
+		return u, nil
+	}
+	return "", fmt.Errorf("Can't unpack designation %s", s)
+}
+
+// unpackProvisional unpacks packed provisional designation s.
+func unpackProvisional(s string) string {
+	c, _ := b62Digit(s[0])
+	n, _ := b62Digit(s[4])
+	n = n*10 + int(s[5]-'0')
+	u := fmt.Sprintf("%d%s %c%c", c, s[1:3], s[3], s[6])
+	if n > 0 {
+		u += strconv.Itoa(n)
+	}
+	return u
+}
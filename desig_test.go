@@ -0,0 +1,124 @@
+// Public domain.
+
+package mpcformat_test
+
+import (
+	"testing"
+
+	"github.com/soniakeys/mpcformat"
+)
+
+func TestNormalizeDesig(t *testing.T) {
+	for _, tc := range []struct {
+		in, packed string
+		kind       mpcformat.DesigKind
+	}{
+		{"1999 XA", "J99X00A", mpcformat.DesigProvisional},
+		{"J99X00A", "J99X00A", mpcformat.DesigProvisional},
+		{"2008 KF42", "K08K42F", mpcformat.DesigProvisional},
+		{"2016 AB123", "K16AC3B", mpcformat.DesigProvisional},
+		{"(99942) Apophis", "99942", mpcformat.DesigNumbered},
+		{"99942", "99942", mpcformat.DesigNumbered},
+		{"(100345)", "A0345", mpcformat.DesigNumbered},
+		{"A0345", "A0345", mpcformat.DesigNumbered},
+		{"620000", "~0000", mpcformat.DesigNumbered},
+		{"2040 P-L", "PLS2040", mpcformat.DesigSurvey},
+		{"3138 T-1", "T1S3138", mpcformat.DesigSurvey},
+		{"C/1995 O1", "CJ95O010", mpcformat.DesigComet},
+		{"C/2019 Y4-B", "CK19Y04b", mpcformat.DesigComet},
+		{"1P/Halley", "0001P", mpcformat.DesigComet},
+		{" 73P ", "0073P", mpcformat.DesigComet},
+	} {
+		p, err := mpcformat.NormalizeDesig(tc.in)
+		if err != nil || p != tc.packed {
+			t.Errorf("NormalizeDesig(%q) = %q, %v, want %q",
+				tc.in, p, err, tc.packed)
+			continue
+		}
+		if k := mpcformat.DesigType(p); k != tc.kind {
+			t.Errorf("DesigType(%q) = %d, want %d", p, k, tc.kind)
+		}
+	}
+	for _, bad := range []string{"", "Apophis", "1999 IA", "2199 XA",
+		"1999 XA620", "P10yv7l", "(12x)"} {
+		if p, err := mpcformat.NormalizeDesig(bad); err == nil {
+			t.Errorf("NormalizeDesig(%q) = %q, no error", bad, p)
+		}
+	}
+	if k := mpcformat.DesigType("P10yv7l"); k != mpcformat.DesigUnknown {
+		t.Errorf("DesigType(P10yv7l) = %d", k)
+	}
+}
+
+func TestCompareDesig(t *testing.T) {
+	// in sort order
+	order := []string{
+		"1", "(433) Eros", "99999", "A0000", "(100345)", "z9999",
+		"620000", "~0001",
+		"J99X00A", "1999 XB", "1999 XA1", "2000 AA", "K08K42F",
+		"2040 P-L", "C/1995 O1",
+		"P10yv7l",
+	}
+	for i, a := range order {
+		for j, b := range order {
+			c := mpcformat.CompareDesig(a, b)
+			switch {
+			case i < j && c >= 0, i == j && c != 0, i > j && c <= 0:
+				t.Errorf("CompareDesig(%q, %q) = %d", a, b, c)
+			}
+		}
+	}
+	if !mpcformat.DesigLess("99942", "1999 XA") ||
+		mpcformat.DesigLess("J99X00A", "1999 XA") {
+		t.Error("DesigLess")
+	}
+}
+
+func TestPackedDesig(t *testing.T) {
+	for _, tc := range []struct {
+		packed   mpcformat.PackedDesig
+		unpacked string
+		num      int
+		prov     bool
+	}{
+		{"00433", "433", 433, false},
+		{"~0000", "620000", 620000, false},
+		{"K08K42F", "2008 KF42", 0, true},
+		{"J99X00A", "1999 XA", 0, true},
+		{"PLS2040", "2040 P-L", 0, false},
+		{"CJ95O010", "C/1995 O1", 0, false},
+		{"CK19Y04b", "C/2019 Y4-B", 0, false},
+		{"0001P", "1P", 0, false},
+	} {
+		u, err := tc.packed.Unpack()
+		if err != nil || u != tc.unpacked {
+			t.Errorf("%s.Unpack() = %q, %v, want %q", tc.packed, u, err,
+				tc.unpacked)
+		}
+		n, ok := tc.packed.Number()
+		if n != tc.num || ok != (tc.num > 0) || tc.packed.IsNumbered() != ok {
+			t.Errorf("%s.Number() = %d, %t", tc.packed, n, ok)
+		}
+		if tc.packed.IsProvisional() != tc.prov {
+			t.Errorf("%s.IsProvisional() = %t", tc.packed, !tc.prov)
+		}
+		if p, err := mpcformat.NormalizeDesig(u); err != nil ||
+			p != tc.packed.String() {
+			t.Errorf("NormalizeDesig(%q) = %q, %v", u, p, err)
+		}
+	}
+	if _, err := mpcformat.PackedDesig("P10yv7l").Unpack(); err == nil {
+		t.Error("Unpack accepted P10yv7l")
+	}
+	if p, err := mpcformat.NewPackedFromNumber(100345); err != nil ||
+		p != "A0345" {
+		t.Errorf("NewPackedFromNumber = %q, %v", p, err)
+	}
+	if p, err := mpcformat.NewPackedFromProvisional("2008 KF42"); err != nil ||
+		p != "K08K42F" {
+		t.Errorf("NewPackedFromProvisional = %q, %v", p, err)
+	}
+	if _, err := mpcformat.NewPackedFromProvisional("433"); err == nil {
+		t.Error("NewPackedFromProvisional accepted 433")
+	}
+}
@@ -0,0 +1,48 @@
+// Public domain.
+
+package mpcformat
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Kinds of parse errors.  Errors returned by the package wrap these where
+// they apply and can be tested with errors.Is.
+var (
+	ErrShortLine      = errors.New("line wrong length")
+	ErrBadDate        = errors.New("bad date")
+	ErrUnknownObscode = errors.New("unknown observatory code")
+	ErrBadRA          = errors.New("bad RA")
+	ErrBadDec         = errors.New("bad Dec")
+	ErrBadMag         = errors.New("bad magnitude")
+	ErrInvalidField   = errors.New("invalid field")
+)
+
+// ParseError describes an error parsing a field of a record.
+//
+// Position is the Go-like starting column of the field within the record,
+// or -1 if unknown or not applicable.  Context is the full error message.
+type ParseError struct {
+	Kind     error  // one of the Err kinds above
+	Input    string // text that failed to parse
+	Position int
+	Context  string
+}
+
+// newParseError returns a ParseError with Context formatted as by
+// fmt.Sprintf.
+func newParseError(kind error, input string, pos int,
+	format string, a ...interface{}) *ParseError {
+	return &ParseError{kind, input, pos, fmt.Sprintf(format, a...)}
+}
+
+func (e *ParseError) Error() string {
+	if e.Context != "" {
+		return e.Context
+	}
+	return fmt.Sprintf("%v (%s)", e.Kind, e.Input)
+}
+
+// Unwrap returns Kind.
+func (e *ParseError) Unwrap() error { return e.Kind }
@@ -0,0 +1,49 @@
+// Public domain.
+
+package mpcformat_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/soniakeys/mpcformat"
+)
+
+func TestParseError(t *testing.T) {
+	if pMapErr != nil {
+		t.Skip(pMapErr)
+	}
+	line := strings.TrimSuffix(o1, "\n")
+	for _, tc := range []struct {
+		line string
+		kind error
+		pos  int
+	}{
+		{line[:79], mpcformat.ErrShortLine, -1},
+		{line[:15] + "2004 x9" + line[22:], mpcformat.ErrBadDate, 15},
+		{line[:32] + "1x" + line[34:], mpcformat.ErrBadRA, 32},
+		{line[:45] + "2x" + line[47:], mpcformat.ErrBadDec, 44},
+		{line[:65] + "21.x" + line[69:], mpcformat.ErrBadMag, 65},
+		{line[:77] + "zzz", mpcformat.ErrUnknownObscode, 77},
+	} {
+		_, _, err := mpcformat.ParseObs80(tc.line, mpcformat.ParallaxMapResolver(pMap))
+		if !errors.Is(err, tc.kind) {
+			t.Errorf("%q: err = %v, want %v", tc.line, err, tc.kind)
+			continue
+		}
+		var pe *mpcformat.ParseError
+		if !errors.As(err, &pe) || pe.Position != tc.pos ||
+			!strings.HasPrefix(pe.Error(), "ParseObs80") {
+			t.Errorf("%q: ParseError = %+v", tc.line, pe)
+		}
+	}
+	_, _, _, err := mpcformat.ParseObscodeLine("703 1x0.0000 0.84 +0.54 Catalina")
+	if !errors.Is(err, mpcformat.ErrInvalidField) {
+		t.Errorf("ParseObscodeLine err = %v", err)
+	}
+	if _, _, _, err = mpcformat.UnpackEpoch("K2"); !errors.Is(err,
+		mpcformat.ErrBadDate) {
+		t.Errorf("UnpackEpoch err = %v", err)
+	}
+}
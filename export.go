@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"math"
 	"reflect"
+	"sort"
 	"strconv"
 	"strings"
 )
@@ -72,6 +73,16 @@ const (
 	terpDate
 )
 
+// Exported terp values, as returned by ExportFieldTerp.
+const (
+	ExTerpString = terpString
+	ExTerpFloat  = terpFloat
+	ExTerpInt    = terpInt
+	ExTerpBool   = terpBool
+	ExTerpByte   = terpByte
+	ExTerpDate   = terpDate
+)
+
 // Fields of the text representation.  Decode data is mapped to a field name.
 // Terp values here represent the strictest way to interpret a field.
 var tFieldMap = map[string]decodeData{
@@ -105,17 +116,45 @@ var tFieldMap = map[string]decodeData{
 	// as a string it is expanded into the printable "JPL DExxx" format.
 	"PlEph":       {148, 149, terpByte},
 	"Comp":        {150, 160, terpString}, // agent which computed orbit
-	"Type":        {163, 165, terpInt},    // per orbit type constants below
-	"NEO":         {162, 163, terpBool},   // object is NEO
-	"Km":          {161, 162, terpBool},   // object is 1-km (or larger) NEO
-	"Seen":        {161, 162, terpBool},   // "...seen at earlier opposition"
-	"Crit":        {161, 162, terpBool},   // Critical list numbered object
-	"PHA":         {161, 162, terpBool},   // true means PHA
+	"Type":        {161, 165, terpInt},    // hex flags, low bits per constants below
+	"NEO":         {161, 165, terpBool},   // object is NEO
+	"Km":          {161, 165, terpBool},   // object is 1-km (or larger) NEO
+	"Seen":        {161, 165, terpBool},   // "...seen at earlier opposition"
+	"Crit":        {161, 165, terpBool},   // Critical list numbered object
+	"PHA":         {161, 165, terpBool},   // true means PHA
 	"Designation": {166, 194, terpString}, // Readable designation
 	// date of last observation used in orbit solution
 	"LastObs": {194, 202, terpDate},
 }
 
+// ExportFieldNames returns the names of all fields of the text format,
+// the names recognized by NewExportUnmarshaler, in alphabetical order.
+func ExportFieldNames() []string {
+	n := make([]string, 0, len(tFieldMap))
+	for k := range tFieldMap {
+		n = append(n, k)
+	}
+	sort.Strings(n)
+	return n
+}
+
+// ExportFieldRange returns the column range of a named field of the text
+// format.  Columns are Go-like, zero based with end exclusive.
+func ExportFieldRange(name string) (start, end int, ok bool) {
+	dd, ok := tFieldMap[name]
+	return dd.start, dd.end, ok
+}
+
+// ExportFieldTerp returns how a named field of the text format is
+// interpreted, as one of the ExTerp constants.
+func ExportFieldTerp(name string) (int, bool) {
+	dd, ok := tFieldMap[name]
+	return dd.terp, ok
+}
+
+// length of a full line of text format.
+const exportLineLen = 202
+
 // Ptb bits consist of "precise" and "planetary" bits.
 
 // Export format precise perturber bit definitions, per "precise indicator"
@@ -162,9 +201,45 @@ const (
 	ExSDO      = 17 // Scattered disk
 )
 
+// ExportOrbit holds commonly used fields of an export format orbit.
+//
+// It is a ready made struct for use with NewExportUnmarshaler.
+// Angles are in degrees.  Epoch and LastObs hold the text of their fields,
+// the packed epoch and the date as yyyymmdd.
+type ExportOrbit struct {
+	Desig       PackedDesig
+	H           float64 `val:"defNaN"`
+	G           float64 `val:"defNaN"`
+	Epoch       string
+	MA          float64
+	Peri        float64
+	Node        float64
+	Inc         float64
+	E           float64
+	M           float64
+	A           float64
+	U           string
+	Ref         string
+	NObs        int
+	NOpp        int
+	YFirst      int
+	YLast       int
+	Arc         int
+	RMS         float64 `val:"defNaN"`
+	Comp        string
+	Type        int
+	NEO         bool
+	PHA         bool
+	Designation string
+	LastObs     string
+}
+
 // An ExportUnmarshallFunc unmarshals a single orbit into a struct.
 //
-// The argument b is the orbit to unmarshal.
+// The argument b is the orbit to unmarshal.  It may be truncated, as by
+// removing trailing blanks.  A truncated string field gets the text present,
+// a truncated float field with the defNaN tag gets NaN, and other truncated
+// fields are an ExportLineError with Truncated set.
 //
 // ExportUnmarshallFuncs are created with NewExportUnmarshaler.
 // The result of a call to the ExportUnmarshallFunc is left in the struct
@@ -177,8 +252,13 @@ type fieldFunc func([]byte) error
 // a struct.
 //
 // The argument v specifies the struct.  The concrete type of v must be
-// pointer to struct.
-func NewExportUnmarshaler(v interface{}) (ExportUnmarshallFunc, error) {
+// pointer to struct.  Options opts modify unmarshaling.
+func NewExportUnmarshaler(v interface{},
+	opts ...ExportUnmarshalerOption) (ExportUnmarshallFunc, error) {
+	var c exportConfig
+	for _, o := range opts {
+		o(&c)
+	}
 	if v == nil {
 		return nil, errors.New("pointer to struct required")
 	}
@@ -191,34 +271,31 @@ func NewExportUnmarshaler(v interface{}) (ExportUnmarshallFunc, error) {
 		return nil, errors.New("pointer to struct required")
 	}
 	vt := ve.Type()
-	fieldFuncs := make([]fieldFunc, ve.NumField())
-	var nFields int
-	for i := range fieldFuncs {
+	fieldFuncs := make([]fieldFunc, 0, ve.NumField())
+	for i := 0; i < ve.NumField(); i++ {
 		fv := ve.Field(i) // settable field Value
 		sf := vt.Field(i) // StructField type information
-		// read tag key "export", set tfName if found
-		var tfName string
-		var dd decodeData
-		var ok bool
-		if tv := sf.Tag.Get("export"); tv > "" {
-			if tv == "-" || len(tv) > 1 && tv[:2] == "-," {
-				continue
-			}
-			if dd, ok = tFieldMap[tv]; !ok {
-				return nil, errors.New("export tag invalid, field: " + sf.Name)
-			}
-			tfName = tv
-		} else {
-			if dd, ok = tFieldMap[sf.Name]; !ok {
-				return nil, errors.New("unrecognized field: " + sf.Name)
+		tfName, dd, err := exportTField(&sf)
+		if err != nil {
+			return nil, err
+		}
+		if tfName == "" {
+			continue
+		}
+		add := func(f fieldFunc) {
+			if c.skipBad {
+				f = skipFunc(f, fv, &sf, c.fieldErr)
 			}
-			tfName = sf.Name
+			fieldFuncs = append(fieldFuncs, f)
 		}
 		var signed bool
 		switch fv.Kind() {
 		case reflect.String:
-			fieldFuncs[nFields] = strFunc(fv, dd, tfName)
-			nFields++
+			if c.strCallback != nil {
+				add(callbackFunc(c.strCallback, dd, sf.Name))
+			} else {
+				add(strFunc(fv, dd, tfName))
+			}
 			continue
 		case reflect.Int,
 			reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
@@ -226,36 +303,33 @@ func NewExportUnmarshaler(v interface{}) (ExportUnmarshallFunc, error) {
 			fallthrough
 		case reflect.Uint,
 			reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
-			if dd.terp != terpInt {
+			// Desig is text, but a numeric sField gets the unpacked number.
+			if dd.terp != terpInt && tfName != "Desig" {
 				break // error invalid type
 			}
-			fieldFuncs[nFields] = intFunc(fv, dd, tfName, sf.Name, signed)
-			nFields++
+			add(intFunc(fv, dd, tfName, sf.Name, signed))
 			continue
 		case reflect.Float32, reflect.Float64:
 			if dd.terp != terpFloat && dd.terp != terpInt {
 				break
 			}
-			var err error
-			fieldFuncs[nFields], err = floatFunc(fv, dd, &sf)
+			f, err := floatFunc(fv, dd, &sf)
 			if err != nil {
 				return nil, err
 			}
-			nFields++
+			add(f)
 			continue
 		case reflect.Bool:
 			if dd.terp != terpBool {
 				break
 			}
-			fieldFuncs[nFields] = boolFunc(fv, dd, tfName)
-			nFields++
+			add(boolFunc(fv, dd, tfName))
 			continue
 		}
 		return nil, errors.New("invald type for field: " + sf.Name)
 	}
 
 	// close on fieldFuncs, that's all
-	fieldFuncs = fieldFuncs[:nFields]
 	return func(data []byte) (err error) {
 		for _, f := range fieldFuncs {
 			if err = f(data); err != nil {
@@ -266,6 +340,102 @@ func NewExportUnmarshaler(v interface{}) (ExportUnmarshallFunc, error) {
 	}, nil
 }
 
+// exportTField returns the name and decode data of the tField for sField
+// sf, from tag key "export" if present, otherwise from the sField name.
+// The name is empty if the sField is to be ignored.
+func exportTField(sf *reflect.StructField) (string, decodeData, error) {
+	if tv := sf.Tag.Get("export"); tv > "" {
+		if tv == "-" || len(tv) > 1 && tv[:2] == "-," {
+			return "", decodeData{}, nil
+		}
+		dd, ok := tFieldMap[tv]
+		if !ok {
+			return "", dd, errors.New("export tag invalid, field: " + sf.Name)
+		}
+		return tv, dd, nil
+	}
+	dd, ok := tFieldMap[sf.Name]
+	if !ok {
+		return "", dd, errors.New("unrecognized field: " + sf.Name)
+	}
+	return sf.Name, dd, nil
+}
+
+// ExportUnmarshalerOption is an option for NewExportUnmarshaler.
+type ExportUnmarshalerOption func(*exportConfig)
+
+type exportConfig struct {
+	strCallback func(fieldName string, b []byte)
+	skipBad     bool
+	fieldErr    func(ExportLineError)
+}
+
+// WithStringCallback returns an ExportUnmarshalerOption that, for string
+// fields of the struct, calls fn with the struct field name and the raw,
+// untrimmed bytes of the field rather than setting the struct field.
+//
+// The slice b is valid only until the next call to the unmarshal function.
+func WithStringCallback(fn func(fieldName string, b []byte)) ExportUnmarshalerOption {
+	return func(c *exportConfig) { c.strCallback = fn }
+}
+
+// WithSkipBadFields returns an ExportUnmarshalerOption that, if skip is
+// true, ignores errors parsing individual fields.  The struct field of a
+// field with an error is set to its default value, NaN for a float field
+// with the defNaN tag and the zero value otherwise, and unmarshaling
+// continues.
+func WithSkipBadFields(skip bool) ExportUnmarshalerOption {
+	return func(c *exportConfig) { c.skipBad = skip }
+}
+
+// WithFieldErrorCallback returns an ExportUnmarshalerOption that calls fn
+// for each field error ignored with WithSkipBadFields.
+//
+// The ExportLineError passed to fn has Field set to the struct field name.
+// Line is zero as the unmarshal function does not know line numbers.
+func WithFieldErrorCallback(fn func(ExportLineError)) ExportUnmarshalerOption {
+	return func(c *exportConfig) { c.fieldErr = fn }
+}
+
+// skipFunc returns a fieldFunc that calls f, setting fv to its default
+// value and reporting the error to fn, if not nil, rather than returning
+// it.  The default value is NaN for a float field with the defNaN tag and
+// the zero value otherwise.
+func skipFunc(f fieldFunc, fv reflect.Value, sf *reflect.StructField,
+	fn func(ExportLineError)) fieldFunc {
+	def := reflect.Zero(fv.Type())
+	switch fv.Kind() {
+	case reflect.Float32, reflect.Float64:
+		for _, tag := range strings.Split(sf.Tag.Get("val"), ",") {
+			if tag == "defNaN" {
+				def = reflect.ValueOf(math.NaN()).Convert(fv.Type())
+			}
+		}
+	}
+	sfName := sf.Name
+	return func(data []byte) error {
+		if err := f(data); err != nil {
+			fv.Set(def)
+			if fn != nil {
+				le, ok := err.(ExportLineError)
+				if !ok {
+					le = ExportLineError{Field: sfName, Err: err}
+				}
+				fn(le)
+			}
+		}
+		return nil
+	}
+}
+
+func callbackFunc(fn func(string, []byte), dd decodeData,
+	sfName string) fieldFunc {
+	return func(data []byte) error {
+		fn(sfName, dd.field(data))
+		return nil
+	}
+}
+
 // any field can be requested as string.  for most fields, this means the
 // raw text from the field of the text representation.  An exception is
 // PlEph, which is expanded into a more readable string.
@@ -273,7 +443,11 @@ func strFunc(fv reflect.Value, dd decodeData, tfName string) fieldFunc {
 	if tfName == "PlEph" {
 		return func(data []byte) error {
 			var s string
-			switch data[dd.start] {
+			c := byte(' ')
+			if len(data) > dd.start {
+				c = data[dd.start]
+			}
+			switch c {
 			case ' ', 'd':
 				s = "JPL DE200"
 			case 'f':
@@ -288,7 +462,7 @@ func strFunc(fv reflect.Value, dd decodeData, tfName string) fieldFunc {
 		}
 	}
 	return func(data []byte) error {
-		fv.SetString(string(bytes.TrimSpace(data[dd.start:dd.end])))
+		fv.SetString(string(bytes.TrimSpace(dd.field(data))))
 		return nil
 	}
 }
@@ -302,47 +476,66 @@ func intFunc(fv reflect.Value, dd decodeData,
 		}
 	}
 	switch tfName {
-	case "Precise":
+	case "Num", "Desig":
 		return func(data []byte) error {
-			fs := string(bytes.TrimSpace(data[dd.start:dd.end]))
-			i, err := strconv.ParseUint(fs, 16, 64)
+			fs, err := numText(data, dd, sfName)
 			if err != nil {
-				return fmt.Errorf("%v. field: %s", err, sfName)
+				return err
 			}
-			set(fv, i)
+			n, err := UnpackNumber(fs)
+			if err != nil {
+				return exportFieldError(err, fs, dd.start, sfName)
+			}
+			set(fv, uint64(n))
 			return nil
 		}
-	case "YFirst", "YLast":
+	case "Type":
 		return func(data []byte) error {
-			fs := string(bytes.TrimSpace(data[dd.start:dd.end]))
-			sOpp := string(bytes.TrimSpace(data[123:126]))
-			nOpp, err := strconv.ParseUint(sOpp, 10, 64)
+			fs, err := numText(data, dd, sfName)
 			if err != nil {
-				return fmt.Errorf("%v. field: NObs", err)
+				return err
 			}
-			var i uint64
-			if nOpp > 1 {
-				i, err = strconv.ParseUint(fs, 10, 64)
-				if err != nil {
-					return fmt.Errorf("%v. field: %s", err, sfName)
-				}
+			f, err := strconv.ParseUint(fs, 16, 64)
+			if err != nil {
+				return exportFieldError(err, fs, dd.start, sfName)
+			}
+			set(fv, f&0x3f)
+			return nil
+		}
+	case "Precise":
+		return func(data []byte) error {
+			fs, err := numText(data, dd, sfName)
+			if err != nil {
+				return err
+			}
+			i, err := strconv.ParseUint(fs, 16, 64)
+			if err != nil {
+				return exportFieldError(err, fs, dd.start, sfName)
 			}
 			set(fv, i)
 			return nil
 		}
-	case "Arc":
+	case "YFirst", "YLast", "Arc":
+		// the columns hold years for multi-opposition orbits, days otherwise.
+		years := tfName != "Arc"
 		return func(data []byte) error {
-			fs := string(bytes.TrimSpace(data[dd.start:dd.end]))
-			sOpp := string(bytes.TrimSpace(data[123:126]))
+			fs, err := numText(data, dd, sfName)
+			if err != nil {
+				return err
+			}
+			sOpp, err := numText(data, tFieldMap["NOpp"], "NObs")
+			if err != nil {
+				return err
+			}
 			nOpp, err := strconv.ParseUint(sOpp, 10, 64)
 			if err != nil {
-				return fmt.Errorf("%v. field: NObs", err)
+				return exportFieldError(err, sOpp, 123, "NObs")
 			}
 			var i uint64
-			if nOpp == 1 {
+			if ExArcIsYears(int(nOpp)) == years {
 				i, err = strconv.ParseUint(fs, 10, 64)
 				if err != nil {
-					return fmt.Errorf("%v. field: %s", err, sfName)
+					return exportFieldError(err, fs, dd.start, sfName)
 				}
 			}
 			set(fv, i)
@@ -350,16 +543,77 @@ func intFunc(fv reflect.Value, dd decodeData,
 		}
 	}
 	return func(data []byte) error {
-		fs := string(bytes.TrimSpace(data[dd.start:dd.end]))
+		fs, err := numText(data, dd, sfName)
+		if err != nil {
+			return err
+		}
 		i, err := strconv.ParseUint(fs, 10, 64)
 		if err != nil {
-			return fmt.Errorf("%v. field: %s", err, sfName)
+			return exportFieldError(err, fs, dd.start, sfName)
 		}
 		set(fv, i)
 		return nil
 	}
 }
 
+// field returns the text of the tField in line data.  If data is truncated
+// before the end of the tField, the text is what is present, possibly empty.
+func (dd decodeData) field(data []byte) []byte {
+	switch {
+	case len(data) >= dd.end:
+		return data[dd.start:dd.end]
+	case len(data) > dd.start:
+		return data[dd.start:]
+	}
+	return nil
+}
+
+// numText returns the trimmed text of a numeric tField in line data, or an
+// error from truncError if data is truncated before the end of the tField.
+func numText(data []byte, dd decodeData, sfName string) (string, error) {
+	if len(data) < dd.end {
+		return "", truncError(dd, sfName)
+	}
+	return string(bytes.TrimSpace(data[dd.start:dd.end])), nil
+}
+
+// truncError returns an ExportLineError for a line truncated before the end
+// of the tField of dd.
+func truncError(dd decodeData, sfName string) error {
+	return ExportLineError{
+		Field:     sfName,
+		Truncated: true,
+		Err: newParseError(ErrShortLine, "", dd.start,
+			"line truncated. field: %s", sfName),
+	}
+}
+
+// exportFieldError returns a ParseError for err parsing field text fs
+// beginning at column start.
+func exportFieldError(err error, fs string, start int, name string) error {
+	return newParseError(ErrInvalidField, fs, start, "%v. field: %s", err, name)
+}
+
+// ExArcIsYears reports whether the arc columns of an export format orbit
+// hold years of first and last observation rather than an arc length in days.
+//
+// Argument nOpp is the number of oppositions, the NOpp field.
+func ExArcIsYears(nOpp int) bool {
+	return nOpp > 1
+}
+
+// ExArcDays returns the observed arc length in days.
+//
+// For single-opposition orbits arcField is the Arc field, already in days.
+// For multi-opposition orbits arcField should be the span in years,
+// YLast - YFirst, and is converted to days using a Julian year.
+func ExArcDays(arcField, nOppField int) float64 {
+	if ExArcIsYears(nOppField) {
+		return float64(arcField) * 365.25
+	}
+	return float64(arcField)
+}
+
 func floatFunc(fv reflect.Value, dd decodeData,
 	sf *reflect.StructField) (fieldFunc, error) {
 	cf := 1.
@@ -374,16 +628,24 @@ func floatFunc(fv reflect.Value, dd decodeData,
 			defaultVal = math.NaN()
 			useDefault = true
 		default:
-			return nil, fmt.Errorf("invalid tag: %s field: %s", tag, sf.Name)
+			return nil, newParseError(ErrInvalidField, tag, -1,
+				"invalid tag: %s field: %s", tag, sf.Name)
 		}
 	}
 	return func(data []byte) error {
+		if len(data) < dd.end {
+			if !useDefault {
+				return truncError(dd, sf.Name)
+			}
+			fv.SetFloat(defaultVal)
+			return nil
+		}
 		fs := string(bytes.TrimSpace(data[dd.start:dd.end]))
 		if z, err := strconv.ParseFloat(fs, 64); err == nil {
 			fv.SetFloat(z * cf)
 		} else {
 			if !useDefault {
-				return fmt.Errorf("%v. field: %s", err, sf.Name)
+				return exportFieldError(err, fs, dd.start, sf.Name)
 			}
 			fv.SetFloat(defaultVal)
 		}
@@ -395,41 +657,42 @@ func boolFunc(fv reflect.Value, dd decodeData, tfName string) fieldFunc {
 	switch tfName {
 	case "EAsm":
 		return func(data []byte) error {
-			fv.SetBool(data[dd.start] == 'E')
+			fv.SetBool(len(data) > dd.start && data[dd.start] == 'E')
 			return nil
 		}
 	case "DD":
 		return func(data []byte) error {
-			fv.SetBool(data[dd.start] == 'D')
+			fv.SetBool(len(data) > dd.start && data[dd.start] == 'D')
 			return nil
 		}
+	}
+	var bit uint64
+	switch tfName {
 	case "NEO":
-		return func(data []byte) error {
-			fv.SetBool(data[dd.start]&1<<11 != 0)
-			return nil
-		}
+		bit = 1 << 11
 	case "Km":
-		return func(data []byte) error {
-			fv.SetBool(data[dd.start]&1<<12 != 0)
-			return nil
-		}
+		bit = 1 << 12
 	case "Seen":
-		return func(data []byte) error {
-			fv.SetBool(data[dd.start]&1<<13 != 0)
-			return nil
-		}
+		bit = 1 << 13
 	case "Crit":
-		return func(data []byte) error {
-			fv.SetBool(data[dd.start]&1<<14 != 0)
-			return nil
-		}
+		bit = 1 << 14
 	case "PHA":
-		return func(data []byte) error {
-			fv.SetBool(data[dd.start]&1<<15 != 0)
-			return nil
+		bit = 1 << 15
+	default:
+		panic("boolFunc missing case")
+	}
+	return func(data []byte) error {
+		fs, err := numText(data, dd, tfName)
+		if err != nil {
+			return err
+		}
+		f, err := strconv.ParseUint(fs, 16, 64)
+		if err != nil {
+			return exportFieldError(err, fs, dd.start, tfName)
 		}
+		fv.SetBool(f&bit != 0)
+		return nil
 	}
-	panic("boolFunc missing case")
 }
 
 func UnpackEpoch(s string) (y, m int, d float64, err error) {
@@ -464,5 +727,18 @@ func UnpackEpoch(s string) (y, m int, d float64, err error) {
 	}
 	return (10+int(c1))*100 + yy, int(m1), float64(d1), nil
 fail:
-	return 0, 0, 0, fmt.Errorf("Can't parse epoch %s", s)
+	return 0, 0, 0, newParseError(ErrBadDate, s, -1, "Can't parse epoch %s", s)
+}
+
+// packEpoch packs a date as in the Epoch field of the text format, the
+// inverse of UnpackEpoch.  Day d is truncated to an integer.
+func packEpoch(y, m int, d float64) (string, error) {
+	const digits = "0123456789ABCDEFGHIJKLMNOPQRSTUV"
+	di := int(d)
+	if y < 1000 || y > 3599 || m < 1 || m > 12 || di < 1 || di > 31 {
+		return "", newParseError(ErrBadDate, fmt.Sprint(y, m, d), -1,
+			"Can't pack epoch %d %d %g", y, m, d)
+	}
+	return fmt.Sprintf("%c%02d%c%c",
+		'A'+y/100-10, y%100, digits[m], digits[di]), nil
 }
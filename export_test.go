@@ -0,0 +1,362 @@
+// Public domain.
+
+package mpcformat_test
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/soniakeys/mpcformat"
+)
+
+const ceres = "00001    3.34  0.12 K1813 352.23052   73.11528   80.30992   10.59351  0.0755347  0.21413094   2.7670463  0 MPO431490  6689 114 1801-2018 0.60 M-v 30h MPCLINUX   0000      (1) Ceres              20180304"
+
+// a single-opposition orbit, with arc length in days
+const oneOpp = "K18E05Z  22.1  0.15 K1813 118.48270  256.71843  177.01442    4.13811  0.2218541  0.27349563   2.3811045  E E2018-E68    18   1   12 days 0.24 M-v 3Eh MPCW       0000      2018 EZ5               20180312"
+
+// withDesig returns an export line with the packed designation replaced.
+func withDesig(line, desig string) []byte {
+	b := []byte(line)
+	copy(b, desig+"       "[len(desig):])
+	return b
+}
+
+var numTests = []struct {
+	packed string
+	num    int
+}{
+	{"00001", 1},
+	{"99999", 99999},
+	{"A0000", 100000},
+	{"Z9999", 359999},
+	{"a0000", 360000},
+	{"z9999", 619999},
+	{"~0000", 620000},
+	{"~000z", 620061},
+	{"~0010", 620062},
+	{"~AZaz", 620000 + ((10*62+35)*62+36)*62 + 61},
+	{"~zzzz", 620000 + 62*62*62*62 - 1},
+}
+
+func TestPackNumber(t *testing.T) {
+	for _, tc := range numTests {
+		n, err := mpcformat.UnpackNumber(tc.packed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != tc.num {
+			t.Fatalf("UnpackNumber(%q) = %d, want %d", tc.packed, n, tc.num)
+		}
+		p, err := mpcformat.PackNumber(tc.num)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p != tc.packed {
+			t.Fatalf("PackNumber(%d) = %q, want %q", tc.num, p, tc.packed)
+		}
+	}
+	for _, bad := range []string{"", "~", "~00", "~00-0", "A00", "#0001", "K14A"} {
+		if _, err := mpcformat.UnpackNumber(bad); err == nil {
+			t.Fatalf("UnpackNumber(%q) expected error", bad)
+		}
+	}
+	if _, err := mpcformat.PackNumber(-1); err == nil {
+		t.Fatal("PackNumber(-1) expected error")
+	}
+}
+
+func TestUnmarshalNum(t *testing.T) {
+	var o struct {
+		Num   int
+		Desig int64
+	}
+	f, err := mpcformat.NewExportUnmarshaler(&o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range numTests {
+		if err := f(withDesig(ceres, tc.packed)); err != nil {
+			t.Fatal(err)
+		}
+		if o.Num != tc.num || o.Desig != int64(tc.num) {
+			t.Fatalf("%s: Num, Desig = %d, %d, want %d",
+				tc.packed, o.Num, o.Desig, tc.num)
+		}
+	}
+}
+
+func TestArcYears(t *testing.T) {
+	var o struct {
+		NOpp, YFirst, YLast, Arc int
+	}
+	f, err := mpcformat.NewExportUnmarshaler(&o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = f([]byte(ceres)); err != nil {
+		t.Fatal(err)
+	}
+	if !mpcformat.ExArcIsYears(o.NOpp) {
+		t.Fatalf("ExArcIsYears(%d) = false, want true", o.NOpp)
+	}
+	if o.YFirst != 1801 || o.YLast != 2018 || o.Arc != 0 {
+		t.Fatalf("multi-opposition YFirst, YLast, Arc = %d, %d, %d",
+			o.YFirst, o.YLast, o.Arc)
+	}
+	if d := mpcformat.ExArcDays(o.YLast-o.YFirst, o.NOpp); d != 217*365.25 {
+		t.Fatalf("multi-opposition ExArcDays = %g, want %g", d, 217*365.25)
+	}
+	if err = f([]byte(oneOpp)); err != nil {
+		t.Fatal(err)
+	}
+	if mpcformat.ExArcIsYears(o.NOpp) {
+		t.Fatalf("ExArcIsYears(%d) = true, want false", o.NOpp)
+	}
+	if o.YFirst != 0 || o.YLast != 0 || o.Arc != 12 {
+		t.Fatalf("single-opposition YFirst, YLast, Arc = %d, %d, %d",
+			o.YFirst, o.YLast, o.Arc)
+	}
+	if d := mpcformat.ExArcDays(o.Arc, o.NOpp); d != 12 {
+		t.Fatalf("single-opposition ExArcDays = %g, want 12", d)
+	}
+}
+
+func TestExportField(t *testing.T) {
+	names := mpcformat.ExportFieldNames()
+	if len(names) == 0 || names[0] != "A" {
+		t.Fatalf("ExportFieldNames = %v, want A first", names)
+	}
+	for i := 1; i < len(names); i++ {
+		if names[i-1] >= names[i] {
+			t.Fatalf("ExportFieldNames not sorted: %v", names)
+		}
+	}
+	if s, e, ok := mpcformat.ExportFieldRange("H"); !ok || s != 8 || e != 13 {
+		t.Fatalf(`ExportFieldRange("H") = %d, %d, %t`, s, e, ok)
+	}
+	if tp, ok := mpcformat.ExportFieldTerp("NObs"); !ok ||
+		tp != mpcformat.ExTerpInt {
+		t.Fatalf(`ExportFieldTerp("NObs") = %d, %t`, tp, ok)
+	}
+	if _, _, ok := mpcformat.ExportFieldRange("Bogus"); ok {
+		t.Fatal(`ExportFieldRange("Bogus") ok`)
+	}
+}
+
+func TestWithStringCallback(t *testing.T) {
+	var o struct {
+		Desig       string
+		Designation string
+		H           float64
+	}
+	got := map[string]string{}
+	f, err := mpcformat.NewExportUnmarshaler(&o,
+		mpcformat.WithStringCallback(func(name string, b []byte) {
+			got[name] = string(b)
+		}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = f([]byte(ceres)); err != nil {
+		t.Fatal(err)
+	}
+	if o.Desig != "" || o.Designation != "" || o.H != 3.34 {
+		t.Fatalf("struct = %+v", o)
+	}
+	if got["Desig"] != "00001  " ||
+		got["Designation"] != "     (1) Ceres              " {
+		t.Fatalf("callback got %q", got)
+	}
+}
+
+func TestWithSkipBadFields(t *testing.T) {
+	var o struct {
+		Desig string
+		H     float64
+		RMS   float64
+		NObs  int
+	}
+	badRMS := ceres[:137] + "x.xx" + ceres[141:]
+	var skipped []mpcformat.ExportLineError
+	f, err := mpcformat.NewExportUnmarshaler(&o,
+		mpcformat.WithSkipBadFields(true),
+		mpcformat.WithFieldErrorCallback(func(e mpcformat.ExportLineError) {
+			skipped = append(skipped, e)
+		}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	o.RMS = 1
+	if err = f([]byte(badRMS)); err != nil {
+		t.Fatal(err)
+	}
+	if o.Desig != "00001" || o.H != 3.34 || o.RMS != 0 || o.NObs != 6689 {
+		t.Fatalf("struct = %+v", o)
+	}
+	if len(skipped) != 1 || skipped[0].Field != "RMS" ||
+		!errors.Is(skipped[0], mpcformat.ErrInvalidField) {
+		t.Fatalf("skipped = %v", skipped)
+	}
+	// a defNaN field gets NaN
+	var n struct {
+		Desig string
+		RMS   float64 `val:"defNaN"`
+	}
+	skipped = nil
+	fn, err := mpcformat.NewExportUnmarshaler(&n,
+		mpcformat.WithSkipBadFields(true),
+		mpcformat.WithFieldErrorCallback(func(e mpcformat.ExportLineError) {
+			skipped = append(skipped, e)
+		}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	n.RMS = 1
+	if err = fn([]byte(badRMS)); err != nil {
+		t.Fatal(err)
+	}
+	if !math.IsNaN(n.RMS) || len(skipped) != 0 {
+		t.Fatalf("defNaN RMS = %g, skipped %v", n.RMS, skipped)
+	}
+	// without the option the line is an error
+	if f, err = mpcformat.NewExportUnmarshaler(&o); err != nil {
+		t.Fatal(err)
+	}
+	if err = f([]byte(badRMS)); err == nil {
+		t.Fatal("no error without WithSkipBadFields")
+	}
+}
+
+func TestExportTruncated(t *testing.T) {
+	var o mpcformat.ExportOrbit
+	f, err := mpcformat.NewExportUnmarshaler(&o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		n     int
+		field string // of truncation error, "" for no error
+	}{
+		{105, "NObs"},
+		{130, "YFirst"},
+		{166, ""},
+		{180, ""},
+	} {
+		err := f([]byte(ceres[:tc.n]))
+		var le mpcformat.ExportLineError
+		switch {
+		case tc.field == "":
+			if err != nil {
+				t.Errorf("%d bytes: %v", tc.n, err)
+			}
+		case !errors.As(err, &le) || !le.Truncated || le.Field != tc.field:
+			t.Errorf("%d bytes: err = %v, want truncated %s", tc.n, err,
+				tc.field)
+		}
+	}
+	if o.NObs != 6689 || o.LastObs != "" || o.Designation != "(1) Ceres" {
+		t.Fatalf("180 bytes: %+v", o)
+	}
+	// defNaN fields default
+	var p struct {
+		A   float64
+		RMS float64 `val:"defNaN"`
+		U   string
+	}
+	if f, err = mpcformat.NewExportUnmarshaler(&p); err != nil {
+		t.Fatal(err)
+	}
+	if err = f([]byte(ceres[:105])); err != nil {
+		t.Fatal(err)
+	}
+	if p.A != 2.7670463 || !math.IsNaN(p.RMS) || p.U != "" {
+		t.Fatalf("105 bytes: %+v", p)
+	}
+	// truncated line is a line error, not a header
+	var orbits []mpcformat.ExportOrbit
+	err = mpcformat.UnmarshalExportAll(
+		strings.NewReader(ceres[:130]+"\n"+oneOpp+"\n"), &orbits)
+	var le mpcformat.ExportLineError
+	if pe, ok := err.(mpcformat.ExportLineErrors); !ok || len(orbits) != 1 ||
+		!errors.As(pe.PartialErrors()[0], &le) || le.Line != 1 || !le.Truncated {
+		t.Fatalf("UnmarshalExportAll: %d orbits, err %v", len(orbits), err)
+	}
+	// even when shorter than the orbital elements
+	orbits = nil
+	err = mpcformat.UnmarshalExportAll(
+		strings.NewReader(ceres[:60]+"\n"+oneOpp+"\n"), &orbits)
+	if pe, ok := err.(mpcformat.ExportLineErrors); !ok || len(orbits) != 1 ||
+		!errors.As(pe.PartialErrors()[0], &le) || le.Line != 1 || !le.Truncated {
+		t.Fatalf("UnmarshalExportAll 60 bytes: %d orbits, err %v", len(orbits), err)
+	}
+	err = mpcformat.FilterExportScan(strings.NewReader(ceres[:60]+"\n"), &o,
+		func(mpcformat.ExportOrbit) bool { return true },
+		func() error { return nil })
+	if !errors.As(err, &le) || !le.Truncated {
+		t.Fatalf("FilterExportScan 60 bytes: err %v, want truncated", err)
+	}
+}
+
+// benchExportLines is a representative number of MPCORB lines.
+const benchExportLines = 100000
+
+// benchExportData returns n export lines with varied designations and
+// element values, numbered orbits alternating with one-opposition orbits.
+func benchExportData(b *testing.B, n int) [][]byte {
+	lines := make([][]byte, n)
+	for j := range lines {
+		var line []byte
+		if j%2 == 0 {
+			d, err := mpcformat.PackNumber(j/2 + 1)
+			if err != nil {
+				b.Fatal(err)
+			}
+			line = withDesig(ceres, d)
+		} else {
+			line = withDesig(oneOpp, fmt.Sprintf("K18E%02dZ", j%100))
+		}
+		copy(line[8:13], fmt.Sprintf("%5.2f", 10+float64(j%1500)/100))
+		copy(line[26:35], fmt.Sprintf("%9.5f", math.Mod(float64(j)*.37, 360)))
+		copy(line[59:68], fmt.Sprintf("%9.5f", float64(j%3000)/100))
+		copy(line[70:79], fmt.Sprintf("%9.7f", float64(j%9000)/10000))
+		lines[j] = line
+	}
+	return lines
+}
+
+func BenchmarkExportUnmarshal(b *testing.B) {
+	lines := benchExportData(b, benchExportLines)
+	b.Run("cached", func(b *testing.B) {
+		b.ReportAllocs()
+		var o mpcformat.ExportOrbit
+		f, err := mpcformat.NewExportUnmarshaler(&o)
+		if err != nil {
+			b.Fatal(err)
+		}
+		for i := 0; i < b.N; i++ {
+			for j := 0; j < benchExportLines; j++ {
+				if err := f(lines[j]); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	})
+	b.Run("perLine", func(b *testing.B) {
+		b.ReportAllocs()
+		var o mpcformat.ExportOrbit
+		for i := 0; i < b.N; i++ {
+			for j := 0; j < benchExportLines; j++ {
+				f, err := mpcformat.NewExportUnmarshaler(&o)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if err := f(lines[j]); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	})
+}
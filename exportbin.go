@@ -0,0 +1,159 @@
+// Public domain.
+
+package mpcformat
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"strings"
+)
+
+// Binary format for ExportOrbit, intended as a cache of parsed MPCORB.DAT
+// data.
+//
+// A file begins with a 5 byte header: the 4 byte magic number "MPCX"
+// followed by a version byte, currently 1.  Following the header are
+// fixed-size records of exBinRecLen (176) bytes, one per orbit, to the end
+// of the file.  All numbers are little-endian.  Record layout, with byte
+// offsets:
+//
+//   0  Desig        7 bytes, text, NUL padded
+//   7  Epoch        5 bytes, text, NUL padded
+//  12  U            1 byte, text, NUL padded
+//  13  Ref          9 bytes, text, NUL padded
+//  22  Comp        10 bytes, text, NUL padded
+//  32  Designation 28 bytes, text, NUL padded
+//  60  LastObs      8 bytes, text, NUL padded
+//  68  H, G, MA, Peri, Node, Inc, E, M, A, RMS   IEEE 754 float64 each
+// 148  NObs, NOpp, YFirst, YLast, Arc, Type      int32 each
+// 172  flags        1 byte, bit 0 = NEO, bit 1 = PHA
+// 173  (unused)     3 bytes, zero
+
+const (
+	exBinMagic   = "MPCX"
+	exBinVersion = 1
+	exBinRecLen  = 176
+)
+
+var exBinStrs = []struct{ off, len int }{
+	{0, 7}, {7, 5}, {12, 1}, {13, 9}, {22, 10}, {32, 28}, {60, 8},
+}
+
+// WriteExportBinary writes orbits in the binary format described in the
+// source file exportbin.go.
+func WriteExportBinary(w io.Writer, orbits []ExportOrbit) error {
+	if _, err := w.Write(append([]byte(exBinMagic), exBinVersion)); err != nil {
+		return err
+	}
+	var rec [exBinRecLen]byte
+	le := binary.LittleEndian
+	for i := range orbits {
+		o := &orbits[i]
+		rec = [exBinRecLen]byte{}
+		for j, s := range []string{string(o.Desig), o.Epoch, o.U, o.Ref, o.Comp,
+			o.Designation, o.LastObs} {
+			f := exBinStrs[j]
+			if len(s) > f.len {
+				return fmt.Errorf("orbit %d: field too long for binary format: %q",
+					i, s)
+			}
+			copy(rec[f.off:f.off+f.len], s)
+		}
+		for j, x := range []float64{o.H, o.G, o.MA, o.Peri, o.Node, o.Inc,
+			o.E, o.M, o.A, o.RMS} {
+			le.PutUint64(rec[68+8*j:], math.Float64bits(x))
+		}
+		for j, n := range []int{o.NObs, o.NOpp, o.YFirst, o.YLast, o.Arc,
+			o.Type} {
+			le.PutUint32(rec[148+4*j:], uint32(int32(n)))
+		}
+		if o.NEO {
+			rec[172] |= 1
+		}
+		if o.PHA {
+			rec[172] |= 2
+		}
+		if _, err := w.Write(rec[:]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReadExportBinary reads orbits written by WriteExportBinary.
+//
+// An error is returned if the header does not match the magic number and
+// version written by this package, as would be the case for a stale cache.
+func ReadExportBinary(r io.Reader) ([]ExportOrbit, error) {
+	var hdr [len(exBinMagic) + 1]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return nil, err
+	}
+	if string(hdr[:len(exBinMagic)]) != exBinMagic {
+		return nil, errors.New("not an export binary file")
+	}
+	if v := hdr[len(exBinMagic)]; v != exBinVersion {
+		return nil, fmt.Errorf("export binary version %d, want %d",
+			v, exBinVersion)
+	}
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(data)%exBinRecLen != 0 {
+		return nil, io.ErrUnexpectedEOF
+	}
+	le := binary.LittleEndian
+	orbits := make([]ExportOrbit, len(data)/exBinRecLen)
+	for i := range orbits {
+		rec := data[i*exBinRecLen : (i+1)*exBinRecLen]
+		// a single string allocation per record, fields are sliced from it.
+		txt := string(rec[:68])
+		str := func(j int) string {
+			f := exBinStrs[j]
+			s := txt[f.off : f.off+f.len]
+			if n := strings.IndexByte(s, 0); n >= 0 {
+				s = s[:n]
+			}
+			return s
+		}
+		flt := func(j int) float64 {
+			return math.Float64frombits(le.Uint64(rec[68+8*j:]))
+		}
+		num := func(j int) int {
+			return int(int32(le.Uint32(rec[148+4*j:])))
+		}
+		orbits[i] = ExportOrbit{
+			Desig:       PackedDesig(str(0)),
+			Epoch:       str(1),
+			U:           str(2),
+			Ref:         str(3),
+			Comp:        str(4),
+			Designation: str(5),
+			LastObs:     str(6),
+			H:           flt(0),
+			G:           flt(1),
+			MA:          flt(2),
+			Peri:        flt(3),
+			Node:        flt(4),
+			Inc:         flt(5),
+			E:           flt(6),
+			M:           flt(7),
+			A:           flt(8),
+			RMS:         flt(9),
+			NObs:        num(0),
+			NOpp:        num(1),
+			YFirst:      num(2),
+			YLast:       num(3),
+			Arc:         num(4),
+			Type:        num(5),
+			NEO:         rec[172]&1 != 0,
+			PHA:         rec[172]&2 != 0,
+		}
+	}
+	return orbits, nil
+}
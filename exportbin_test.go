@@ -0,0 +1,102 @@
+// Public domain.
+
+package mpcformat_test
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/soniakeys/mpcformat"
+)
+
+// an Apollo PHA, with flags set
+var apollo = func() string {
+	b := withDesig(oneOpp, "K18E05Z")
+	copy(b[161:165], "8803")
+	return string(b)
+}()
+
+func unmarshalOrbits(t testing.TB, lines ...string) []mpcformat.ExportOrbit {
+	var o mpcformat.ExportOrbit
+	f, err := mpcformat.NewExportUnmarshaler(&o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	orbits := make([]mpcformat.ExportOrbit, len(lines))
+	for i, line := range lines {
+		if err := f([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+		orbits[i] = o
+	}
+	return orbits
+}
+
+func TestExportBinary(t *testing.T) {
+	orbits := unmarshalOrbits(t, ceres, oneOpp, apollo)
+	if o := orbits[2]; o.Type != mpcformat.ExApollo {
+		t.Fatalf("apollo Type = %d", o.Type)
+	}
+	var b bytes.Buffer
+	if err := mpcformat.WriteExportBinary(&b, orbits); err != nil {
+		t.Fatal(err)
+	}
+	enc := b.Bytes()
+	got, err := mpcformat.ReadExportBinary(bytes.NewReader(enc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, orbits) {
+		t.Fatalf("ReadExportBinary = %+v, want %+v", got, orbits)
+	}
+	// stale version
+	enc[4]++
+	if _, err = mpcformat.ReadExportBinary(bytes.NewReader(enc)); err == nil {
+		t.Fatal("ReadExportBinary accepted wrong version")
+	}
+	// truncated record
+	enc[4]--
+	if _, err = mpcformat.ReadExportBinary(bytes.NewReader(enc[:len(enc)-1])); err == nil {
+		t.Fatal("ReadExportBinary accepted truncated record")
+	}
+}
+
+// about the number of orbits in MPCORB
+const benchOrbits = 600000
+
+func BenchmarkExportText(b *testing.B) {
+	var o mpcformat.ExportOrbit
+	f, err := mpcformat.NewExportUnmarshaler(&o)
+	if err != nil {
+		b.Fatal(err)
+	}
+	line := []byte(ceres)
+	for i := 0; i < b.N; i++ {
+		orbits := make([]mpcformat.ExportOrbit, 0, benchOrbits)
+		for j := 0; j < benchOrbits; j++ {
+			if err := f(line); err != nil {
+				b.Fatal(err)
+			}
+			orbits = append(orbits, o)
+		}
+	}
+}
+
+func BenchmarkExportBinary(b *testing.B) {
+	orbits := unmarshalOrbits(b, ceres)
+	for len(orbits) < benchOrbits {
+		orbits = append(orbits, orbits[0])
+	}
+	var buf bytes.Buffer
+	if err := mpcformat.WriteExportBinary(&buf, orbits); err != nil {
+		b.Fatal(err)
+	}
+	enc := buf.Bytes()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := mpcformat.ReadExportBinary(bytes.NewReader(enc)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
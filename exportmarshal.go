@@ -0,0 +1,283 @@
+// Public domain.
+
+package mpcformat
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Marshaller for MPC export format, the inverse of the unmarshaller of
+// export.go.  Struct fields and tags are interpreted as by
+// NewExportUnmarshaler.  Fields are formatted right justified if numeric,
+// left justified otherwise, and columns not covered by a struct field are
+// left blank.
+
+// exportPrec is the number of decimal places written for float tFields.
+// Fewer are written if the value does not otherwise fit.
+var exportPrec = map[string]int{
+	"H": 2, "G": 2, "MA": 5, "Peri": 5, "Node": 5, "Inc": 5,
+	"E": 7, "M": 8, "A": 7, "RMS": 2,
+}
+
+// marshalState holds values of tFields shared by multiple sFields.
+type marshalState struct {
+	flags    uint64 // the Type tField
+	hasFlags bool
+}
+
+type fieldFmt func(line []byte, st *marshalState) error
+
+// ExportMarshalStream writes orbits to w in export format.
+//
+// The argument v specifies the struct as for NewExportUnmarshaler.  Fn is
+// called repeatedly until it returns false.  After each call that returns
+// true, the current contents of v are marshaled and written as a line of
+// text format.
+//
+// An error is returned if v is not a valid struct or if a field value does
+// not fit its columns.
+func ExportMarshalStream(w io.Writer, v interface{}, fn func() bool) error {
+	m, err := newExportMarshaler(v)
+	if err != nil {
+		return fmt.Errorf("ExportMarshalStream: %v", err)
+	}
+	for fn() {
+		line, err := m()
+		if err != nil {
+			return err
+		}
+		if _, err = w.Write(line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// newExportMarshaler returns a function that marshals struct v as a line of
+// text format, including the newline.  The line is reused across calls.
+func newExportMarshaler(v interface{}) (func() ([]byte, error), error) {
+	if v == nil {
+		return nil, errors.New("pointer to struct required")
+	}
+	vp := reflect.ValueOf(v)
+	if vp.Kind() != reflect.Ptr || vp.Elem().Kind() != reflect.Struct {
+		return nil, errors.New("pointer to struct required")
+	}
+	ve := vp.Elem()
+	vt := ve.Type()
+	var fmts []fieldFmt
+	for i := 0; i < ve.NumField(); i++ {
+		fv := ve.Field(i)
+		sf := vt.Field(i)
+		tfName, dd, err := exportTField(&sf)
+		if err != nil {
+			return nil, err
+		}
+		if tfName == "" {
+			continue
+		}
+		switch fv.Kind() {
+		case reflect.String:
+			fmts = append(fmts, strFmt(fv, dd, tfName))
+			continue
+		case reflect.Int,
+			reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint,
+			reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			if dd.terp != terpInt && tfName != "Desig" {
+				break
+			}
+			fmts = append(fmts, intFmt(fv, dd, tfName))
+			continue
+		case reflect.Float32, reflect.Float64:
+			if dd.terp != terpFloat && dd.terp != terpInt {
+				break
+			}
+			f, err := floatFmt(fv, dd, tfName, &sf)
+			if err != nil {
+				return nil, err
+			}
+			fmts = append(fmts, f)
+			continue
+		case reflect.Bool:
+			if dd.terp != terpBool {
+				break
+			}
+			fmts = append(fmts, boolFmt(fv, dd, tfName))
+			continue
+		}
+		return nil, errors.New("invald type for field: " + sf.Name)
+	}
+	line := make([]byte, exportLineLen+1)
+	line[exportLineLen] = '\n'
+	return func() ([]byte, error) {
+		for i := range line[:exportLineLen] {
+			line[i] = ' '
+		}
+		var st marshalState
+		for _, f := range fmts {
+			if err := f(line, &st); err != nil {
+				return nil, err
+			}
+		}
+		if st.hasFlags {
+			dd := tFieldMap["Type"]
+			putField(line, dd, "Type", fmt.Sprintf("%04x", st.flags), true)
+		}
+		return line, nil
+	}, nil
+}
+
+// putField writes s to the columns of dd, right justified if right is true.
+func putField(line []byte, dd decodeData, name, s string, right bool) error {
+	w := dd.end - dd.start
+	if len(s) > w {
+		return fmt.Errorf("ExportMarshalStream: Invalid %s (%s)", name, s)
+	}
+	if right {
+		copy(line[dd.end-len(s):dd.end], s)
+	} else {
+		copy(line[dd.start:], s)
+	}
+	return nil
+}
+
+// plEphCodes maps PlEph strings, as expanded by the unmarshaller, back to
+// system descriptors.
+var plEphCodes = map[string]string{
+	"JPL DE200": "d", "JPL DE245": "f", "JPL DE403": "h", "JPL DE405": "j",
+}
+
+func strFmt(fv reflect.Value, dd decodeData, tfName string) fieldFmt {
+	right := dd.terp == terpInt || dd.terp == terpFloat
+	return func(line []byte, _ *marshalState) error {
+		s := fv.String()
+		if tfName == "PlEph" && s != "" {
+			c, ok := plEphCodes[s]
+			if !ok {
+				return fmt.Errorf("ExportMarshalStream: Invalid PlEph (%s)", s)
+			}
+			s = c
+		}
+		if tfName == "Designation" && len(s) <= dd.end-dd.start-5 {
+			// MPCORB.DAT indents the readable designation by 5 columns
+			s = "     " + s
+		}
+		return putField(line, dd, tfName, s, right)
+	}
+}
+
+func intFmt(fv reflect.Value, dd decodeData, tfName string) fieldFmt {
+	get := func() int64 {
+		if fv.Kind() >= reflect.Uint && fv.Kind() <= reflect.Uint64 {
+			return int64(fv.Uint())
+		}
+		return fv.Int()
+	}
+	switch tfName {
+	case "Num", "Desig":
+		return func(line []byte, _ *marshalState) error {
+			p, err := NewPackedFromNumber(int(get()))
+			if err != nil {
+				return fmt.Errorf("ExportMarshalStream: Invalid %s (%d)",
+					tfName, get())
+			}
+			return putField(line, dd, tfName, string(p), false)
+		}
+	case "Type":
+		return func(line []byte, st *marshalState) error {
+			st.flags |= uint64(get()) & 0x3f
+			st.hasFlags = true
+			return nil
+		}
+	case "Precise":
+		return func(line []byte, _ *marshalState) error {
+			return putField(line, dd, tfName, fmt.Sprintf("%02x", get()), true)
+		}
+	case "YFirst", "YLast", "Arc":
+		// only one of years or arc length is meaningful, the other is zero.
+		return func(line []byte, _ *marshalState) error {
+			i := get()
+			if i == 0 {
+				return nil
+			}
+			if tfName == "Arc" {
+				copy(line[dd.end:], " days")
+			} else {
+				line[131] = '-'
+			}
+			return putField(line, dd, tfName, strconv.FormatInt(i, 10), true)
+		}
+	}
+	return func(line []byte, _ *marshalState) error {
+		return putField(line, dd, tfName, strconv.FormatInt(get(), 10), true)
+	}
+}
+
+func floatFmt(fv reflect.Value, dd decodeData, tfName string,
+	sf *reflect.StructField) (fieldFmt, error) {
+	cf := 1.
+	for _, tag := range strings.Split(sf.Tag.Get("val"), ",") {
+		switch tag {
+		case "", "deg", "defNaN":
+		case "rad":
+			cf = 180 / math.Pi
+		default:
+			return nil, newParseError(ErrInvalidField, tag, -1,
+				"invalid tag: %s field: %s", tag, sf.Name)
+		}
+	}
+	w := dd.end - dd.start
+	return func(line []byte, _ *marshalState) error {
+		z := fv.Float() * cf
+		if math.IsNaN(z) {
+			return nil // blank
+		}
+		prec := exportPrec[tfName]
+		s := strconv.FormatFloat(z, 'f', prec, 64)
+		for len(s) > w && prec > 0 {
+			prec--
+			s = strconv.FormatFloat(z, 'f', prec, 64)
+		}
+		return putField(line, dd, tfName, s, true)
+	}, nil
+}
+
+func boolFmt(fv reflect.Value, dd decodeData, tfName string) fieldFmt {
+	var bit uint64
+	switch tfName {
+	case "EAsm", "DD":
+		c := tfName[0]
+		return func(line []byte, _ *marshalState) error {
+			if fv.Bool() {
+				line[dd.start] = c
+			}
+			return nil
+		}
+	case "NEO":
+		bit = 1 << 11
+	case "Km":
+		bit = 1 << 12
+	case "Seen":
+		bit = 1 << 13
+	case "Crit":
+		bit = 1 << 14
+	case "PHA":
+		bit = 1 << 15
+	default:
+		panic("boolFmt missing case")
+	}
+	return func(line []byte, st *marshalState) error {
+		if fv.Bool() {
+			st.flags |= bit
+		}
+		st.hasFlags = true
+		return nil
+	}
+}
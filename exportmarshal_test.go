@@ -0,0 +1,77 @@
+// Public domain.
+
+package mpcformat_test
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/soniakeys/mpcformat"
+)
+
+func TestExportMarshalStream(t *testing.T) {
+	// all fields of ceres
+	var o struct {
+		Desig                  string
+		H, G                   float64 `val:"defNaN"`
+		Epoch                  string
+		MA, Peri, Node, Inc, E float64
+		M, A                   float64
+		U, Ref                 string
+		NObs, NOpp             int
+		YFirst, YLast          int
+		RMS                    float64
+		Coarse                 string
+		Precise                int
+		PlEph, Comp            string
+		Type                   int
+		NEO, Km, Seen          bool
+		Crit, PHA              bool
+		Designation, LastObs   string
+	}
+	u, err := mpcformat.NewExportUnmarshaler(&o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = u([]byte(ceres)); err != nil {
+		t.Fatal(err)
+	}
+	var b bytes.Buffer
+	n := 0
+	err = mpcformat.ExportMarshalStream(&b, &o, func() bool { n++; return n < 3 })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := ceres + "\n" + ceres + "\n"; b.String() != want {
+		t.Fatalf("ExportMarshalStream wrote\n%s\nwant\n%s", b.String(), want)
+	}
+
+	// round trip of ExportOrbit
+	orbits := unmarshalOrbits(t, ceres, oneOpp, apollo)
+	var x mpcformat.ExportOrbit
+	b.Reset()
+	n = 0
+	err = mpcformat.ExportMarshalStream(&b, &x, func() bool {
+		if n == len(orbits) {
+			return false
+		}
+		x = orbits[n]
+		n++
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(b.String(), "\n"), "\n")
+	if got := unmarshalOrbits(t, lines...); !reflect.DeepEqual(got, orbits) {
+		t.Fatalf("round trip\n%+v\nwant\n%+v", got, orbits)
+	}
+
+	x.NObs = 123456
+	if err = mpcformat.ExportMarshalStream(&b, &x,
+		func() bool { n--; return n >= 0 }); err == nil {
+		t.Fatal("ExportMarshalStream accepted NObs 123456")
+	}
+}
@@ -0,0 +1,329 @@
+// Public domain.
+
+package mpcformat
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"sync"
+)
+
+// ExportDiffEpsilon holds tolerances for float fields compared by
+// ExportOrbitChanged, keyed by ExportOrbit field name.  Fields not in the
+// map are compared exactly.
+//
+// For example, to ignore noise-level changes in RMS:
+//
+//	eps := mpcformat.ExportDiffEpsilon{"A": 1e-6, "RMS": .01}
+type ExportDiffEpsilon map[string]float64
+
+// ExportFieldChange records a changed field of an ExportOrbit.
+type ExportFieldChange struct {
+	Field         string      // ExportOrbit field name
+	Before, After interface{} // field values
+}
+
+// ExportOrbitDiff lists the fields that differ between two ExportOrbits,
+// in struct field order.  An empty list means no change.
+type ExportOrbitDiff []ExportFieldChange
+
+// ExportOrbitChanged compares orbits a and b, returning the fields that
+// differ.
+//
+// Float fields are compared using tolerances in eps, which may be nil.
+// NaN compares equal to NaN.
+func ExportOrbitChanged(a, b ExportOrbit,
+	eps ExportDiffEpsilon) ExportOrbitDiff {
+	var d ExportOrbitDiff
+	va := reflect.ValueOf(a)
+	vb := reflect.ValueOf(b)
+	vt := va.Type()
+	for i := 0; i < va.NumField(); i++ {
+		fa := va.Field(i)
+		fb := vb.Field(i)
+		name := vt.Field(i).Name
+		if fa.Kind() == reflect.Float64 {
+			x, y := fa.Float(), fb.Float()
+			if math.IsNaN(x) && math.IsNaN(y) ||
+				math.Abs(x-y) <= eps[name] {
+				continue
+			}
+		} else if fa.Interface() == fb.Interface() {
+			continue
+		}
+		d = append(d, ExportFieldChange{name, fa.Interface(), fb.Interface()})
+	}
+	return d
+}
+
+// ExportStats accumulates summary statistics over a batch of orbits.
+//
+// Create with NewExportStats.  Accumulate may be called concurrently from
+// multiple goroutines, but fields should only be read after all calls
+// to Accumulate have returned.
+type ExportStats struct {
+	Count    int
+	NeoCount int
+	PhaCount int
+	HMin     float64 // H statistics exclude orbits with H NaN.
+	HMax     float64
+	HMean    float64
+	EMax     float64
+	AMax     float64
+
+	mu   sync.Mutex
+	hSum float64
+	hN   int
+}
+
+// NewExportStats returns an ExportStats ready to accumulate orbits.
+func NewExportStats() *ExportStats {
+	return &ExportStats{
+		HMin:  math.Inf(1),
+		HMax:  math.Inf(-1),
+		HMean: math.NaN(),
+	}
+}
+
+// Accumulate adds orbit o to the statistics.
+func (s *ExportStats) Accumulate(o ExportOrbit) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Count++
+	if o.NEO {
+		s.NeoCount++
+	}
+	if o.PHA {
+		s.PhaCount++
+	}
+	if !math.IsNaN(o.H) {
+		s.HMin = math.Min(s.HMin, o.H)
+		s.HMax = math.Max(s.HMax, o.H)
+		s.hSum += o.H
+		s.hN++
+		s.HMean = s.hSum / float64(s.hN)
+	}
+	s.EMax = math.Max(s.EMax, o.E)
+	s.AMax = math.Max(s.AMax, o.A)
+}
+
+// String returns a one line summary.
+func (s *ExportStats) String() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return fmt.Sprintf("%d orbits, %d NEO, %d PHA, H %.2f-%.2f mean %.2f, "+
+		"max e %.4f, max a %.4f", s.Count, s.NeoCount, s.PhaCount,
+		s.HMin, s.HMax, s.HMean, s.EMax, s.AMax)
+}
+
+// ExportFilter selects orbits, returning true for orbits to keep.
+type ExportFilter func(ExportOrbit) bool
+
+// ExIsNEO is an ExportFilter selecting NEOs.
+func ExIsNEO(o ExportOrbit) bool { return o.NEO }
+
+// ExIsPHA is an ExportFilter selecting PHAs.
+func ExIsPHA(o ExportOrbit) bool { return o.PHA }
+
+// ExIsOrbitType returns an ExportFilter selecting orbits of type t,
+// one of the export format orbit type constants such as ExTrojan.
+func ExIsOrbitType(t int) ExportFilter {
+	return func(o ExportOrbit) bool { return o.Type == t }
+}
+
+// ExAnd returns an ExportFilter selecting orbits selected by all filters.
+func ExAnd(filters ...ExportFilter) ExportFilter {
+	return func(o ExportOrbit) bool {
+		for _, f := range filters {
+			if !f(o) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// ExOr returns an ExportFilter selecting orbits selected by any filter.
+func ExOr(filters ...ExportFilter) ExportFilter {
+	return func(o ExportOrbit) bool {
+		for _, f := range filters {
+			if f(o) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// isExportHeader reports whether line is not an orbit, such as a line of
+// the header of MPCORB.DAT.  A line is an orbit if it begins with a packed
+// designation followed by a blank, as in the Desig field.  A truncated
+// orbit line is still an orbit, so that the unmarshaler reports it.
+func isExportHeader(line []byte) bool {
+	if len(line) > 7 {
+		if line[7] != ' ' {
+			return true
+		}
+		line = line[:7]
+	}
+	d := string(bytes.TrimSpace(line))
+	return DesigType(d) == DesigUnknown && !IsNEOCPDesig(d)
+}
+
+// FilterExportScan reads export format orbits from r, calling fn for
+// each orbit selected by filter.
+//
+// Argument v is a pointer to struct as for NewExportUnmarshaler.  When fn
+// is called, the selected orbit has been unmarshaled into v.  The filter
+// sees an ExportOrbit regardless of the type of v.  If v points to an
+// ExportOrbit or a struct with the same fields, each line is unmarshaled
+// once, otherwise lines are unmarshaled again into v when selected.
+//
+// Lines that do not begin with a packed designation, such as the header
+// of MPCORB.DAT, are quietly ignored.  Scanning stops at the first unmarshal error or error
+// returned by fn, and the error is returned.
+func FilterExportScan(r io.Reader, v interface{}, filter ExportFilter,
+	fn func() error) error {
+	uv, err := NewExportUnmarshaler(v)
+	if err != nil {
+		return err
+	}
+	uo := uv
+	twice := false
+	var orbit func() ExportOrbit
+	ot := reflect.TypeOf(ExportOrbit{})
+	switch ev := reflect.ValueOf(v).Elem(); {
+	case ev.Type() == ot:
+		o := v.(*ExportOrbit)
+		orbit = func() ExportOrbit { return *o }
+	case ev.Type().ConvertibleTo(ot):
+		orbit = func() ExportOrbit {
+			return ev.Convert(ot).Interface().(ExportOrbit)
+		}
+	default:
+		o := new(ExportOrbit)
+		if uo, err = NewExportUnmarshaler(o); err != nil {
+			return err
+		}
+		orbit = func() ExportOrbit { return *o }
+		twice = true
+	}
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		line := s.Bytes()
+		if isExportHeader(line) {
+			continue
+		}
+		if err = uo(line); err != nil {
+			return err
+		}
+		if !filter(orbit()) {
+			continue
+		}
+		if twice {
+			if err = uv(line); err != nil {
+				return err
+			}
+		}
+		if err = fn(); err != nil {
+			return err
+		}
+	}
+	return s.Err()
+}
+
+// ExportLineError is an error unmarshaling a line of export format data.
+type ExportLineError struct {
+	Line      int    // 1-based line number
+	Field     string // struct field name, for errors of a single field
+	Truncated bool   // line ends before the end of the field
+	Err       error
+}
+
+func (e ExportLineError) Error() string {
+	if e.Line == 0 {
+		return e.Err.Error()
+	}
+	return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+}
+
+// Unwrap returns Err.
+func (e ExportLineError) Unwrap() error { return e.Err }
+
+// ExportLineErrors is the error returned by UnmarshalExportAll for lines
+// that could not be unmarshaled.
+type ExportLineErrors []ExportLineError
+
+func (e ExportLineErrors) Error() string {
+	if len(e) == 1 {
+		return e[0].Error()
+	}
+	return fmt.Sprintf("%v (and %d more errors)", e[0], len(e)-1)
+}
+
+// PartialErrors returns the line errors as a slice of error.
+func (e ExportLineErrors) PartialErrors() []error {
+	errs := make([]error, len(e))
+	for i, le := range e {
+		errs[i] = le
+	}
+	return errs
+}
+
+// UnmarshalExportAll reads export format orbits from r, appending them to
+// the slice pointed to by slicePtr.
+//
+// The slice element type must be a struct as for NewExportUnmarshaler.
+// Lines that do not begin with a packed designation, such as the header
+// of MPCORB.DAT, are quietly ignored.  Lines that fail to unmarshal,
+// including truncated orbit lines, are skipped and returned as
+// ExportLineErrors after all lines are read.
+// Other errors are returned immediately.
+func UnmarshalExportAll(r io.Reader, slicePtr interface{}) error {
+	sp := reflect.ValueOf(slicePtr)
+	if sp.Kind() != reflect.Ptr || sp.Elem().Kind() != reflect.Slice {
+		return errors.New("UnmarshalExportAll: pointer to slice required")
+	}
+	sv := sp.Elem()
+	ev := reflect.New(sv.Type().Elem())
+	u, err := NewExportUnmarshaler(ev.Interface())
+	if err != nil {
+		return fmt.Errorf("UnmarshalExportAll: %v", err)
+	}
+	var lineErrs ExportLineErrors
+	s := bufio.NewScanner(r)
+	for n := 1; s.Scan(); n++ {
+		line := s.Bytes()
+		if isExportHeader(line) {
+			continue
+		}
+		if err = u(line); err != nil {
+			le, ok := err.(ExportLineError)
+			if !ok {
+				le = ExportLineError{Err: err}
+			}
+			le.Line = n
+			lineErrs = append(lineErrs, le)
+			continue
+		}
+		if l := sv.Len(); l == sv.Cap() {
+			grown := reflect.MakeSlice(sv.Type(), l, 2*l+1)
+			reflect.Copy(grown, sv)
+			sv.Set(grown)
+		}
+		sv.Set(sv.Slice(0, sv.Len()+1))
+		sv.Index(sv.Len() - 1).Set(ev.Elem())
+	}
+	if err = s.Err(); err != nil {
+		return err
+	}
+	if len(lineErrs) > 0 {
+		return lineErrs
+	}
+	return nil
+}
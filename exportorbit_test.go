@@ -0,0 +1,178 @@
+// Public domain.
+
+package mpcformat_test
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/soniakeys/mpcformat"
+)
+
+// mpcorbHeader is the header of MPCORB.DAT, abridged.
+const mpcorbHeader = `MINOR PLANET CENTER ORBIT DATABASE (MPCORB)
+
+This file contains published orbital elements for all numbered and unnumbered
+multi-opposition minor planets for which it is possible to make reasonable
+predictions.  It also includes published elements for recent one-opposition
+minor planets and is intended to be of use to those planning future follow-up
+observations.
+
+Des'n     H     G   Epoch     M        Peri.      Node       Incl.       e            n           a        Reference #Obs #Opp    Arc    rms  Perts   Computer
+
+----------------------------------------------------------------------------------------------------------------------------------------------------------------------------------------------------------
+`
+
+func TestExportOrbitChanged(t *testing.T) {
+	o := unmarshalOrbits(t, ceres)[0]
+	if d := mpcformat.ExportOrbitChanged(o, o, nil); len(d) != 0 {
+		t.Fatalf("same orbit diff = %v", d)
+	}
+	n := o
+	n.A += 1e-7
+	n.RMS += .001
+	n.NObs++
+	d := mpcformat.ExportOrbitChanged(o, n, nil)
+	if len(d) != 3 || d[0].Field != "A" || d[1].Field != "NObs" ||
+		d[2].Field != "RMS" {
+		t.Fatalf("diff = %v, want A, NObs, RMS", d)
+	}
+	if d[1].Before != o.NObs || d[1].After != n.NObs {
+		t.Fatalf("NObs change = %v, want %d -> %d", d[1], o.NObs, n.NObs)
+	}
+	eps := mpcformat.ExportDiffEpsilon{"A": 1e-6, "RMS": .01}
+	d = mpcformat.ExportOrbitChanged(o, n, eps)
+	if len(d) != 1 || d[0].Field != "NObs" {
+		t.Fatalf("diff with epsilon = %v, want NObs only", d)
+	}
+}
+
+func TestExportFlags(t *testing.T) {
+	var o struct {
+		Type                     int
+		NEO, Km, Seen, Crit, PHA bool
+	}
+	f, err := mpcformat.NewExportUnmarshaler(&o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// flag values as they appear in MPCORB.DAT
+	for _, tc := range []struct {
+		obj, flags               string
+		typ                      int
+		neo, km, seen, crit, pha bool
+	}{
+		{"(1) Ceres", "0000", 0, false, false, false, false, false},
+		{"(433) Eros", "1804", mpcformat.ExAmor,
+			true, true, false, false, false},
+		{"(1862) Apollo", "9803", mpcformat.ExApollo,
+			true, true, false, false, true},
+		{"(2062) Aten", "1802", mpcformat.ExAten,
+			true, true, false, false, false},
+		{"(434) Hungaria", "0006", mpcformat.ExHungaria,
+			false, false, false, false, false},
+		{"(624) Hektor", "0009", mpcformat.ExTrojan,
+			false, false, false, false, false},
+		{"(134340) Pluto", "000e", mpcformat.ExPlutino,
+			false, false, false, false, false},
+		{"one-opposition", "2000", 0, false, false, true, false, false},
+		{"critical list", "4000", 0, false, false, false, true, false},
+	} {
+		line := []byte(ceres)
+		copy(line[161:165], tc.flags)
+		if err := f(line); err != nil {
+			t.Fatalf("%s: %v", tc.obj, err)
+		}
+		if o.Type != tc.typ || o.NEO != tc.neo || o.Km != tc.km ||
+			o.Seen != tc.seen || o.Crit != tc.crit || o.PHA != tc.pha {
+			t.Fatalf("%s %s: got %+v", tc.obj, tc.flags, o)
+		}
+	}
+}
+
+func TestExportStats(t *testing.T) {
+	orbits := unmarshalOrbits(t, ceres, oneOpp, apollo)
+	s := mpcformat.NewExportStats()
+	var wg sync.WaitGroup
+	for _, o := range orbits {
+		wg.Add(1)
+		go func(o mpcformat.ExportOrbit) {
+			s.Accumulate(o)
+			wg.Done()
+		}(o)
+	}
+	wg.Wait()
+	const want = "3 orbits, 1 NEO, 1 PHA, H 3.34-22.10 mean 15.85, " +
+		"max e 0.2219, max a 2.7670"
+	if got := s.String(); got != want {
+		t.Fatalf("ExportStats = %q, want %q", got, want)
+	}
+}
+
+func TestFilterExportScan(t *testing.T) {
+	mpcorb := mpcorbHeader + ceres + "\n" + oneOpp + "\n" + apollo + "\n"
+	var o struct{ Desig, Designation string }
+	var got []string
+	f := mpcformat.ExOr(mpcformat.ExIsPHA, mpcformat.ExAnd(
+		mpcformat.ExIsOrbitType(0),
+		func(o mpcformat.ExportOrbit) bool { return o.H < 10 }))
+	err := mpcformat.FilterExportScan(strings.NewReader(mpcorb), &o, f,
+		func() error {
+			got = append(got, o.Desig)
+			return nil
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0] != "00001" || got[1] != "K18E05Z" {
+		t.Fatalf("FilterExportScan selected %q, want 00001, K18E05Z", got)
+	}
+	// a struct with the fields of ExportOrbit is unmarshaled once
+	type orbit mpcformat.ExportOrbit
+	var eo orbit
+	got = got[:0]
+	err = mpcformat.FilterExportScan(strings.NewReader(mpcorb), &eo,
+		mpcformat.ExIsNEO, func() error {
+			got = append(got, string(eo.Desig))
+			if !eo.PHA {
+				t.Errorf("%s: PHA = false", eo.Desig)
+			}
+			return nil
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0] != "K18E05Z" {
+		t.Fatalf("FilterExportScan selected %q, want K18E05Z", got)
+	}
+}
+
+func TestUnmarshalExportAll(t *testing.T) {
+	badH := ceres[:8] + "  x.xx" + ceres[14:]
+	mpcorb := mpcorbHeader + ceres + "\n" + badH + "\n" + oneOpp + "\n" +
+		apollo + "\n"
+	var orbits []struct {
+		Desig string
+		H     float64
+	}
+	err := mpcformat.UnmarshalExportAll(strings.NewReader(mpcorb), &orbits)
+	if len(orbits) != 3 || orbits[0].Desig != "00001" ||
+		orbits[1].H != 22.1 {
+		t.Fatalf("UnmarshalExportAll = %v", orbits)
+	}
+	var pe interface{ PartialErrors() []error }
+	if !errors.As(err, &pe) {
+		t.Fatalf("err = %v, want partial errors", err)
+	}
+	errs := pe.PartialErrors()
+	var le mpcformat.ExportLineError
+	if len(errs) != 1 || !errors.As(errs[0], &le) || le.Line != 13 {
+		t.Fatalf("PartialErrors = %v, want line 13 error", errs)
+	}
+	var o mpcformat.ExportOrbit
+	if err := mpcformat.UnmarshalExportAll(strings.NewReader(""), &o); err == nil {
+		t.Fatal("UnmarshalExportAll accepted non-slice")
+	}
+}
@@ -0,0 +1,119 @@
+// Public domain.
+
+package mpcformat
+
+import (
+	"math"
+
+	"github.com/soniakeys/astro"
+	"github.com/soniakeys/coord"
+	"github.com/soniakeys/observation"
+	"github.com/soniakeys/unit"
+)
+
+// WGS84 ellipsoid
+const (
+	wgs84A = 6378137           // equatorial radius, meters
+	wgs84F = 1 / 298.257223563 // flattening
+)
+
+// meters per AU, as used for parallax constants
+const auM = 149.59787e9
+
+// GeodeticToParallax computes parallax constants from WGS84 geodetic
+// coordinates.  Altitude is above the ellipsoid.
+//
+// The algorithm is from Meeus, Astronomical Algorithms, chapter 11.
+func GeodeticToParallax(latDeg, lonDeg, altM float64) *observation.ParallaxConst {
+	sφ, cφ := math.Sincos(latDeg * math.Pi / 180)
+	u := math.Atan((1 - wgs84F) * sφ / cφ)
+	su, cu := math.Sincos(u)
+	return &observation.ParallaxConst{
+		Longitude: unit.AngleFromDeg(lonDeg),
+		RhoCosPhi: (wgs84A*cu + altM*cφ) / auM,
+		RhoSinPhi: (wgs84A*(1-wgs84F)*su + altM*sφ) / auM,
+	}
+}
+
+// ParallaxToGeodetic computes WGS84 geodetic coordinates from parallax
+// constants, the inverse of GeodeticToParallax.
+//
+// Latitude is found by Bowring's method, iterated to convergence.
+// Longitude is returned in the range of pc.Longitude.  If pc is nil, as for
+// a space based observatory, all results are NaN.
+func ParallaxToGeodetic(pc *observation.ParallaxConst) (latDeg, lonDeg, altM float64) {
+	if pc == nil {
+		return math.NaN(), math.NaN(), math.NaN()
+	}
+	p := pc.RhoCosPhi * auM // distance from axis, m
+	z := pc.RhoSinPhi * auM // distance from equatorial plane, m
+	const (
+		b   = wgs84A * (1 - wgs84F)
+		e2  = wgs84F * (2 - wgs84F)
+		ep2 = e2 / (1 - e2)
+	)
+	// initial reduced latitude
+	β := math.Atan2(z*wgs84A, p*b)
+	var φ float64
+	for i := 0; i < 5; i++ {
+		sβ, cβ := math.Sincos(β)
+		φ = math.Atan2(z+ep2*b*sβ*sβ*sβ, p-e2*wgs84A*cβ*cβ*cβ)
+		β1 := math.Atan((1 - wgs84F) * math.Tan(φ))
+		if math.Abs(β1-β) < 1e-15 {
+			break
+		}
+		β = β1
+	}
+	sφ, cφ := math.Sincos(φ)
+	n := wgs84A / math.Sqrt(1-e2*sφ*sφ)
+	if math.Abs(cφ) > math.Abs(sφ) {
+		altM = p/cφ - n
+	} else {
+		altM = z/sφ - n*(1-e2)
+	}
+	return φ * 180 / math.Pi, pc.Longitude.Deg(), altM
+}
+
+// GSTFromMJD computes Greenwich sidereal time in radians, in the range
+// [0, 2π).
+//
+// It is the approximate sidereal time used by observation.EarthObserverVect.
+func GSTFromMJD(mjd float64) float64 {
+	return astro.Lst(mjd, 0).Angle().Rad()
+}
+
+// ParallaxToGeocentric computes the geocentric equatorial position in AU
+// of the observatory with parallax constants pc, at Greenwich sidereal time
+// gstRad.
+//
+// If pc is nil, as for a space based observatory, all components are NaN.
+func ParallaxToGeocentric(pc *observation.ParallaxConst, gstRad float64) coord.Cart {
+	if pc == nil {
+		return coord.Cart{X: math.NaN(), Y: math.NaN(), Z: math.NaN()}
+	}
+	s, c := math.Sincos(gstRad + pc.Longitude.Rad())
+	return coord.Cart{X: pc.RhoCosPhi * c, Y: pc.RhoCosPhi * s, Z: pc.RhoSinPhi}
+}
+
+// geodesicDistance returns the distance in meters between two points on
+// the WGS84 ellipsoid given by geodetic latitude and longitude in degrees.
+//
+// The algorithm is from Meeus, Astronomical Algorithms, chapter 11,
+// accurate to about 50 m.  Altitude is not considered.
+func geodesicDistance(lat1, lon1, lat2, lon2 float64) float64 {
+	const d2r = math.Pi / 180
+	sF, cF := math.Sincos((lat1 + lat2) / 2 * d2r)
+	sG, cG := math.Sincos((lat1 - lat2) / 2 * d2r)
+	sλ, cλ := math.Sincos((lon1 - lon2) / 2 * d2r)
+	s := sG*sG*cλ*cλ + cF*cF*sλ*sλ
+	c := cG*cG*cλ*cλ + sF*sF*sλ*sλ
+	if s == 0 {
+		return 0
+	}
+	ω := math.Atan(math.Sqrt(s / c))
+	r := math.Sqrt(s*c) / ω
+	d := 2 * ω * wgs84A
+	h1 := (3*r - 1) / (2 * c)
+	h2 := (3*r + 1) / (2 * s)
+	return d * (1 + wgs84F*h1*sF*sF*cG*cG - wgs84F*h2*cF*cF*sG*sG)
+}
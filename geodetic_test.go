@@ -0,0 +1,67 @@
+// Public domain.
+
+package mpcformat_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/soniakeys/mpcformat"
+	"github.com/soniakeys/observation"
+)
+
+func TestGeodetic(t *testing.T) {
+	for _, tc := range []struct{ lat, lon, alt float64 }{
+		{32.417, 248.904, 2525},
+		{-31.2733, 149.0644, 1165},
+		{0, 0, 0},
+		{89.9, 10, -50},
+		{-90, 0, 2835},
+	} {
+		pc := mpcformat.GeodeticToParallax(tc.lat, tc.lon, tc.alt)
+		lat, lon, alt := mpcformat.ParallaxToGeodetic(pc)
+		if math.Abs(lat-tc.lat) > 1e-9 || math.Abs(lon-tc.lon) > 1e-9 ||
+			math.Abs(alt-tc.alt) > 1e-3 {
+			t.Fatalf("ParallaxToGeodetic(GeodeticToParallax(%g, %g, %g)) = "+
+				"%g, %g, %g", tc.lat, tc.lon, tc.alt, lat, lon, alt)
+		}
+	}
+	if lat, _, _ := mpcformat.ParallaxToGeodetic(nil); !math.IsNaN(lat) {
+		t.Fatal("ParallaxToGeodetic(nil) not NaN")
+	}
+}
+
+func TestGeodesicDistance(t *testing.T) {
+	// Meeus example 11.c, Paris to Washington
+	m := map[string]mpcformat.ObscodeRecord{
+		"PAR": {Parallax: mpcformat.GeodeticToParallax(48.836389, 2.337222, 0)},
+		"WAS": {Parallax: mpcformat.GeodeticToParallax(38.921389, -77.065556, 0)},
+	}
+	km, err := mpcformat.ObscodeDistance(m, "PAR", "WAS")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(km-6181.63) > .01 {
+		t.Fatalf("Paris-Washington = %.2f km, want 6181.63", km)
+	}
+}
+
+func TestParallaxToGeocentric(t *testing.T) {
+	// GST at J2000.0 is 280.46 degrees
+	gst := mpcformat.GSTFromMJD(mpcformat.J2000MJD)
+	if math.Abs(gst*180/math.Pi-280.46) > .01 {
+		t.Fatalf("GSTFromMJD(J2000) = %g degrees", gst*180/math.Pi)
+	}
+	pc := mpcformat.GeodeticToParallax(32.417, 248.904, 2525)
+	for _, mjd := range []float64{51544.5, 53264.15206, 60000.9} {
+		got := mpcformat.ParallaxToGeocentric(pc, mpcformat.GSTFromMJD(mjd))
+		want := observation.EarthObserverVect(mjd, pc)
+		if math.Abs(got.X-want.X) > 1e-12 || math.Abs(got.Y-want.Y) > 1e-12 ||
+			got.Z != want.Z {
+			t.Errorf("ParallaxToGeocentric(%g) = %v, want %v", mjd, got, want)
+		}
+	}
+	if c := mpcformat.ParallaxToGeocentric(nil, 0); !math.IsNaN(c.X) {
+		t.Errorf("ParallaxToGeocentric(nil) = %v", c)
+	}
+}
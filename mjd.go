@@ -0,0 +1,69 @@
+// Public domain.
+
+package mpcformat
+
+import (
+	"math"
+	"time"
+)
+
+// MJDToCalendar converts mjd to a date of the proleptic Gregorian
+// calendar, the calendar of ParseObs80Date.  Day includes the fraction of
+// the day.
+//
+// The algorithm is from Meeus, Astronomical Algorithms, chapter 7.
+func MJDToCalendar(mjd float64) (year, month int, day float64) {
+	jd := mjd + 2400001 // JD + .5
+	z := math.Floor(jd)
+	f := jd - z
+	α := math.Floor((z - 1867216.25) / 36524.25)
+	a := z + 1 + α - math.Floor(α/4)
+	b := a + 1524
+	c := math.Floor((b - 122.1) / 365.25)
+	d := math.Floor(365.25 * c)
+	e := math.Floor((b - d) / 30.6001)
+	day = b - d - math.Floor(30.6001*e) + f
+	if month = int(e) - 1; month > 12 {
+		month -= 12
+	}
+	if year = int(c) - 4716; month <= 2 {
+		year++
+	}
+	return
+}
+
+// JDEpochMJD is the Julian date of MJD 0.
+const JDEpochMJD = 2400000.5
+
+// J2000MJD is the MJD of the epoch J2000.0, JD 2451545.0.
+const J2000MJD = 51544.5
+
+// JDToMJD converts a Julian date to MJD.
+func JDToMJD(jd float64) float64 { return jd - JDEpochMJD }
+
+// MJDToJD converts an MJD to Julian date.
+func MJDToJD(mjd float64) float64 { return mjd + JDEpochMJD }
+
+// J2000ToMJD converts days since J2000.0 to MJD.
+func J2000ToMJD(j2000 float64) float64 { return j2000 + J2000MJD }
+
+// MJDToJ2000 converts an MJD to days since J2000.0.
+func MJDToJ2000(mjd float64) float64 { return mjd - J2000MJD }
+
+// unixEpochMJD is the MJD of the Unix epoch, 1970-01-01.
+const unixEpochMJD = 40587
+
+// MJDToTime returns the UTC time of mjd, to the nearest nanosecond.
+func MJDToTime(mjd float64) time.Time {
+	d := mjd - unixEpochMJD
+	sec := math.Floor(d * 86400)
+	ns := math.Floor((d*86400-sec)*1e9 + .5)
+	return time.Unix(int64(sec), int64(ns)).UTC()
+}
+
+// TimeToMJD returns the MJD of t.
+func TimeToMJD(t time.Time) float64 {
+	t = t.UTC()
+	return unixEpochMJD + float64(t.Unix())/86400 +
+		float64(t.Nanosecond())/(86400*1e9)
+}
@@ -0,0 +1,65 @@
+// Public domain.
+
+package mpcformat_test
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/soniakeys/mpcformat"
+)
+
+func TestMJDToCalendar(t *testing.T) {
+	for _, tc := range []struct {
+		d    string
+		y, m int
+		day  float64
+	}{
+		{"1858 11 17.0", 1858, 11, 17},
+		{"2000 01 01.5", 2000, 1, 1.5},
+		{"2004 09 16.15206", 2004, 9, 16.15206},
+		{"1600 02 29.25", 1600, 2, 29.25},
+		{"2100 03 01.0", 2100, 3, 1},
+	} {
+		mjd, ok := mpcformat.ParseObs80Date(tc.d)
+		if !ok {
+			t.Fatal(tc.d)
+		}
+		y, m, day := mpcformat.MJDToCalendar(mjd)
+		if y != tc.y || m != tc.m || math.Abs(day-tc.day) > 1e-9 {
+			t.Errorf("MJDToCalendar(%g) = %d %d %g, want %s",
+				mjd, y, m, day, tc.d)
+		}
+	}
+}
+
+func TestMJDToTime(t *testing.T) {
+	tm := time.Date(2004, 9, 16, 3, 38, 57, 984000000, time.UTC)
+	mjd := mpcformat.TimeToMJD(tm)
+	if math.Abs(mjd-53264.15206) > 1e-9 {
+		t.Fatalf("TimeToMJD = %.9f", mjd)
+	}
+	if got := mpcformat.MJDToTime(mjd); got.Sub(tm).Abs() > time.Microsecond {
+		t.Fatalf("MJDToTime = %v, want %v", got, tm)
+	}
+	if got := mpcformat.MJDToTime(0); !got.Equal(
+		time.Date(1858, 11, 17, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("MJDToTime(0) = %v", got)
+	}
+}
+
+func TestJDToMJD(t *testing.T) {
+	if jd := mpcformat.MJDToJD(0); jd != 2400000.5 {
+		t.Fatalf("MJDToJD(0) = %g", jd)
+	}
+	if mjd := mpcformat.JDToMJD(2451545); mjd != 51544.5 {
+		t.Fatalf("JDToMJD(2451545) = %g", mjd)
+	}
+	if mjd := mpcformat.J2000ToMJD(0); mpcformat.MJDToJD(mjd) != 2451545 {
+		t.Fatalf("J2000ToMJD(0) = %g", mjd)
+	}
+	if d := mpcformat.MJDToJ2000(mpcformat.JDToMJD(2451546.5)); d != 1.5 {
+		t.Fatalf("MJDToJ2000 = %g", d)
+	}
+}
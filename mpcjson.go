@@ -0,0 +1,236 @@
+// Public domain.
+
+package mpcformat
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// MPCOrbitURL is the MPC web service endpoint queried by FetchOrbitByDesig.
+var MPCOrbitURL = "https://www.minorplanetcenter.net/web_service/search_orbits"
+
+// mpcJSONFieldMap maps field names of MPC web service orbit JSON to
+// tFieldMap names.
+var mpcJSONFieldMap = map[string]string{
+	"H":           "H",
+	"G":           "G",
+	"epoch":       "Epoch",
+	"M":           "MA",
+	"peri":        "Peri",
+	"node":        "Node",
+	"i":           "Inc",
+	"e":           "E",
+	"n":           "M",
+	"a":           "A",
+	"U":           "U",
+	"ref":         "Ref",
+	"num_obs":     "NObs",
+	"num_opps":    "NOpp",
+	"arc_length":  "Arc",
+	"rms":         "RMS",
+	"computer":    "Comp",
+	"orbit_type":  "Type",
+	"neo":         "NEO",
+	"pha":         "PHA",
+	"designation": "Designation",
+	"last_obs":    "LastObs",
+	"number":      "Desig",
+}
+
+// ParseMPCOrbitJSON decodes an orbit in the JSON format of the MPC web
+// service.
+//
+// The data may be a JSON object or an array of which the first object is
+// decoded.  Fields are mapped to ExportOrbit fields by the export format
+// names of mpcJSONFieldMap.  Numbers may be given as JSON numbers or
+// strings.  A numeric epoch is taken as a Julian date and converted to the
+// packed epoch of the export format, and a minor planet number is packed
+// with NewPackedFromNumber.  Fields H, G, and RMS are NaN if not
+// present; other missing fields are zero.  Unrecognized fields are ignored.
+func ParseMPCOrbitJSON(data []byte) (*ExportOrbit, error) {
+	var m map[string]interface{}
+	if err := json.Unmarshal(data, &m); err != nil {
+		var a []map[string]interface{}
+		if json.Unmarshal(data, &a) != nil {
+			return nil, fmt.Errorf("ParseMPCOrbitJSON: %v", err)
+		}
+		if len(a) == 0 {
+			return nil, errors.New("ParseMPCOrbitJSON: No orbit")
+		}
+		m = a[0]
+	}
+	o := newExportOrbitNaN()
+	v := reflect.ValueOf(o).Elem()
+	for k, jv := range m {
+		name, ok := mpcJSONFieldMap[k]
+		if !ok || jv == nil {
+			continue
+		}
+		if name == "Epoch" {
+			e, err := jsonEpoch(jv)
+			if err != nil {
+				return nil, fmt.Errorf("ParseMPCOrbitJSON: %v", err)
+			}
+			o.Epoch = e
+			continue
+		}
+		if name == "Desig" {
+			d, err := jsonNumberDesig(jv)
+			if err != nil {
+				return nil, fmt.Errorf("ParseMPCOrbitJSON: %v", err)
+			}
+			o.Desig = d
+			continue
+		}
+		if err := setJSONField(v.FieldByName(name), jv); err != nil {
+			return nil, fmt.Errorf("ParseMPCOrbitJSON: Invalid %s (%v)", k, jv)
+		}
+	}
+	return o, nil
+}
+
+// jsonNumberDesig returns the packed designation for a JSON minor planet
+// number.  A number, or a string of decimal digits, is packed with
+// NewPackedFromNumber.  Other strings are taken as already packed.
+func jsonNumberDesig(jv interface{}) (PackedDesig, error) {
+	var n int
+	switch x := jv.(type) {
+	case float64:
+		if x != math.Trunc(x) {
+			return "", fmt.Errorf("Invalid number (%v)", jv)
+		}
+		n = int(x)
+	case string:
+		x = strings.TrimSpace(x)
+		if strings.Trim(x, "0123456789") != "" {
+			return PackedDesig(x), nil
+		}
+		var err error
+		if n, err = strconv.Atoi(x); err != nil {
+			return "", fmt.Errorf("Invalid number (%v)", jv)
+		}
+	default:
+		return "", fmt.Errorf("Invalid number (%v)", jv)
+	}
+	d, err := NewPackedFromNumber(n)
+	if err != nil {
+		return "", fmt.Errorf("Invalid number (%v)", jv)
+	}
+	return d, nil
+}
+
+// newExportOrbitNaN returns an ExportOrbit with NaN in defNaN fields.
+func newExportOrbitNaN() *ExportOrbit {
+	o := &ExportOrbit{}
+	v := reflect.ValueOf(o).Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		if t.Field(i).Tag.Get("val") == "defNaN" {
+			v.Field(i).SetFloat(math.NaN())
+		}
+	}
+	return o
+}
+
+// setJSONField sets f from JSON value jv, converting strings to numbers
+// and bools as needed.
+func setJSONField(f reflect.Value, jv interface{}) error {
+	s, isStr := jv.(string)
+	switch f.Kind() {
+	case reflect.String:
+		if isStr {
+			f.SetString(s)
+		} else {
+			f.SetString(fmt.Sprint(jv))
+		}
+		return nil
+	case reflect.Float64:
+		switch x := jv.(type) {
+		case float64:
+			f.SetFloat(x)
+			return nil
+		case string:
+			x2, err := strconv.ParseFloat(strings.TrimSpace(x), 64)
+			f.SetFloat(x2)
+			return err
+		}
+	case reflect.Int:
+		switch x := jv.(type) {
+		case float64:
+			f.SetInt(int64(x))
+			return nil
+		case string:
+			x2, err := strconv.Atoi(strings.TrimSpace(x))
+			f.SetInt(int64(x2))
+			return err
+		}
+	case reflect.Bool:
+		switch x := jv.(type) {
+		case bool:
+			f.SetBool(x)
+			return nil
+		case float64:
+			f.SetBool(x != 0)
+			return nil
+		case string:
+			b, err := strconv.ParseBool(strings.TrimSpace(x))
+			f.SetBool(b)
+			return err
+		}
+	}
+	return errors.New("invalid type")
+}
+
+// jsonEpoch converts a JSON epoch, a Julian date or a packed epoch, to a
+// packed epoch.
+func jsonEpoch(jv interface{}) (string, error) {
+	var jd float64
+	switch x := jv.(type) {
+	case float64:
+		jd = x
+	case string:
+		var err error
+		if jd, err = strconv.ParseFloat(strings.TrimSpace(x), 64); err != nil {
+			if _, _, _, err := UnpackEpoch(x); err != nil {
+				return "", fmt.Errorf("Invalid epoch (%s)", x)
+			}
+			return x, nil
+		}
+	default:
+		return "", fmt.Errorf("Invalid epoch (%v)", jv)
+	}
+	return packEpoch(MJDToCalendar(JDToMJD(jd)))
+}
+
+// FetchOrbitByDesig gets the orbit of desig from the MPC web service at
+// MPCOrbitURL and parses it with ParseMPCOrbitJSON.
+func FetchOrbitByDesig(ctx context.Context, desig string) (*ExportOrbit, error) {
+	return FetchOrbitByDesigClient(ctx, http.DefaultClient, MPCOrbitURL, desig)
+}
+
+// FetchOrbitByDesigClient is FetchOrbitByDesig using client to query the
+// web service at serviceURL.  A nil client means http.DefaultClient.
+func FetchOrbitByDesigClient(ctx context.Context, client *http.Client,
+	serviceURL, desig string) (*ExportOrbit, error) {
+	q := url.Values{"designation": {desig}, "json": {"1"}}
+	body, err := httpGet(ctx, client, serviceURL+"?"+q.Encode())
+	if err != nil {
+		return nil, fmt.Errorf("FetchOrbitByDesig: %w", err)
+	}
+	defer body.Close()
+	data, err := ioutil.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+	return ParseMPCOrbitJSON(data)
+}
@@ -0,0 +1,83 @@
+// Public domain.
+
+package mpcformat_test
+
+import (
+	"context"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/soniakeys/mpcformat"
+)
+
+const orbitJSON = `[{"number": "00433", "designation": "433 Eros",
+"H": 10.38, "G": "0.46", "epoch": 2459600.5, "M": 310.55, "peri": 178.9,
+"node": 304.3, "i": 10.83, "e": 0.2228, "n": 0.5597, "a": 1.458,
+"num_obs": 9130, "num_opps": "58", "neo": true, "pha": false,
+"orbit_type": 4, "computer": "MPCLINUX", "extra": [1, 2]}]`
+
+func TestParseMPCOrbitJSON(t *testing.T) {
+	o, err := mpcformat.ParseMPCOrbitJSON([]byte(orbitJSON))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o.Desig != "00433" || o.Designation != "433 Eros" || o.H != 10.38 ||
+		o.G != .46 || o.Epoch != "K221L" || o.MA != 310.55 ||
+		o.Inc != 10.83 || o.M != .5597 || o.NObs != 9130 || o.NOpp != 58 ||
+		!o.NEO || o.PHA || o.Type != 4 || o.Comp != "MPCLINUX" {
+		t.Fatalf("got %+v", o)
+	}
+	if !math.IsNaN(o.RMS) {
+		t.Fatalf("RMS = %g, want NaN", o.RMS)
+	}
+	// numbers are packed
+	for _, tc := range []struct {
+		json string
+		want mpcformat.PackedDesig
+	}{
+		{`{"number": 433}`, "00433"},
+		{`{"number": 123456}`, "C3456"},
+		{`{"number": "433"}`, "00433"},
+		{`{"number": "C3456"}`, "C3456"},
+	} {
+		o, err := mpcformat.ParseMPCOrbitJSON([]byte(tc.json))
+		if err != nil {
+			t.Errorf("%s: %v", tc.json, err)
+		} else if o.Desig != tc.want {
+			t.Errorf("%s: Desig %q, want %q", tc.json, o.Desig, tc.want)
+		}
+	}
+	for _, bad := range []string{`[]`, `{"e": "x"}`, `{"epoch": "bad"}`,
+		`{"number": 4.5}`, `{"number": -1}`, `nonsense`} {
+		if _, err := mpcformat.ParseMPCOrbitJSON([]byte(bad)); err == nil {
+			t.Errorf("%s: no error", bad)
+		}
+	}
+}
+
+func TestFetchOrbitByDesig(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Query().Get("designation") != "433" {
+				http.NotFound(w, r)
+				return
+			}
+			io.WriteString(w, orbitJSON)
+		}))
+	defer ts.Close()
+	ctx := context.Background()
+	o, err := mpcformat.FetchOrbitByDesigClient(ctx, ts.Client(), ts.URL, "433")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o.Designation != "433 Eros" {
+		t.Fatalf("got %+v", o)
+	}
+	if _, err = mpcformat.FetchOrbitByDesigClient(ctx, ts.Client(), ts.URL,
+		"1"); err == nil {
+		t.Fatal("not found: no error")
+	}
+}
@@ -0,0 +1,112 @@
+// Public domain.
+
+package mpcformat
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// NUMOBSRecord is a line of NUMOBS.DAT, observation statistics of a
+// numbered minor planet.
+//
+// Arc is in years, the span of years of first and last observation, if
+// ArcYears is true, otherwise in days.  RMS is NaN when not given.
+type NUMOBSRecord struct {
+	Number      int
+	Designation string // readable designation
+	NObs        int
+	Arc         int
+	ArcYears    bool
+	RMS         float64 // r.m.s. residual, arc seconds
+}
+
+// ParseNUMOBSLine parses a line of NUMOBS.DAT.
+//
+// The number, packed or decimal, is in columns 0-7, the readable
+// designation in 8-36, number of observations in 37-42, and the arc in
+// 43-52, either years as "yyyy-yyyy" or days as "nnnn days".  The r.m.s.
+// residual in 53-58 may be blank or absent.  (Column numbers here are
+// Go-like.)
+func ParseNUMOBSLine(line string) (NUMOBSRecord, error) {
+	r := NUMOBSRecord{RMS: math.NaN()}
+	if len(line) < 52 {
+		return r, errors.New("ParseNUMOBSLine requires at least 52 characters")
+	}
+	ns := strings.TrimSpace(line[:7])
+	var err error
+	if r.Number, err = UnpackNumber(ns); err != nil {
+		return r, fmt.Errorf("ParseNUMOBSLine: Invalid number (%s)", ns)
+	}
+	r.Designation = strings.TrimSpace(line[8:36])
+	ns = strings.TrimSpace(line[37:42])
+	if r.NObs, err = strconv.Atoi(ns); err != nil {
+		return r, fmt.Errorf("ParseNUMOBSLine: Invalid NObs (%s)", ns)
+	}
+	as := strings.TrimSpace(line[43:52])
+	if r.Arc, r.ArcYears, err = parseNUMOBSArc(as); err != nil {
+		return r, fmt.Errorf("ParseNUMOBSLine: Invalid arc (%s)", as)
+	}
+	if len(line) > 53 {
+		e := len(line)
+		if e > 58 {
+			e = 58
+		}
+		rs := strings.TrimSpace(line[53:e])
+		if rs != "" {
+			if r.RMS, err = strconv.ParseFloat(rs, 64); err != nil {
+				return r, fmt.Errorf("ParseNUMOBSLine: Invalid RMS (%s)", rs)
+			}
+		}
+	}
+	return r, nil
+}
+
+// parseNUMOBSArc parses an arc as "yyyy-yyyy" or "nnnn days".
+func parseNUMOBSArc(s string) (arc int, years bool, err error) {
+	if d := strings.TrimSuffix(s, "days"); d != s {
+		arc, err = strconv.Atoi(strings.TrimSpace(d))
+		return
+	}
+	i := strings.Index(s, "-")
+	if i < 0 {
+		return 0, false, errors.New("Invalid arc")
+	}
+	f, err := strconv.Atoi(s[:i])
+	if err != nil {
+		return
+	}
+	l, err := strconv.Atoi(s[i+1:])
+	if err != nil || l < f {
+		return 0, false, errors.New("Invalid arc")
+	}
+	return l - f, true, nil
+}
+
+// ReadNUMOBSDat reads NUMOBS.DAT, returning records keyed by number.
+//
+// Blank lines are ignored.  Records read before an error are returned
+// along with the error, which gives the line number.
+func ReadNUMOBSDat(r io.Reader) (map[int]NUMOBSRecord, error) {
+	m := map[int]NUMOBSRecord{}
+	s := bufio.NewScanner(r)
+	n := 0
+	for s.Scan() {
+		n++
+		line := s.Text()
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		rec, err := ParseNUMOBSLine(line)
+		if err != nil {
+			return m, &obs80LineError{n, err}
+		}
+		m[rec.Number] = rec
+	}
+	return m, s.Err()
+}
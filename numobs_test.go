@@ -0,0 +1,62 @@
+// Public domain.
+
+package mpcformat_test
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/soniakeys/mpcformat"
+)
+
+const numobsDat = `00001   (1) Ceres                     7120 1801-2021  0.59
+00433   (433) Eros                    9130 1893-2021
+A0345   (100345) 2000 AB1               24  432 days  0.41
+
+~0000   (620000) 2013 BR84              31   17 days
+`
+
+func TestReadNUMOBSDat(t *testing.T) {
+	m, err := mpcformat.ReadNUMOBSDat(strings.NewReader(numobsDat))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m) != 4 {
+		t.Fatalf("got %d records, want 4", len(m))
+	}
+	if r := m[1]; r.Designation != "(1) Ceres" || r.NObs != 7120 ||
+		r.Arc != 220 || !r.ArcYears || r.RMS != .59 {
+		t.Fatalf("Ceres: %+v", r)
+	}
+	if r := m[433]; r.NObs != 9130 || !math.IsNaN(r.RMS) {
+		t.Fatalf("Eros: %+v", r)
+	}
+	if r := m[100345]; r.NObs != 24 || r.Arc != 432 || r.ArcYears ||
+		r.RMS != .41 {
+		t.Fatalf("100345: %+v", r)
+	}
+	if _, ok := m[620000]; !ok {
+		t.Fatal("620000 missing")
+	}
+	_, err = mpcformat.ReadNUMOBSDat(strings.NewReader(numobsDat + "junk\n"))
+	if err == nil || !strings.HasPrefix(err.Error(), "line 6:") {
+		t.Fatalf("err = %v", err)
+	}
+}
+
+func TestParseNUMOBSLine(t *testing.T) {
+	const line = "00433   (433) Eros                    9130 1893-2021  0.55"
+	for _, bad := range []string{
+		line[:50],
+		"0043x" + line[5:],
+		line[:37] + " 91x0" + line[42:],
+		line[:43] + "2021-1893" + line[52:],
+		line[:43] + "  12 dayz" + line[52:],
+		line[:53] + "0.5x",
+	} {
+		if _, err := mpcformat.ParseNUMOBSLine(bad); err == nil {
+			t.Errorf("ParseNUMOBSLine accepted %q", bad)
+		}
+	}
+}
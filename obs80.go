@@ -5,8 +5,10 @@ package mpcformat
 import (
 	"errors"
 	"fmt"
+	"math"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/soniakeys/coord"
 	"github.com/soniakeys/observation"
@@ -16,23 +18,248 @@ import (
 // ParseObs80 parses a single line observation in the MPC 80 column format.
 //
 // Input line80 must be a string of 80 characters.  Other lengths are an error.
-// The observatory code in columns 78-80 must exist in the input map.
-func ParseObs80(line80 string, ocm observation.ParallaxMap) (desig string,
+// The observatory code in columns 78-80 must be resolved by r, with the
+// exception of RovingObscode.  Wrap a ParallaxMap as ParallaxMapResolver
+// to look up codes in the map.  Roving observer observations are
+// returned as *RovingObs and the observer location must be set from line 2
+// with ParseRoving2.
+//
+// Magnitudes are normalized to V using the fixed corrections B-0.8 and
+// +0.4 for bands other than B and V.  See WithBandCorrections for other
+// corrections.
+//
+// Options opts modify parsing.  See ParseObs80Option.
+func ParseObs80(line80 string, r ObscodeResolver,
+	opts ...ParseObs80Option) (desig string, o observation.VObs, err error) {
+	return parseObs80(line80, r, newParseObs80Config(opts))
+}
+
+// ParseObs80Option is an option for ParseObs80 and ParseObs80Full.
+type ParseObs80Option func(*parseObs80Config)
+
+type parseObs80Config struct {
+	bands       BandCorrectionTable
+	strict      bool
+	programCode bool
+	discovery   bool
+}
+
+func newParseObs80Config(opts []ParseObs80Option) *parseObs80Config {
+	c := &parseObs80Config{bands: legacyBands, programCode: true, discovery: true}
+	for _, o := range opts {
+		o(c)
+	}
+	return c
+}
+
+// WithBandCorrections returns a ParseObs80Option normalizing magnitudes
+// to V using bands.
+func WithBandCorrections(bands BandCorrectionTable) ParseObs80Option {
+	return func(c *parseObs80Config) { c.bands = bands }
+}
+
+// WithStrictMode returns a ParseObs80Option that, if strict is true,
+// rejects fields outside their expected ranges: a day of the month over
+// 31, RA hours over 23, Dec degrees over 90, minutes or seconds of RA or
+// Dec of 60 or more, and a Dec sign other than + or -.
+func WithStrictMode(strict bool) ParseObs80Option {
+	return func(c *parseObs80Config) { c.strict = strict }
+}
+
+// WithProgramCode returns a ParseObs80Option setting whether ParseObs80Full
+// captures the program code or note 1 of column 13 as Note1.  The default
+// is true.  The observation returned by ParseObs80 is not affected.
+func WithProgramCode(capture bool) ParseObs80Option {
+	return func(c *parseObs80Config) { c.programCode = capture }
+}
+
+// WithDiscoveryFlag returns a ParseObs80Option setting whether
+// ParseObs80Full captures the discovery flag of column 12 as Discovery.
+// The default is true.  The observation returned by ParseObs80 is not
+// affected.
+func WithDiscoveryFlag(capture bool) ParseObs80Option {
+	return func(c *parseObs80Config) { c.discovery = capture }
+}
+
+// ObscodeResolver looks up observatory codes.
+//
+// Resolve returns the parallax constants for code and true if code is
+// known.  The parallax constants may be nil for a known code, such as that
+// of a satellite observatory, for which parallax constants do not apply.
+type ObscodeResolver interface {
+	Resolve(code string) (*observation.ParallaxConst, bool)
+}
+
+// ParallaxMapResolver is an ObscodeResolver that looks up codes in a
+// ParallaxMap.
+type ParallaxMapResolver observation.ParallaxMap
+
+// Resolve implements ObscodeResolver.
+func (m ParallaxMapResolver) Resolve(code string) (*observation.ParallaxConst, bool) {
+	p, ok := m[code]
+	return p, ok
+}
+
+// ParseNEOCPObs80 parses a single line observation in the MPC 80 column
+// format as ParseObs80, but requires the designation to be an NEOCP
+// temporary designation, as determined by IsNEOCPDesig.
+func ParseNEOCPObs80(line80 string, ocm observation.ParallaxMap) (desig string,
 	o observation.VObs, err error) {
-	if len(line80) != 80 {
-		err = errors.New("ParseObs80 requires 80 characters")
-		return
+	if desig, o, err = ParseObs80(line80, ParallaxMapResolver(ocm)); err != nil {
+		return "", nil, err
 	}
+	if !IsNEOCPDesig(desig) {
+		return "", nil, newParseError(ErrInvalidField, desig, 0,
+			"ParseNEOCPObs80: Not an NEOCP designation (%s)", desig)
+	}
+	return desig, o, nil
+}
+
+// BandCorrectionTable maps magnitude band codes of the 80 column format
+// to corrections added to normalize magnitudes to V.
+//
+// Bands not in the table use the correction for key 0 if present, otherwise
+// they are not corrected.  A nil table means no correction for any band.
+type BandCorrectionTable map[byte]float64
+
+// the corrections used by ParseObs80.
+var legacyBands = BandCorrectionTable{'V': 0, 'B': -.8, 0: .4}
+
+// DefaultBandCorrections is a more complete table of band corrections
+// than that used by ParseObs80.
+var DefaultBandCorrections = BandCorrectionTable{
+	'V': 0,
+	'B': -.8,
+	'R': -.2,
+	'I': -.7,
+	'g': 0,
+	'r': -.2,
+	'i': -.4,
+	0:   .4,
+}
+
+// ParseObs80WithBands parses a single line observation in the MPC 80 column
+// format as ParseObs80, but with magnitudes normalized using bands.
+//
+// It is equivalent to ParseObs80 with WithBandCorrections(bands).
+func ParseObs80WithBands(line80 string, ocm observation.ParallaxMap,
+	bands BandCorrectionTable) (desig string, o observation.VObs, err error) {
+	return ParseObs80(line80, ParallaxMapResolver(ocm), WithBandCorrections(bands))
+}
 
-	// the intent of reallocating desig (and later, obscode) is
+func parseObs80(line80 string, ocm ObscodeResolver,
+	c *parseObs80Config) (desig string, o observation.VObs, err error) {
+	var r Obs80Result
+	if err = parseObs80Into(line80, ocm, c, "ParseObs80", &r); err != nil {
+		return
+	}
+	// the intent of reallocating desig (and obscode) is
 	// to allow line80 to be garbage collected sooner. no idea it really helps.
-	desig = string([]byte(strings.TrimSpace(line80[:12])))
+	desig = string([]byte(r.Desig))
+	obscode := string([]byte(r.Obscode))
+
+	switch {
+	case obscode == RovingObscode:
+		o = &RovingObs{}
+	case r.Par == nil || r.Note2 == 'S':
+		o = &observation.SatObs{Sat: obscode}
+	default:
+		o = &observation.SiteObs{Par: r.Par}
+	}
+	m := o.Meas()
+	m.MJD = r.MJD
+	m.RA = r.RA
+	m.Dec = r.Dec
+	m.VMag = r.VMag
+	// could be enhanced to store program code, eg.  if so, see obsErr
+	// code in digest2.readConfig and make appropriate changes.
+	m.Qual = obscode
+	return
+}
+
+// errOutOfRange is the reason for a field rejected by WithStrictMode.
+var errOutOfRange = errors.New("out of range")
+
+// Obs80Result holds the data of a single line observation in the MPC 80
+// column format, as parsed by ParseObs80Into.
+//
+// Strings are substrings of the parsed line.  Par is nil for a space-based
+// observation.  A roving observer has Obscode RovingObscode.
+type Obs80Result struct {
+	Desig     string
+	Discovery byte // column 12
+	Note1     byte // column 13
+	Note2     byte // column 14
+	MJD       float64
+	RA        unit.RA
+	Dec       unit.Angle
+	VMag      float64
+	Obscode   string
+	Par       *observation.ParallaxConst
+}
+
+// defaultParseObs80Config is the configuration of ParseObs80 with no
+// options.
+var defaultParseObs80Config = parseObs80Config{bands: legacyBands}
+
+// ParseObs80Into parses a single line observation in the MPC 80 column
+// format as ParseObs80, but into dst rather than a newly allocated
+// observation.
+//
+// Dst may be reused across calls.  Successful calls do not allocate.
+func ParseObs80Into(line80 string, ocm ObscodeResolver, dst *Obs80Result) error {
+	return parseObs80Into(line80, ocm, &defaultParseObs80Config,
+		"ParseObs80Into", dst)
+}
+
+// Obs80DegResult holds the result of ParseObs80Degrees.
+type Obs80DegResult struct {
+	MJD     float64
+	RADeg   float64
+	DecDeg  float64
+	VMag    float64
+	ObsCode string
+}
+
+// ParseObs80Degrees parses a single line observation in the MPC 80 column
+// format as ParseObs80, returning RA and Dec in degrees.
+func ParseObs80Degrees(line80 string, ocm ObscodeResolver) (desig string, o Obs80DegResult, err error) {
+	var r Obs80Result
+	if err = parseObs80Into(line80, ocm, &defaultParseObs80Config,
+		"ParseObs80Degrees", &r); err != nil {
+		return
+	}
+	return r.Desig, Obs80DegResult{
+		MJD:     r.MJD,
+		RADeg:   r.RA.Deg(),
+		DecDeg:  r.Dec.Deg(),
+		VMag:    r.VMag,
+		ObsCode: r.Obscode,
+	}, nil
+}
+
+// parseObs80Into parses line80 into r.  Errors are prefixed with function
+// name fn.
+func parseObs80Into(line80 string, ocm ObscodeResolver, c *parseObs80Config,
+	fn string, r *Obs80Result) (err error) {
+	if len(line80) != 80 {
+		return newParseError(ErrShortLine, line80, -1,
+			"%s requires 80 characters", fn)
+	}
+	r.Desig = strings.TrimSpace(line80[:12])
+	r.Discovery = line80[12]
+	r.Note1 = line80[13]
+	r.Note2 = line80[14]
 
 	d := line80[15:32]
-	mjd, ok := ParseObs80Date(d)
+	var ok bool
+	r.MJD, ok = ParseObs80Date(d)
+	if ok && c.strict {
+		day, _ := strconv.ParseFloat(strings.TrimSpace(d[8:]), 64)
+		ok = day >= 1 && day < 32
+	}
 	if !ok {
-		err = fmt.Errorf("ParseObs80: Invalid date (%s)", d)
-		return
+		return newParseError(ErrBadDate, d, 15, "%s: Invalid date (%s)", fn, d)
 	}
 
 	var rah, ram int
@@ -45,12 +272,19 @@ func ParseObs80(line80 string, ocm observation.ParallaxMap) (desig string,
 				strconv.ParseFloat(strings.TrimSpace(line80[38:44]), 64)
 		}
 	}
+	if err == nil && c.strict && !(rah >= 0 && rah < 24 &&
+		ram >= 0 && ram < 60 && ras >= 0 && ras < 60) {
+		err = errOutOfRange
+	}
 	if err != nil {
-		err = fmt.Errorf("ParseObs80: Invalid RA (%s), %v", line80[32:44], err)
-		return
+		return newParseError(ErrBadRA, line80[32:44], 32,
+			"%s: Invalid RA (%s), %v", fn, line80[32:44], err)
 	}
+	r.RA = unit.NewRA(rah, ram, ras)
 
-	decg := line80[44] // minus sign
+	// sign is applied to the whole angle, so it is effective even when
+	// degrees are zero, as in -00 00 30.0.
+	decg := line80[44]
 	var decd, decm int
 	var decs float64
 	decd, err = strconv.Atoi(strings.TrimSpace(line80[45:47]))
@@ -61,52 +295,277 @@ func ParseObs80(line80 string, ocm observation.ParallaxMap) (desig string,
 				strconv.ParseFloat(strings.TrimSpace(line80[51:56]), 64)
 		}
 	}
+	if err == nil && c.strict && !((decg == '+' || decg == '-') &&
+		decd >= 0 && decd <= 90 && decm >= 0 && decm < 60 &&
+		decs >= 0 && decs < 60) {
+		err = errOutOfRange
+	}
 	if err != nil {
-		err = fmt.Errorf("ParseObs80: Invalid Dec (%s), %v", line80[44:56], err)
-		return
+		return newParseError(ErrBadDec, line80[44:56], 44,
+			"%s: Invalid Dec (%s), %v", fn, line80[44:56], err)
 	}
+	r.Dec = unit.NewAngle(decg, decd, decm, decs)
 
-	var mag float64
-	if ts := strings.TrimSpace(line80[65:70]); len(ts) != 0 {
-		mag, err = strconv.ParseFloat(ts, 64)
-		if err != nil {
-			err = fmt.Errorf("ParseObs80: Invalid mag (%s), %v", ts, err)
-			return
-		}
-		band := line80[70]
-		switch band {
-		case 'V':
-			break
-		case 'B':
-			mag -= .8
-		default:
-			mag += .4
-		}
+	if r.VMag, _, err = parseObs80Mag(line80, c.bands, fn); err != nil {
+		return err
 	}
 
-	c := line80[77:80]
-	par, ok := ocm[c]
-	if !ok {
-		return "", nil,
-			fmt.Errorf("ParseObs80: Unknown observatory code (%s)", c)
+	r.Obscode = line80[77:80]
+	r.Par, ok = ocm.Resolve(r.Obscode)
+	if !ok && r.Obscode != RovingObscode {
+		return newParseError(ErrUnknownObscode, r.Obscode, 77,
+			"%s: Unknown observatory code (%s)", fn, r.Obscode)
 	}
+	return nil
+}
 
-	obscode := string([]byte(line80[77:80]))
+// Obs80Fields holds the results of ParseObs80 along with additional fields
+// of the 80 column format.
+//
+// Discovery, column 13 in MPC 1-based numbering, is '*' for a discovery
+// observation, '?' for an uncertain observation, or blank.
+//
+// Note1, column 14 in MPC 1-based numbering, is either a program code
+// assigned by the MPC or one of the following standard notes:
+//
+//	A  earlier approximate position inferior
+//	a  sense of motion ambiguous
+//	B  bright sky/black or dark plate
+//	b  bad seeing
+//	c  crowded star field
+//	D  declination uncertain
+//	d  diffuse image
+//	E  at or near edge of plate
+//	F  faint image
+//	f  involved with emulsion or plate flaw
+//	G  poor guiding
+//	g  no guiding
+//	H  hand measurement of CCD image
+//	I  involved with star
+//	i  inkdot measured
+//	J  J2000.0 rereduction of previously-reported position
+//	K  stacked image
+//	k  stare-mode observation by scanning system
+//	M  measurement difficult
+//	m  image tracked on object motion
+//	N  near edge of plate, measurement uncertain
+//	O  image out of focus
+//	o  plate measured in one direction only
+//	P  position uncertain
+//	p  poor image
+//	R  right ascension uncertain
+//	r  poor distribution of reference stars
+//	S  poor sky
+//	s  streaked image
+//	T  time uncertain
+//	t  trailed image
+//	U  uncertain image
+//	u  unconfirmed image
+//	V  very faint image
+//	W  weak image
+//	w  weak solution
+//
+// Note2, column 15, gives the type of observation:
+//
+//	P    photographic (also indicated by a blank)
+//	e    encoder
+//	C    CCD
+//	T    meridian or transit circle
+//	M    micrometer
+//	V v  roving observer, lines 1 and 2
+//	R r  radar, lines 1 and 2
+//	S s  satellite, lines 1 and 2
+//	c    corrected-without-republication CCD
+//	E    occultation-derived
+//	O    offset, used for natural satellites
+//	H    Hipparcos geocentric
+//	N    normal place
+//	n    mini-normal place derived from averaging video frames
+//	A    reduced from B1950 to J2000
+//	X x  discovery observation replaced or deleted
+type Obs80Fields struct {
+	Desig     string
+	Obs       observation.VObs
+	Discovery byte
+	Note1     byte
+	Note2     byte
+	OrigMag   float64 // magnitude as reported, 0 if blank
+	Band      byte    // band of OrigMag, column 70
+}
 
-	if par == nil || line80[14] == 'S' {
-		o = &observation.SatObs{Sat: obscode}
+// parseObs80Mag parses the magnitude of columns 65-70, normalized to V
+// using bands.  A blank field returns has false.  Errors are prefixed with
+// function name fn.
+func parseObs80Mag(line80 string, bands BandCorrectionTable,
+	fn string) (mag float64, has bool, err error) {
+	ts := strings.TrimSpace(line80[65:70])
+	if len(ts) == 0 {
+		return 0, false, nil
+	}
+	mag, err = strconv.ParseFloat(ts, 64)
+	if err != nil {
+		return 0, false, newParseError(ErrBadMag, ts, 65,
+			"%s: Invalid mag (%s), %v", fn, ts, err)
+	}
+	if c, ok := bands[line80[70]]; ok {
+		mag += c
 	} else {
-		o = &observation.SiteObs{Par: par}
+		mag += bands[0]
 	}
-	m := o.Meas()
-	m.MJD = mjd
-	m.RA = unit.NewRA(rah, ram, ras)
-	m.Dec = unit.NewAngle(decg, decd, decm, decs)
-	m.VMag = mag
-	// could be enhanced to store program code, eg.  if so, see obsErr
-	// code in digest2.readConfig and make appropriate changes.
-	m.Qual = obscode
-	return
+	return mag, true, nil
+}
+
+// ParseObs80MagStrict parses just the magnitude of an 80 column
+// observation, distinguishing a blank field from an explicit magnitude.
+//
+// Vmag is normalized to V as by ParseObs80.  HasMag is false if the field is
+// blank.  A field of explicit zero returns hasMag true.  Since a magnitude
+// of zero is implausible for a minor planet, this may indicate a file using
+// zero for no magnitude.
+func ParseObs80MagStrict(line80 string) (vmag float64, hasMag bool, err error) {
+	if len(line80) != 80 {
+		return 0, false, newParseError(ErrShortLine, line80, -1,
+			"ParseObs80MagStrict requires 80 characters")
+	}
+	return parseObs80Mag(line80, legacyBands, "ParseObs80MagStrict")
+}
+
+// ParseObs80Full parses a single line observation in the MPC 80 column
+// format, as ParseObs80, additionally returning the discovery flag of
+// column 12, notes of columns 13 and 14, and the magnitude and band as
+// reported in columns 65-71 (Go-like numbering.)
+//
+// The VMag of the returned observation is the V-equivalent magnitude as
+// computed by ParseObs80.  OrigMag and Band allow other corrections.
+// Options opts are as for ParseObs80.  With WithProgramCode(false) or
+// WithDiscoveryFlag(false), Note1 or Discovery is left 0.
+func ParseObs80Full(line80 string, ocm observation.ParallaxMap,
+	opts ...ParseObs80Option) (*Obs80Fields, error) {
+	c := newParseObs80Config(opts)
+	desig, o, err := parseObs80(line80, ParallaxMapResolver(ocm), c)
+	if err != nil {
+		return nil, err
+	}
+	f := &Obs80Fields{
+		Desig: desig,
+		Obs:   o,
+		Note2: line80[14],
+		Band:  line80[70],
+	}
+	if c.discovery {
+		f.Discovery = line80[12]
+	}
+	if c.programCode {
+		f.Note1 = line80[13]
+	}
+	if ts := strings.TrimSpace(line80[65:70]); ts != "" {
+		// already validated by ParseObs80
+		f.OrigMag, _ = strconv.ParseFloat(ts, 64)
+	}
+	return f, nil
+}
+
+// ParseObs80Notes returns just the notes of columns 13 and 14 of an 80
+// column observation.  See Obs80Fields for the note codes.
+//
+// The only validation is that line80 has 80 characters.
+func ParseObs80Notes(line80 string) (note1, note2 byte, err error) {
+	if len(line80) != 80 {
+		return 0, 0, newParseError(ErrShortLine, line80, -1,
+			"ParseObs80Notes requires 80 characters")
+	}
+	return line80[13], line80[14], nil
+}
+
+// Obs80FieldError describes a field of an 80 column observation that fails
+// validation.  Col is the Go-like starting column of the field.
+type Obs80FieldError struct {
+	Col    int
+	Field  string
+	Reason string
+}
+
+func (e Obs80FieldError) Error() string {
+	return fmt.Sprintf("column %d, %s: %s", e.Col, e.Field, e.Reason)
+}
+
+// ValidateObs80Line checks the structure of a single line optical
+// observation in the MPC 80 column format without fully parsing it.
+//
+// Checked are the line length, that the date is valid, that RA and Dec look
+// like sexagesimal coordinates, that the magnitude is blank or numeric, and,
+// if ocm is not nil, that the observatory code is in ocm.
+//
+// A nil result means the line is valid.
+func ValidateObs80Line(line string, ocm observation.ParallaxMap) []Obs80FieldError {
+	if len(line) != 80 {
+		return []Obs80FieldError{{len(line), "line",
+			fmt.Sprintf("length = %d, want 80", len(line))}}
+	}
+	var errs []Obs80FieldError
+	fail := func(col int, field, reason string) {
+		errs = append(errs, Obs80FieldError{col, field, reason})
+	}
+	if _, ok := ParseObs80Date(line[15:32]); !ok {
+		fail(15, "date", "invalid date")
+	}
+	// sexa checks a sexagesimal field, returning false for invalid syntax
+	// or range.
+	sexa := func(f string, max int) bool {
+		a, err := strconv.Atoi(strings.TrimSpace(f[:2]))
+		if err != nil || a < 0 || a > max {
+			return false
+		}
+		b, err := strconv.Atoi(strings.TrimSpace(f[3:5]))
+		if err != nil || b < 0 || b >= 60 {
+			return false
+		}
+		c, err := strconv.ParseFloat(strings.TrimSpace(f[6:]), 64)
+		return err == nil && c >= 0 && c < 60
+	}
+	if !sexa(line[32:44], 23) {
+		fail(32, "RA", "want HH MM SS.ss")
+	}
+	if g := line[44]; g != '+' && g != '-' && g != ' ' {
+		fail(44, "Dec", "invalid sign")
+	} else if !sexa(line[45:56], 90) {
+		fail(44, "Dec", "want ±DD MM SS.s")
+	}
+	if ts := strings.TrimSpace(line[65:70]); ts > "" {
+		if _, err := strconv.ParseFloat(ts, 64); err != nil {
+			fail(65, "mag", "not numeric")
+		}
+	}
+	if ocm != nil {
+		if _, ok := ocm[line[77:80]]; !ok {
+			fail(77, "obscode", "unknown observatory code")
+		}
+	}
+	return errs
+}
+
+// ParseObs80DiscoveryFlag returns just the discovery flag of column 12 of
+// an 80 column observation, '*', '?', or blank.
+//
+// The only validation is that line80 has at least 80 characters.
+func ParseObs80DiscoveryFlag(line80 string) (byte, error) {
+	if len(line80) < 80 {
+		return 0, newParseError(ErrShortLine, line80, -1,
+			"ParseObs80DiscoveryFlag requires 80 characters")
+	}
+	return line80[12], nil
+}
+
+// ParseObs80Flags interprets column 12 of an 80 column observation,
+// returning discovery true for '*' and uncertain true for '?'.
+//
+// The only validation is that line80 has at least 80 characters.
+func ParseObs80Flags(line80 string) (discovery, uncertain bool, err error) {
+	if len(line80) < 80 {
+		return false, false, newParseError(ErrShortLine, line80, -1,
+			"ParseObs80Flags requires 80 characters")
+	}
+	return line80[12] == '*', line80[12] == '?', nil
 }
 
 var flookup = [13]int{0, 306, 337, 0, 31, 61, 92, 122, 153, 184, 214, 245, 275}
@@ -146,39 +605,99 @@ func ParseObs80Date(d string) (mjd float64, ok bool) {
 	return float64(m) + day, true
 }
 
-// ParseSat2 parses the second line of a space-based observation.
+// mjdEpoch is MJD 0.
+var mjdEpoch = time.Date(1858, 11, 17, 0, 0, 0, 0, time.UTC)
+
+// ParseObs80DateTime parses a date in the format used in 80 column
+// observation records, as ParseObs80Date, but returns a UTC time.Time.
 //
-// Arguments des1 and s1 must be results of parsing the first line.
-// ParseSat2 validates that identifying data matches line 1 and then
-// updates s1 with line 2 information.
-func ParseSat2(line80, des1 string, s1 *observation.SatObs) error {
+// The fractional day is converted to the nearest nanosecond.
+func ParseObs80DateTime(d string) (t time.Time, ok bool) {
+	mjd, ok := ParseObs80Date(d)
+	if !ok {
+		return
+	}
+	// recover the day field for best precision of the fraction.
+	day, _ := strconv.ParseFloat(strings.TrimSpace(d[8:]), 64)
+	whole := math.Floor(day)
+	days := int(math.Floor(mjd-day+.5)) + int(whole)
+	ns := math.Floor((day-whole)*24*float64(time.Hour) + .5)
+	return mjdEpoch.AddDate(0, 0, days).Add(time.Duration(ns)), true
+}
+
+// line2Kinds names observation types by the note 2 of line 2.
+var line2Kinds = map[byte]string{'s': "sat", 'v': "roving", 'r': "radar"}
+
+// checkLine2Note validates that line80 is a line 2 of the kind given by
+// note.  A line 2 of another kind is reported as that kind.  kind names the
+// observation type in error messages.
+func checkLine2Note(line80 string, note byte, kind string) error {
+	if len(line80) != 80 {
+		return newParseError(ErrShortLine, line80, -1,
+			"%s obs line 2 requires 80 characters", kind)
+	}
+	if n := line80[14]; n != note {
+		if k, ok := line2Kinds[n]; ok {
+			return newParseError(ErrInvalidField, line80[14:15], 14,
+				"%s obs line 2 note 2 = %c, a %s obs line 2", kind, n, k)
+		}
+		return newParseError(ErrInvalidField, line80[14:15], 14,
+			"%s obs line 2 note 2 = %c, want %c", kind, n, note)
+	}
+	return nil
+}
+
+// checkLine2 validates that line80 is a line 2 of the kind given by note,
+// as checkLine2Note, and that designation and date match line 1.
+func checkLine2(line80, des1 string, mjd1 float64, note byte, kind string) error {
+	if err := checkLine2Note(line80, note, kind); err != nil {
+		return err
+	}
 	if desig := strings.TrimSpace(line80[:12]); desig != des1 {
-		return fmt.Errorf("sat obs line 2 designation = %s, line 1 was %s",
-			desig, des1)
+		return newParseError(ErrInvalidField, desig, 0,
+			"%s obs line 2 designation = %s, line 1 was %s", kind, desig, des1)
 	}
 	d := line80[15:32]
 	switch date2, ok := ParseObs80Date(d); {
 	case !ok:
-		return fmt.Errorf("sat obs line 2 invalid date (%s)", d)
-	case date2 != s1.MJD:
-		return fmt.Errorf("sat obs line 2 date %s different from line 1", d)
+		return newParseError(ErrBadDate, d, 15,
+			"%s obs line 2 invalid date (%s)", kind, d)
+	case date2 != mjd1:
+		return newParseError(ErrBadDate, d, 15,
+			"%s obs line 2 date %s different from line 1", kind, d)
+	}
+	return nil
+}
+
+// ParseSat2 parses the second line of a space-based observation.
+//
+// Arguments des1 and s1 must be results of parsing the first line.
+// ParseSat2 validates that identifying data matches line 1 and then
+// updates s1 with line 2 information.  Note 2 must be 's'; a radar or
+// roving line 2 is reported as such.
+func ParseSat2(line80, des1 string, s1 *observation.SatObs) error {
+	if err := checkLine2(line80, des1, s1.MJD, 's', "sat"); err != nil {
+		return err
 	}
 	if line80[77:80] != s1.Sat {
-		return fmt.Errorf("sat obs line 2 obscode = %s, line 1 was %s",
-			line80[77:80], s1.Sat)
+		return newParseError(ErrInvalidField, line80[77:80], 77,
+			"sat obs line 2 obscode = %s, line 1 was %s", line80[77:80], s1.Sat)
 	}
 
 	x, ok := parseMpcOffset(line80[34:46])
 	if !ok {
-		return fmt.Errorf("sat obs line 2 invalid offset: %s", line80[34:46])
+		return newParseError(ErrInvalidField, line80[34:46], 34,
+			"sat obs line 2 invalid offset: %s", line80[34:46])
 	}
 	y, ok := parseMpcOffset(line80[46:58])
 	if !ok {
-		return fmt.Errorf("sat obs line 2 invalid offset: %s", line80[46:58])
+		return newParseError(ErrInvalidField, line80[46:58], 46,
+			"sat obs line 2 invalid offset: %s", line80[46:58])
 	}
 	z, ok := parseMpcOffset(line80[58:70])
 	if !ok {
-		return fmt.Errorf("sat obs line 2 invalid offset: %s", line80[58:70])
+		return newParseError(ErrInvalidField, line80[58:70], 58,
+			"sat obs line 2 invalid offset: %s", line80[58:70])
 	}
 	if line80[32] == '1' {
 		// Scale factor = 1 / 1 AU in km.
@@ -191,6 +710,61 @@ func ParseSat2(line80, des1 string, s1 *observation.SatObs) error {
 	return nil
 }
 
+// RovingObscode is the MPC observatory code for roving observers.
+const RovingObscode = "247"
+
+// RovingObs represents an observation by a roving observer, where the
+// observer location is given with the observation rather than by an
+// observatory code.  It satisfies the observation.VObs interface.
+type RovingObs struct {
+	observation.VMeas         // the observation
+	Lon               float64 // WGS84 east longitude, degrees
+	Lat               float64 // WGS84 geodetic latitude, degrees
+	Alt               float64 // altitude above the WGS84 ellipsoid, meters
+}
+
+// Meas satisfies a method of the observation.VObs interface.
+func (o *RovingObs) Meas() *observation.VMeas {
+	return &o.VMeas
+}
+
+// EarthObserverVect satisfies a method of the observation.VObs interface.
+func (o *RovingObs) EarthObserverVect() coord.Cart {
+	return observation.EarthObserverVect(o.MJD,
+		GeodeticToParallax(o.Lat, o.Lon, o.Alt))
+}
+
+// ParseRoving2 parses the second line of a roving observer observation.
+//
+// Arguments des1 and r1 must be results of parsing the first line.
+// ParseRoving2 validates that identifying data matches line 1 and then
+// updates r1 with the observer location of line 2.  Note 2 must be 'v'; a
+// radar or satellite line 2 is reported as such.
+func ParseRoving2(line80, des1 string, r1 *RovingObs) error {
+	if err := checkLine2(line80, des1, r1.MJD, 'v', "roving"); err != nil {
+		return err
+	}
+	lon, err := strconv.ParseFloat(strings.TrimSpace(line80[34:44]), 64)
+	if err != nil || lon < 0 || lon > 360 {
+		return newParseError(ErrInvalidField, line80[34:44], 34,
+			"roving obs line 2 invalid longitude: %s", line80[34:44])
+	}
+	lat, err := strconv.ParseFloat(strings.TrimSpace(line80[45:55]), 64)
+	if err != nil || lat < -90 || lat > 90 {
+		return newParseError(ErrInvalidField, line80[45:55], 45,
+			"roving obs line 2 invalid latitude: %s", line80[45:55])
+	}
+	alt, err := strconv.Atoi(strings.TrimSpace(line80[56:61]))
+	if err != nil {
+		return newParseError(ErrInvalidField, line80[56:61], 56,
+			"roving obs line 2 invalid altitude: %s", line80[56:61])
+	}
+	r1.Lon = lon
+	r1.Lat = lat
+	r1.Alt = float64(alt)
+	return nil
+}
+
 func parseMpcOffset(off string) (float64, bool) {
 	v, err := strconv.ParseFloat(strings.TrimSpace(off[1:]), 64)
 	switch {
@@ -203,3 +777,294 @@ func parseMpcOffset(off string) (float64, bool) {
 	}
 	return 0, false
 }
+
+// FormatObs80 formats an observation as a single line in the MPC 80 column
+// format.
+//
+// Observations of type *observation.SiteObs are written with note 2 = 'C',
+// for CCD.  For *observation.SatObs, line 1 is written with note 2 = 'S';
+// the offset of line 2 is not written.  The observatory code is taken from
+// o.Meas().Qual.  The magnitude, if not zero, is written as a V magnitude.
+//
+// An error is returned for other observation types, if desig is longer than
+// 12 characters, or if coordinates or magnitude are out of range.
+func FormatObs80(desig string, o observation.VObs) (string, error) {
+	var note2 byte
+	switch o.(type) {
+	case *observation.SiteObs:
+		note2 = 'C'
+	case *observation.SatObs:
+		note2 = 'S'
+	default:
+		return "", newParseError(ErrInvalidField, fmt.Sprintf("%T", o), -1,
+			"FormatObs80: unsupported observation type %T", o)
+	}
+	return formatObs80Meas(desig, note2, o.Meas())
+}
+
+// formatObs80Meas formats the measurement m with note 2 as FormatObs80.
+func formatObs80Meas(desig string, note2 byte, m *observation.VMeas) (string, error) {
+	b := new(Obs80Builder).
+		SetDesig(desig).
+		SetNotes(' ', note2).
+		SetDate(m.MJD).
+		SetRA(m.RA.Rad()).
+		SetDec(m.Dec.Rad()).
+		SetObscode(m.Qual)
+	if m.VMag != 0 {
+		b.SetMag(m.VMag, 'V')
+	}
+	return b.Build()
+}
+
+// formatSat2 formats line 2 of a satellite observation with line 1 line1.
+//
+// Offsets are written in km, or in AU if a component does not fit.
+func formatSat2(line1 string, s *observation.SatObs) string {
+	const auKm = 149.59787e6
+	unit, f, sf := byte('1'), "%10.4f", auKm
+	for _, v := range [...]float64{s.Offset.X, s.Offset.Y, s.Offset.Z} {
+		if math.Abs(v*auKm) >= 99999.99995 {
+			unit, f, sf = '2', "%10.8f", 1
+		}
+	}
+	b := []byte(line1[:15] + strings.Repeat(" ", 65))
+	b[14] = 's'
+	copy(b[15:32], line1[15:32])
+	b[32] = unit
+	for i, v := range [...]float64{s.Offset.X, s.Offset.Y, s.Offset.Z} {
+		c := 34 + i*12
+		b[c] = '+'
+		if v < 0 {
+			b[c] = '-'
+			v = -v
+		}
+		copy(b[c+1:c+11], fmt.Sprintf(f, v*sf))
+	}
+	copy(b[77:], s.Sat)
+	return string(b)
+}
+
+// Obs80Builder constructs a line in the MPC 80 column format.
+//
+// The zero value is ready to use.  Set methods return the builder so calls
+// can be chained.  Date, RA, Dec, and observatory code are required.
+// Other fields default to blank, except note 2 which defaults to 'C'.
+type Obs80Builder struct {
+	desig        string
+	mjd          float64
+	ra, dec      float64
+	mag          float64
+	band         byte
+	obscode      string
+	note1, note2 byte
+	discovery    bool
+	uncertain    bool
+	hasDate      bool
+	hasRA        bool
+	hasDec       bool
+	hasMag       bool
+	hasNotes     bool
+}
+
+// SetDesig sets the designation, up to 12 characters.
+func (b *Obs80Builder) SetDesig(s string) *Obs80Builder {
+	b.desig = s
+	return b
+}
+
+// SetDate sets the date as a modified Julian date.
+func (b *Obs80Builder) SetDate(mjd float64) *Obs80Builder {
+	b.mjd = mjd
+	b.hasDate = true
+	return b
+}
+
+// SetRA sets right ascension in radians.
+func (b *Obs80Builder) SetRA(ra float64) *Obs80Builder {
+	b.ra = ra
+	b.hasRA = true
+	return b
+}
+
+// SetDec sets declination in radians.
+func (b *Obs80Builder) SetDec(dec float64) *Obs80Builder {
+	b.dec = dec
+	b.hasDec = true
+	return b
+}
+
+// SetMag sets the magnitude and band.
+func (b *Obs80Builder) SetMag(v float64, band byte) *Obs80Builder {
+	b.mag = v
+	b.band = band
+	b.hasMag = true
+	return b
+}
+
+// SetObscode sets the 3 character observatory code.
+func (b *Obs80Builder) SetObscode(code string) *Obs80Builder {
+	b.obscode = code
+	return b
+}
+
+// SetNotes sets note 1 and note 2.  See Obs80Fields for note codes.
+func (b *Obs80Builder) SetNotes(note1, note2 byte) *Obs80Builder {
+	b.note1 = note1
+	b.note2 = note2
+	b.hasNotes = true
+	return b
+}
+
+// SetFlags sets the column 12 flag, '*' for discovery or '?' for
+// uncertain.  The two are exclusive, Build returns an error if both are set.
+func (b *Obs80Builder) SetFlags(discovery, uncertain bool) *Obs80Builder {
+	b.discovery = discovery
+	b.uncertain = uncertain
+	return b
+}
+
+// Build returns the 80 column line.
+//
+// An error is returned if a required field was not set or if a field
+// value cannot be represented.
+func (b *Obs80Builder) Build() (string, error) {
+	switch {
+	case !b.hasDate:
+		return "", newParseError(ErrBadDate, "", 15,
+			"Obs80Builder: date not set")
+	case !b.hasRA:
+		return "", newParseError(ErrBadRA, "", 32, "Obs80Builder: RA not set")
+	case !b.hasDec:
+		return "", newParseError(ErrBadDec, "", 44, "Obs80Builder: Dec not set")
+	case b.obscode == "":
+		return "", newParseError(ErrUnknownObscode, "", 77,
+			"Obs80Builder: observatory code not set")
+	}
+	l := []byte(strings.Repeat(" ", 80))
+	switch {
+	case len(b.desig) > 12:
+		return "", newParseError(ErrInvalidField, b.desig, 0,
+			"Obs80Builder: designation too long (%s)", b.desig)
+	case len(b.desig) <= 5 || len(b.desig) > 7:
+		copy(l, b.desig) // number, or non-standard designation
+	default:
+		copy(l[5:], b.desig) // provisional or temporary designation
+	}
+	switch {
+	case b.discovery && b.uncertain:
+		return "", newParseError(ErrInvalidField, "", 12,
+			"Obs80Builder: both discovery and uncertain flags set")
+	case b.discovery:
+		l[12] = '*'
+	case b.uncertain:
+		l[12] = '?'
+	}
+	l[14] = 'C'
+	if b.hasNotes {
+		l[13] = blankZero(b.note1)
+		l[14] = blankZero(b.note2)
+	}
+	copy(l[15:], FormatObs80Date(b.mjd, 5))
+	if !(b.ra >= 0 && b.ra < 2*math.Pi) {
+		return "", newParseError(ErrBadRA, fmt.Sprint(b.ra), 32,
+			"Obs80Builder: RA out of range (%g)", b.ra)
+	}
+	copy(l[32:], FormatRA(b.ra))
+	if !(b.dec >= -math.Pi/2 && b.dec <= math.Pi/2) {
+		return "", newParseError(ErrBadDec, fmt.Sprint(b.dec), 44,
+			"Obs80Builder: Dec out of range (%g)", b.dec)
+	}
+	copy(l[44:], FormatDec(b.dec))
+	if b.hasMag {
+		if !(b.mag > -9.95 && b.mag < 99.95) {
+			return "", newParseError(ErrBadMag, fmt.Sprint(b.mag), 65,
+				"Obs80Builder: mag out of range (%g)", b.mag)
+		}
+		copy(l[65:], fmt.Sprintf("%4.1f", b.mag))
+		l[70] = blankZero(b.band)
+	}
+	if len(b.obscode) != 3 {
+		return "", newParseError(ErrUnknownObscode, b.obscode, 77,
+			"Obs80Builder: invalid observatory code (%s)", b.obscode)
+	}
+	copy(l[77:], b.obscode)
+	return string(l), nil
+}
+
+// blankZero returns c, or a blank if c is 0.
+func blankZero(c byte) byte {
+	if c == 0 {
+		return ' '
+	}
+	return c
+}
+
+// FormatObs80Date formats a date for the 17 character date field of 80
+// column observation records.
+//
+// Argument mjd is a modified Julian date.  The result has the format
+// "yyyy mm dd.ddddd" where decimals, limited to the range 0-5, is the number
+// of fractional day digits.  The result is padded with blanks to 17
+// characters.  ParseObs80Date is the inverse.
+func FormatObs80Date(mjd float64, decimals int) string {
+	switch {
+	case decimals < 0:
+		decimals = 0
+	case decimals > 5:
+		decimals = 5
+	}
+	d, _ := FormatObs80DatePrec(mjd, decimals)
+	return fmt.Sprintf("%-17s", d)
+}
+
+// FormatObs80DatePrec formats a date as FormatObs80Date but with decPlaces
+// decimal places of the day, in the range 0 to 6, and without padding.
+//
+// The result has 11+decPlaces characters, or 10 when decPlaces is 0.
+// An error is returned if decPlaces is out of range.
+func FormatObs80DatePrec(mjd float64, decPlaces int) (string, error) {
+	if decPlaces < 0 || decPlaces > 6 {
+		return "", newParseError(ErrInvalidField, fmt.Sprint(decPlaces), -1,
+			"FormatObs80DatePrec: Invalid decimal places (%d)", decPlaces)
+	}
+	p := math.Pow(10, float64(decPlaces))
+	y, m, d := MJDToCalendar(math.Floor(mjd*p+.5) / p)
+	w := 2
+	if decPlaces > 0 {
+		w += decPlaces + 1
+	}
+	return fmt.Sprintf("%04d %02d %0*.*f", y, m, w, decPlaces, d), nil
+}
+
+// FormatRA formats right ascension for the RA field of 80 column
+// observation records.
+//
+// Argument ra is in radians.  The result has the format "HH MM SS.SS"
+// padded with a blank to the 12 character field width.  Values that round
+// to 24h are given as 00h.
+func FormatRA(ra float64) string {
+	// hundredths of seconds of time
+	cs := int64(math.Floor(ra*12/math.Pi*360000 + .5))
+	if cs >= 24*360000 {
+		cs -= 24 * 360000
+	}
+	return fmt.Sprintf("%02d %02d %02d.%02d ",
+		cs/360000, cs/6000%60, cs/100%60, cs%100)
+}
+
+// FormatDec formats declination for the Dec field of 80 column observation
+// records.
+//
+// Argument dec is in radians.  The result is the 11 character string
+// "±DD MM SS.S".  A value that rounds to zero is given a plus sign.
+func FormatDec(dec float64) string {
+	// tenths of seconds of arc
+	ds := int64(math.Floor(math.Abs(dec)*180/math.Pi*36000 + .5))
+	sign := '+'
+	if dec < 0 && ds > 0 {
+		sign = '-'
+	}
+	return fmt.Sprintf("%c%02d %02d %02d.%d",
+		sign, ds/36000, ds/600%60, ds/10%60, ds%10)
+}
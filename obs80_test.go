@@ -3,9 +3,12 @@
 package mpcformat_test
 
 import (
+	"errors"
 	"fmt"
 	"math"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/soniakeys/coord"
 	"github.com/soniakeys/mpcformat"
@@ -23,7 +26,7 @@ func TestSiteObs(t *testing.T) {
 		t.Skip(pMapErr)
 	}
 	const obs = "     K11Q14F  C2014 09 03.40285 02 53 00.70 +10 38 30.3          19.2 VqER031703"
-	desig, o, err := mpcformat.ParseObs80(obs, pMap)
+	desig, o, err := mpcformat.ParseObs80(obs, mpcformat.ParallaxMapResolver(pMap))
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -63,7 +66,7 @@ func TestSatObs(t *testing.T) {
 	if pMapErr != nil {
 		t.Skip(pMapErr)
 	}
-	desig, o, err := mpcformat.ParseObs80(tcSatLine1, pMap)
+	desig, o, err := mpcformat.ParseObs80(tcSatLine1, mpcformat.ParallaxMapResolver(pMap))
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -102,3 +105,598 @@ func TestSatObs(t *testing.T) {
 		t.Fatalf("ParseSat2 obs = %+v, want %+v", so, want)
 	}
 }
+
+func TestParseObs80SmallNegDec(t *testing.T) {
+	if pMapErr != nil {
+		t.Skip(pMapErr)
+	}
+	const line = "     K11Q14F  C2014 09 03.40285 02 53 00.70 -00 00 30.0          19.2 V      703"
+	_, o, err := mpcformat.ParseObs80(line, mpcformat.ParallaxMapResolver(pMap))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := o.Meas().Dec.Sec(); math.Abs(d+30) > 1e-9 {
+		t.Fatalf("Dec = %g\", want -30\"", d)
+	}
+	got, err := mpcformat.FormatObs80("K11Q14F", o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != line {
+		t.Fatalf("FormatObs80 =\n%s\nwant\n%s", got, line)
+	}
+}
+
+func TestFormatObs80(t *testing.T) {
+	if pMapErr != nil {
+		t.Skip(pMapErr)
+	}
+	for _, tc := range []struct{ in, want string }{
+		{"     K11Q14F  C2014 09 03.40285 02 53 00.70 +10 38 30.3          19.2 VqER031703",
+			"     K11Q14F  C2014 09 03.40285 02 53 00.70 +10 38 30.3          19.2 V      703"},
+		{o1[:80],
+			"     NE00030  C2004 09 16.15206 16 13 11.57 +20 52 23.7          21.1 V      291"},
+		{tcSatLine1,
+			"03620         S1996 08 30.51477 21 07 31.92 -05 22 00.8                      250"},
+	} {
+		desig, o, err := mpcformat.ParseObs80(tc.in, mpcformat.ParallaxMapResolver(pMap))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := mpcformat.FormatObs80(desig, o)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tc.want {
+			t.Fatalf("FormatObs80 =\n%s\nwant\n%s", got, tc.want)
+		}
+	}
+	_, o, _ := mpcformat.ParseObs80(tcSatLine1, mpcformat.ParallaxMapResolver(pMap))
+	if _, err := mpcformat.FormatObs80("1234567890123", o); err == nil {
+		t.Fatal("FormatObs80 accepted long designation")
+	}
+	o.Meas().Dec = 2
+	if _, err := mpcformat.FormatObs80("03620", o); err == nil {
+		t.Fatal("FormatObs80 accepted Dec out of range")
+	}
+}
+
+func TestParseObs80Full(t *testing.T) {
+	if pMapErr != nil {
+		t.Skip(pMapErr)
+	}
+	f, err := mpcformat.ParseObs80Full(tcSatLine1, pMap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Desig != "03620" || f.Discovery != ' ' || f.Note1 != ' ' ||
+		f.Note2 != 'S' {
+		t.Fatalf("ParseObs80Full = %+v", f)
+	}
+	if _, ok := f.Obs.(*observation.SatObs); !ok {
+		t.Fatalf("ParseObs80Full Obs type %T, want *observation.SatObs", f.Obs)
+	}
+	const disc = "     K14G49E* C2014 04 09.45004 16 29 34.386+18 18 53.97         19.3 iL~133C703"
+	if d, err := mpcformat.ParseObs80DiscoveryFlag(disc); err != nil || d != '*' {
+		t.Fatalf("ParseObs80DiscoveryFlag = %q, %v, want '*'", d, err)
+	}
+	if _, err := mpcformat.ParseObs80DiscoveryFlag(disc[:40]); err == nil {
+		t.Fatal("ParseObs80DiscoveryFlag accepted short line")
+	}
+	f, err = mpcformat.ParseObs80Full(disc, pMap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.OrigMag != 19.3 || f.Band != 'i' ||
+		math.Abs(f.Obs.Meas().VMag-19.7) > 1e-9 {
+		t.Fatalf("ParseObs80Full mag = %g %q, VMag %g, want 19.3 'i', 19.7",
+			f.OrigMag, f.Band, f.Obs.Meas().VMag)
+	}
+	n1, n2, err := mpcformat.ParseObs80Notes(disc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n1 != ' ' || n2 != 'C' {
+		t.Fatalf("ParseObs80Notes = %q, %q, want ' ', 'C'", n1, n2)
+	}
+}
+
+const (
+	tcRovLine1 = "     K08K42F  V2008 05 29.31938 15 35 25.23 -15 47 39.5          16.9 V      247"
+	tcRovLine2 = "     K08K42F  v2008 05 29.31938   248.904000 +32.417000  2525                247"
+)
+
+func TestRovingObs(t *testing.T) {
+	if pMapErr != nil {
+		t.Skip(pMapErr)
+	}
+	desig, o, err := mpcformat.ParseObs80(tcRovLine1, mpcformat.ParallaxMapResolver(pMap))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, ok := o.(*mpcformat.RovingObs)
+	if !ok {
+		t.Fatalf("Want *mpcformat.RovingObs from ParseObs80, got %T", o)
+	}
+	if err = mpcformat.ParseRoving2(tcRovLine2, desig, r); err != nil {
+		t.Fatal(err)
+	}
+	if r.Lon != 248.904 || r.Lat != 32.417 || r.Alt != 2525 || r.Qual != "247" {
+		t.Fatalf("ParseRoving2 obs = %+v", r)
+	}
+	v := r.EarthObserverVect()
+	if math.Abs(v.Z-2.2733681829087328e-05) > 1e-15 ||
+		math.Abs(math.Hypot(v.X, v.Y)-3.6040239672430096e-05) > 1e-15 {
+		t.Fatalf("EarthObserverVect = %+v", v)
+	}
+}
+
+func TestParseLine2Note(t *testing.T) {
+	s := &observation.SatObs{}
+	r := &mpcformat.RovingObs{}
+	for _, tc := range []struct {
+		line, kind string
+		parse      func(string) error
+	}{
+		{tcRovLine2, "roving", func(l string) error {
+			return mpcformat.ParseSat2(l, "03620", s)
+		}},
+		{tcSatLine2, "sat", func(l string) error {
+			return mpcformat.ParseRoving2(l, "K08K42F", r)
+		}},
+		{tcSatLine2[:14] + "x" + tcSatLine2[15:], "want s", func(l string) error {
+			return mpcformat.ParseSat2(l, "03620", s)
+		}},
+		{tcRovLine2[:14] + "S" + tcRovLine2[15:], "want v", func(l string) error {
+			return mpcformat.ParseRoving2(l, "K08K42F", r)
+		}},
+	} {
+		err := tc.parse(tc.line)
+		var pe *mpcformat.ParseError
+		if !errors.As(err, &pe) || pe.Kind != mpcformat.ErrInvalidField ||
+			pe.Position != 14 || !strings.Contains(err.Error(), tc.kind) {
+			t.Errorf("line 2 %q: error %v, want note 2 error with %q",
+				tc.line, err, tc.kind)
+		}
+	}
+}
+
+func TestParseObs80WithBands(t *testing.T) {
+	if pMapErr != nil {
+		t.Skip(pMapErr)
+	}
+	// o3 line 1 has mag 21.4 V
+	line := o3[:70] + "R" + o3[71:80]
+	for _, tc := range []struct {
+		bands mpcformat.BandCorrectionTable
+		want  float64
+	}{
+		{nil, 21.4},
+		{mpcformat.DefaultBandCorrections, 21.2},
+		{mpcformat.BandCorrectionTable{'V': 0}, 21.4},
+		{mpcformat.BandCorrectionTable{0: .3}, 21.7},
+	} {
+		_, o, err := mpcformat.ParseObs80WithBands(line, pMap, tc.bands)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m := o.Meas().VMag; math.Abs(m-tc.want) > 1e-10 {
+			t.Fatalf("bands %v VMag = %g, want %g", tc.bands, m, tc.want)
+		}
+	}
+	// ParseObs80 is unchanged
+	_, o, _ := mpcformat.ParseObs80(line, mpcformat.ParallaxMapResolver(pMap))
+	if m := o.Meas().VMag; math.Abs(m-21.8) > 1e-10 {
+		t.Fatalf("ParseObs80 R VMag = %g, want 21.8", m)
+	}
+}
+
+func TestFormatObs80Date(t *testing.T) {
+	for _, tc := range []struct {
+		mjd  float64
+		dec  int
+		want string
+	}{
+		{56904.8, 5, "2014 09 04.80000 "},
+		{56904.8, 1, "2014 09 04.8     "},
+		{56904.8, 0, "2014 09 05       "},
+		{51544.5, 3, "2000 01 01.500   "}, // J2000
+		{50325.51477, 5, "1996 08 30.51477 "},
+		{0, 2, "1858 11 17.00    "},
+		{-100000, 0, "1585 02 01       "},
+		{56930.999999, 5, "2014 10 01.00000 "},
+	} {
+		got := mpcformat.FormatObs80Date(tc.mjd, tc.dec)
+		if got != tc.want {
+			t.Fatalf("FormatObs80Date(%g, %d) = %q, want %q",
+				tc.mjd, tc.dec, got, tc.want)
+		}
+		if mjd, ok := mpcformat.ParseObs80Date(got); !ok ||
+			math.Abs(mjd-tc.mjd) > .5*math.Pow(10, -float64(tc.dec)) {
+			t.Fatalf("ParseObs80Date(%q) = %g, %t", got, mjd, ok)
+		}
+	}
+}
+
+func TestFormatObs80DatePrec(t *testing.T) {
+	for dp, want := range []string{
+		"2014 09 04",
+		"2014 09 03.9",
+		"2014 09 03.87",
+		"2014 09 03.868",
+		"2014 09 03.8681",
+		"2014 09 03.86806",
+		"2014 09 03.868056",
+	} {
+		got, err := mpcformat.FormatObs80DatePrec(56903.868056, dp)
+		if err != nil || got != want {
+			t.Fatalf("FormatObs80DatePrec(%d) = %q, %v, want %q",
+				dp, got, err, want)
+		}
+		if mjd, ok := mpcformat.ParseObs80Date(got); !ok ||
+			math.Abs(mjd-56903.868056) > .5*math.Pow(10, -float64(dp)) {
+			t.Fatalf("ParseObs80Date(%q) = %g, %t", got, mjd, ok)
+		}
+	}
+	for _, dp := range []int{-1, 7} {
+		if _, err := mpcformat.FormatObs80DatePrec(0, dp); err == nil {
+			t.Fatalf("FormatObs80DatePrec accepted %d places", dp)
+		}
+	}
+}
+
+func TestParseObs80DateTime(t *testing.T) {
+	for _, tc := range []struct {
+		d    string
+		want time.Time
+	}{
+		{"2014 09 03.40285", time.Date(2014, 9, 3, 9, 40, 6, 240e6, time.UTC)},
+		{"1858 11 17", time.Date(1858, 11, 17, 0, 0, 0, 0, time.UTC)},
+		{"2000 01 01.5", time.Date(2000, 1, 1, 12, 0, 0, 0, time.UTC)},
+		{"1801 01 01.25", time.Date(1801, 1, 1, 6, 0, 0, 0, time.UTC)},
+	} {
+		got, ok := mpcformat.ParseObs80DateTime(tc.d)
+		if !ok || !got.Equal(tc.want) {
+			t.Fatalf("ParseObs80DateTime(%q) = %v, %t, want %v",
+				tc.d, got, ok, tc.want)
+		}
+	}
+	for _, bad := range []string{"2014 09", "2014 xx 03.4", "2014 09 zz"} {
+		if _, ok := mpcformat.ParseObs80DateTime(bad); ok {
+			t.Fatalf("ParseObs80DateTime(%q) ok", bad)
+		}
+	}
+}
+
+func TestValidateObs80Line(t *testing.T) {
+	if errs := mpcformat.ValidateObs80Line(o1[:80], pMap); errs != nil {
+		t.Fatalf("valid line: %v", errs)
+	}
+	if errs := mpcformat.ValidateObs80Line(short[:len(short)-1], nil); len(errs) != 1 ||
+		errs[0].Field != "line" {
+		t.Fatalf("short line: %v", errs)
+	}
+	// bad RA minutes, bad mag, unknown obscode
+	line := o1[:35] + "73" + o1[37:65] + "21.x" + o1[69:77] + "xyz"
+	errs := mpcformat.ValidateObs80Line(line, pMap)
+	if len(errs) != 3 || errs[0].Col != 32 || errs[1].Col != 65 ||
+		errs[2].Col != 77 {
+		t.Fatalf("bad line: %v", errs)
+	}
+	if errs = mpcformat.ValidateObs80Line(line, nil); len(errs) != 2 {
+		t.Fatalf("bad line, no obscode check: %v", errs)
+	}
+}
+
+func TestFormatRADec(t *testing.T) {
+	for _, tc := range []struct {
+		ra   float64
+		want string
+	}{
+		{0, "00 00 00.00 "},
+		{0.7549058069240641, "02 53 00.70 "},
+		{2*math.Pi - 1e-9, "00 00 00.00 "},
+		{2*math.Pi - 1e-5, "23 59 59.86 "},
+	} {
+		if got := mpcformat.FormatRA(tc.ra); got != tc.want {
+			t.Fatalf("FormatRA(%g) = %q, want %q", tc.ra, got, tc.want)
+		}
+	}
+	for _, tc := range []struct {
+		dec  float64
+		want string
+	}{
+		{0.1857335756741066, "+10 38 30.3"},
+		{-0.09366997866254745, "-05 22 00.8"},
+		{-1e-9, "+00 00 00.0"},
+		{math.Pi/2 - 1e-9, "+90 00 00.0"},
+		{-math.Pi / 2, "-90 00 00.0"},
+	} {
+		if got := mpcformat.FormatDec(tc.dec); got != tc.want {
+			t.Fatalf("FormatDec(%g) = %q, want %q", tc.dec, got, tc.want)
+		}
+	}
+}
+
+func ExampleObs80Builder() {
+	line, err := new(mpcformat.Obs80Builder).
+		SetDesig("K11Q14F").
+		SetDate(56903.40285).
+		SetRA(0.7549058069240641).
+		SetDec(0.1857335756741066).
+		SetMag(19.2, 'V').
+		SetObscode("703").
+		Build()
+	fmt.Printf("%q %v\n", line, err)
+	_, err = new(mpcformat.Obs80Builder).SetDesig("K11Q14F").Build()
+	fmt.Println(err)
+	// Output:
+	// "     K11Q14F  C2014 09 03.40285 02 53 00.70 +10 38 30.3          19.2 V      703" <nil>
+	// Obs80Builder: date not set
+}
+
+func TestParseObs80Flags(t *testing.T) {
+	b := new(mpcformat.Obs80Builder).
+		SetDate(56903.40285).
+		SetRA(0.7549058069240641).
+		SetDec(0.1857335756741066).
+		SetObscode("703")
+	for _, tc := range []struct{ disc, unc bool }{
+		{false, false}, {true, false}, {false, true},
+	} {
+		line, err := b.SetFlags(tc.disc, tc.unc).Build()
+		if err != nil {
+			t.Fatal(err)
+		}
+		disc, unc, err := mpcformat.ParseObs80Flags(line)
+		if err != nil || disc != tc.disc || unc != tc.unc {
+			t.Fatalf("ParseObs80Flags(%q) = %t, %t, %v", line, disc, unc, err)
+		}
+	}
+	if _, err := b.SetFlags(true, true).Build(); err == nil {
+		t.Fatal("Build accepted discovery and uncertain flags")
+	}
+	if _, _, err := mpcformat.ParseObs80Flags("short"); err == nil {
+		t.Fatal("ParseObs80Flags accepted short line")
+	}
+}
+
+func TestParseObs80MagStrict(t *testing.T) {
+	const line = "     K11Q14F  C2014 09 03.40285 02 53 00.70 +10 38 30.3          19.2 V      703"
+	for _, tc := range []struct {
+		mag     string
+		want    float64
+		wantHas bool
+	}{
+		{"19.2 V", 19.2, true},
+		{"      ", 0, false},
+		{" 0.0 V", 0, true},
+		{"19.2 B", 18.4, true},
+	} {
+		l := line[:65] + tc.mag + line[71:]
+		m, has, err := mpcformat.ParseObs80MagStrict(l)
+		if err != nil || has != tc.wantHas || math.Abs(m-tc.want) > 1e-10 {
+			t.Fatalf("ParseObs80MagStrict(%q) = %g, %t, %v", tc.mag, m, has, err)
+		}
+	}
+	if _, _, err := mpcformat.ParseObs80MagStrict(line[:65] + "19.x V" +
+		line[71:]); err == nil {
+		t.Fatal("ParseObs80MagStrict accepted 19.x")
+	}
+}
+
+type countResolver struct {
+	mpcformat.ParallaxMapResolver
+	n int
+}
+
+func (r *countResolver) Resolve(code string) (*observation.ParallaxConst, bool) {
+	r.n++
+	return r.ParallaxMapResolver.Resolve(code)
+}
+
+func TestParseObs80ObscodeResolver(t *testing.T) {
+	if pMapErr != nil {
+		t.Skip(pMapErr)
+	}
+	r := &countResolver{ParallaxMapResolver: mpcformat.ParallaxMapResolver(pMap)}
+	_, o, err := mpcformat.ParseObs80(tcSatLine1, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := o.(*observation.SatObs); !ok || r.n != 1 {
+		t.Fatalf("ParseObs80 = %T, %d lookups", o, r.n)
+	}
+	r.ParallaxMapResolver = nil
+	if _, _, err = mpcformat.ParseObs80(tcSatLine1, r); err == nil {
+		t.Fatal("ParseObs80 accepted unknown code")
+	}
+}
+
+func TestIsNEOCPDesig(t *testing.T) {
+	for _, tc := range []struct {
+		desig string
+		want  bool
+	}{
+		{"P10yv7l", true},
+		{"ZTF0Abc", true},
+		{"NE00030", true},
+		{"A1", true},
+		{"K08K42F", false}, // packed provisional
+		{"PLS2040", false}, // packed survey
+		{"A0345", false},   // packed number
+		{"00433", false},
+		{"7abc", false},
+		{"P10yv7l8", false},
+		{"P10-v7l", false},
+		{"", false},
+	} {
+		if got := mpcformat.IsNEOCPDesig(tc.desig); got != tc.want {
+			t.Errorf("IsNEOCPDesig(%q) = %t, want %t", tc.desig, got, tc.want)
+		}
+	}
+}
+
+func TestParseNEOCPObs80(t *testing.T) {
+	if pMapErr != nil {
+		t.Skip(pMapErr)
+	}
+	line := strings.TrimSuffix(o1, "\n")
+	desig, _, err := mpcformat.ParseNEOCPObs80(line, pMap)
+	if err != nil || desig != o1Desig {
+		t.Fatalf("ParseNEOCPObs80 = %q, %v", desig, err)
+	}
+	line = line[:5] + "K08K42F" + line[12:]
+	if _, _, err = mpcformat.ParseNEOCPObs80(line, pMap); err == nil {
+		t.Fatal("ParseNEOCPObs80 accepted packed provisional designation")
+	}
+}
+
+func TestParseObs80Options(t *testing.T) {
+	if pMapErr != nil {
+		t.Skip(pMapErr)
+	}
+	line := strings.TrimSuffix(o1, "\n")
+	line = line[:12] + "*K" + line[14:]
+	f, err := mpcformat.ParseObs80Full(line, pMap,
+		mpcformat.WithStrictMode(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := f.Obs.(*observation.SiteObs); !ok ||
+		f.Note1 != 'K' || f.Discovery != '*' {
+		t.Fatalf("ParseObs80Full = %T %q %q", f.Obs, f.Note1, f.Discovery)
+	}
+	for _, tc := range []struct {
+		opt         mpcformat.ParseObs80Option
+		note1, disc byte
+	}{
+		{mpcformat.WithProgramCode(false), 0, '*'},
+		{mpcformat.WithDiscoveryFlag(false), 'K', 0},
+	} {
+		f, err = mpcformat.ParseObs80Full(line, pMap, tc.opt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := f.Obs.(*observation.SiteObs); !ok ||
+			f.Note1 != tc.note1 || f.Discovery != tc.disc {
+			t.Fatalf("ParseObs80Full = %T %q %q, want %q %q",
+				f.Obs, f.Note1, f.Discovery, tc.note1, tc.disc)
+		}
+	}
+	// options do not change the observation type from ParseObs80
+	_, o, err := mpcformat.ParseObs80(line, mpcformat.ParallaxMapResolver(pMap),
+		mpcformat.WithProgramCode(true), mpcformat.WithDiscoveryFlag(true))
+	if _, ok := o.(*observation.SiteObs); err != nil || !ok {
+		t.Fatalf("ParseObs80 with capture options: %T, %v", o, err)
+	}
+	_, o, err = mpcformat.ParseObs80(line, mpcformat.ParallaxMapResolver(pMap),
+		mpcformat.WithBandCorrections(mpcformat.BandCorrectionTable{'V': 1}))
+	if err != nil || o.Meas().VMag != 22.1 {
+		t.Fatalf("WithBandCorrections: %v, %v", o, err)
+	}
+	for _, bad := range []string{
+		line[:32] + "24" + line[34:],
+		line[:35] + "60" + line[37:],
+		line[:44] + " 20" + line[47:],
+		line[:45] + "91" + line[47:],
+		line[:51] + "60.0" + line[55:],
+		line[:23] + "32.15206" + line[31:],
+	} {
+		if _, _, err := mpcformat.ParseObs80(bad, mpcformat.ParallaxMapResolver(pMap)); err != nil {
+			t.Fatalf("%q rejected without strict mode: %v", bad, err)
+		}
+		_, _, err := mpcformat.ParseObs80(bad, mpcformat.ParallaxMapResolver(pMap),
+			mpcformat.WithStrictMode(true))
+		if err == nil {
+			t.Errorf("strict mode accepted %q", bad)
+		}
+	}
+}
+
+// benchObs80Lines is a representative number of observation lines.
+const benchObs80Lines = 10000
+
+func BenchmarkParseObs80(b *testing.B) {
+	if pMapErr != nil {
+		b.Skip(pMapErr)
+	}
+	lines := strings.Split(strings.TrimSuffix(o1+o2+o3, "\n"), "\n")
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for j := 0; j < benchObs80Lines; j++ {
+			if _, _, err := mpcformat.ParseObs80(lines[j%len(lines)],
+				mpcformat.ParallaxMapResolver(pMap)); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func TestParseObs80Into(t *testing.T) {
+	if pMapErr != nil {
+		t.Skip(pMapErr)
+	}
+	line := strings.TrimSuffix(o1, "\n")
+	r := mpcformat.ParallaxMapResolver(pMap)
+	var res mpcformat.Obs80Result
+	if err := mpcformat.ParseObs80Into(line, r, &res); err != nil {
+		t.Fatal(err)
+	}
+	_, o, _ := mpcformat.ParseObs80(line, mpcformat.ParallaxMapResolver(pMap))
+	m := o.Meas()
+	if res.Desig != o1Desig || res.Obscode != "291" || res.Par != pMap["291"] ||
+		res.Note2 != 'C' || res.MJD != m.MJD || res.RA != m.RA ||
+		res.Dec != m.Dec || res.VMag != m.VMag {
+		t.Fatalf("got %+v", res)
+	}
+	if n := testing.AllocsPerRun(100, func() {
+		mpcformat.ParseObs80Into(line, r, &res)
+	}); n != 0 {
+		t.Fatalf("%g allocations", n)
+	}
+	err := mpcformat.ParseObs80Into(line[:77]+"zzz", r, &res)
+	if !errors.Is(err, mpcformat.ErrUnknownObscode) {
+		t.Fatalf("err = %v", err)
+	}
+}
+
+func TestParseObs80Degrees(t *testing.T) {
+	if pMapErr != nil {
+		t.Skip(pMapErr)
+	}
+	r := mpcformat.ParallaxMapResolver(pMap)
+	d, o, err := mpcformat.ParseObs80Degrees(strings.TrimSuffix(o1, "\n"), r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 16 13 11.57 +20 52 23.7
+	if d != o1Desig || o.ObsCode != "291" || o.VMag != 21.1 ||
+		math.Abs(o.RADeg-(16+13/60.+11.57/3600)*15) > 1e-9 ||
+		math.Abs(o.DecDeg-(20+52/60.+23.7/3600)) > 1e-9 {
+		t.Fatalf("got %s %+v", d, o)
+	}
+	if _, _, err = mpcformat.ParseObs80Degrees(bad, r); err == nil {
+		t.Fatal("no error for bad line")
+	}
+}
+
+func BenchmarkParseObs80Into(b *testing.B) {
+	if pMapErr != nil {
+		b.Skip(pMapErr)
+	}
+	lines := strings.Split(strings.TrimSuffix(o1+o2+o3, "\n"), "\n")
+	r := mpcformat.ParallaxMapResolver(pMap)
+	var res mpcformat.Obs80Result
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for j := 0; j < benchObs80Lines; j++ {
+			if err := mpcformat.ParseObs80Into(lines[j%len(lines)], r,
+				&res); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
@@ -0,0 +1,96 @@
+// Public domain.
+
+package mpcformat
+
+import (
+	"math"
+
+	"github.com/soniakeys/observation"
+	"github.com/soniakeys/unit"
+)
+
+// tolerances for IsDuplicateObs80
+const (
+	dupMJD = 1.16e-5                    // 1 second, in days
+	dupSep = 5 * math.Pi / (180 * 3600) // 5 arc seconds, in radians
+)
+
+// anyObscode is an ObscodeResolver that accepts any code.
+type anyObscode struct{}
+
+func (anyObscode) Resolve(string) (*observation.ParallaxConst, bool) {
+	return nil, true
+}
+
+// IsDuplicateObs80 returns true if 80 column observation lines a and b
+// represent the same measurement.
+//
+// Lines are duplicates if they have the same designation and observatory
+// code, times within 1 second, and positions within 5 arc seconds.  Other
+// fields such as magnitude and notes are not compared.  Lines that cannot
+// be parsed are duplicates only if identical.
+func IsDuplicateObs80(a, b string) bool {
+	if a == b {
+		return true
+	}
+	if len(a) != 80 || len(b) != 80 ||
+		a[:12] != b[:12] || a[77:80] != b[77:80] {
+		return false
+	}
+	_, oa, err := parseObs80(a, anyObscode{}, &parseObs80Config{})
+	if err != nil {
+		return false
+	}
+	_, ob, err := parseObs80(b, anyObscode{}, &parseObs80Config{})
+	if err != nil {
+		return false
+	}
+	return isDupMeas(oa.Meas(), ob.Meas())
+}
+
+func isDupMeas(a, b *observation.VMeas) bool {
+	return math.Abs(a.MJD-b.MJD) < dupMJD &&
+		angSep(a.RA.Angle(), a.Dec, b.RA.Angle(), b.Dec) <= dupSep
+}
+
+// angSep returns the angular separation between two points, by the
+// haversine formula.
+func angSep(r1, d1, r2, d2 unit.Angle) float64 {
+	hd := math.Sin((d2 - d1).Rad() / 2)
+	hr := math.Sin((r2 - r1).Rad() / 2)
+	return 2 * math.Asin(math.Sqrt(hd*hd+d1.Cos()*d2.Cos()*hr*hr))
+}
+
+// DeduplicateObs80Lines returns lines with duplicates removed, keeping the
+// first occurrence.  Duplicates are determined as by IsDuplicateObs80.
+//
+// Lines are returned in their original order.  The input slice is not
+// modified.
+func DeduplicateObs80Lines(lines []string) []string {
+	type kept struct {
+		line string
+		m    *observation.VMeas // nil if line could not be parsed
+	}
+	// kept lines grouped by designation and obscode
+	groups := map[string][]kept{}
+	var out []string
+lines:
+	for _, l := range lines {
+		key := l
+		if len(l) == 80 {
+			key = l[:12] + l[77:80]
+		}
+		var m *observation.VMeas
+		if _, o, err := parseObs80(l, anyObscode{}, &parseObs80Config{}); err == nil {
+			m = o.Meas()
+		}
+		for _, k := range groups[key] {
+			if k.line == l || m != nil && k.m != nil && isDupMeas(m, k.m) {
+				continue lines
+			}
+		}
+		groups[key] = append(groups[key], kept{l, m})
+		out = append(out, l)
+	}
+	return out
+}
@@ -0,0 +1,37 @@
+// Public domain.
+
+package mpcformat_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/soniakeys/mpcformat"
+)
+
+func TestDeduplicateObs80Lines(t *testing.T) {
+	const (
+		a = "     K11Q14F  C2014 09 03.40285 02 53 00.70 +10 38 30.3          19.2 V      703"
+		// half second later, 3" away, different mag
+		b = "     K11Q14F  C2014 09 03.40286 02 53 00.70 +10 38 33.3          19.5 R      703"
+		// 10" away
+		c = "     K11Q14F  C2014 09 03.40285 02 53 00.70 +10 38 40.3          19.2 V      703"
+		// 2 seconds later
+		d = "     K11Q14F  C2014 09 03.40288 02 53 00.70 +10 38 30.3          19.2 V      703"
+		// different obscode
+		e = "     K11Q14F  C2014 09 03.40285 02 53 00.70 +10 38 30.3          19.2 V      704"
+	)
+	for _, tc := range []struct {
+		a, b string
+		want bool
+	}{{a, a, true}, {a, b, true}, {a, c, false}, {a, d, false}, {a, e, false},
+		{"junk", "junk", true}, {"junk", a, false}} {
+		if got := mpcformat.IsDuplicateObs80(tc.a, tc.b); got != tc.want {
+			t.Errorf("IsDuplicateObs80(%q, %q) = %t", tc.a, tc.b, got)
+		}
+	}
+	got := mpcformat.DeduplicateObs80Lines([]string{a, c, b, d, a, e, c})
+	if want := []string{a, c, d, e}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("DeduplicateObs80Lines = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,316 @@
+// Public domain.
+
+package mpcformat
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/soniakeys/coord"
+	"github.com/soniakeys/observation"
+)
+
+var errLine2 = errors.New("observation line 2 without line 1")
+
+// obs80LineError is a parse error of an Obs80Scanner.
+type obs80LineError struct {
+	n   int // line number
+	err error
+}
+
+func (e *obs80LineError) Error() string {
+	return fmt.Sprintf("line %d: %v", e.n, e.err)
+}
+
+// ParsedObs80 is a single parsed observation.
+type ParsedObs80 struct {
+	Desig string
+	Obs   observation.VObs
+}
+
+// Obs80Scanner reads observations in the MPC 80 column format.
+//
+// Usage is similar to bufio.Scanner.  Successive calls to Scan step through
+// the observations of the input.  Blank lines are ignored.  The second line
+// of a two-line satellite or roving observation is parsed into the
+// observation of the first line, which is then returned as a single
+// observation.
+//
+// Errors parsing a line do not stop scanning.  For a line that cannot be
+// parsed, Scan returns true, Observation returns a nil observation, and Err
+// returns the parse error.  A line 1 followed by a bad line 2 is dropped
+// along with the line 2.  A line 2 not following a line 1 of its kind is a
+// line error, returned after any preceding observation.  Scan returns false at EOF or on a read error,
+// after which Err returns the read error, or nil at EOF.
+type Obs80Scanner struct {
+	s       *bufio.Scanner
+	ocm     ObscodeResolver
+	n       int               // line number
+	pend    *ParsedObs80      // line 1 waiting for a possible line 2
+	pendErr error             // line error to return after pend
+	keep    func(string) bool // designation filter, or nil
+	cur     ParsedObs80
+	err     error
+}
+
+// NewObs80Scanner returns a new Obs80Scanner reading from r.
+//
+// Observatory codes are looked up in ocm.
+func NewObs80Scanner(r io.Reader, ocm observation.ParallaxMap) *Obs80Scanner {
+	return newObs80Scanner(r, ParallaxMapResolver(ocm))
+}
+
+func newObs80Scanner(r io.Reader, ocm ObscodeResolver) *Obs80Scanner {
+	return &Obs80Scanner{s: bufio.NewScanner(r), ocm: ocm}
+}
+
+// Scan advances to the next observation or line error.
+func (sc *Obs80Scanner) Scan() bool {
+	sc.cur = ParsedObs80{}
+	sc.err = nil
+	if sc.pendErr != nil {
+		sc.err, sc.pendErr = sc.pendErr, nil
+		return true
+	}
+	for sc.s.Scan() {
+		sc.n++
+		line := sc.s.Text()
+		if len(line) == 0 {
+			continue
+		}
+		if len(line) == 80 && sc.keep != nil &&
+			!sc.keep(strings.TrimSpace(line[:12])) {
+			continue
+		}
+		if len(line) == 80 && (line[14] == 's' || line[14] == 'v') {
+			var err error
+			waiting := false // pend is a line 1 of this kind of line 2
+			if p := sc.pend; p != nil {
+				switch o := p.Obs.(type) {
+				case *observation.SatObs:
+					if waiting = line[14] == 's'; waiting {
+						err = ParseSat2(line, p.Desig, o)
+					}
+				case *RovingObs:
+					if waiting = line[14] == 'v'; waiting {
+						err = ParseRoving2(line, p.Desig, o)
+					}
+				}
+			}
+			switch {
+			case !waiting:
+				// orphan line 2.  any pending observation is still good.
+				err = &obs80LineError{sc.n, errLine2}
+				if sc.pend == nil {
+					sc.err = err
+					return true
+				}
+				sc.cur, sc.pend, sc.pendErr = *sc.pend, nil, err
+			case err != nil:
+				sc.pend = nil // line 1 is no good without line 2
+				sc.err = &obs80LineError{sc.n, err}
+			default:
+				sc.cur, sc.pend = *sc.pend, nil
+			}
+			return true
+		}
+		prev := sc.pend
+		sc.pend = nil
+		desig, o, err := ParseObs80(line, sc.ocm)
+		if err != nil {
+			err = &obs80LineError{sc.n, err}
+			if prev == nil {
+				sc.err = err
+				return true
+			}
+			sc.pendErr = err
+		} else {
+			sc.pend = &ParsedObs80{desig, o}
+		}
+		if prev != nil {
+			sc.cur = *prev
+			return true
+		}
+	}
+	if sc.pend != nil {
+		sc.cur, sc.pend = *sc.pend, nil
+		return true
+	}
+	sc.err = sc.s.Err()
+	return false
+}
+
+// Observation returns the observation parsed by the most recent call to
+// Scan.  The observation is nil if Scan stopped at a line error.
+func (sc *Obs80Scanner) Observation() (desig string, o observation.VObs) {
+	return sc.cur.Desig, sc.cur.Obs
+}
+
+// Err returns the line error of the most recent call to Scan, or after
+// Scan returns false, the read error if any.
+func (sc *Obs80Scanner) Err() error {
+	return sc.err
+}
+
+// ParseObs80Stream parses a stream of observations in the MPC 80 column
+// format, sending each observation on the first returned channel.
+//
+// Parsing runs in a goroutine.  Parse errors are sent on the error channel
+// and parsing continues with the next line.  Lines are handled as by
+// Obs80Scanner.  Both channels are closed when r is exhausted or on a read
+// error, which is sent on the error channel.
+//
+// The caller must receive from both channels until both are closed.
+func ParseObs80Stream(r io.Reader, ocm observation.ParallaxMap) (<-chan ParsedObs80, <-chan error) {
+	oc := make(chan ParsedObs80)
+	ec := make(chan error)
+	go func() {
+		defer close(ec)
+		defer close(oc)
+		sc := NewObs80Scanner(r, ocm)
+		for sc.Scan() {
+			if desig, o := sc.Observation(); o != nil {
+				oc <- ParsedObs80{desig, o}
+			} else {
+				ec <- sc.Err()
+			}
+		}
+		if err := sc.Err(); err != nil {
+			ec <- err
+		}
+	}()
+	return oc, ec
+}
+
+// WriteObs80Stream writes arcs to w in the MPC 80 column format.
+//
+// Observations are written grouped by arc and sorted by MJD within each
+// arc.  Arcs are not modified.  Observations are formatted as with
+// FormatObs80, except that an *observation.SatObs is written as two lines,
+// line 2 holding the offset.
+//
+// An error is returned if a designation is longer than 12 characters, if a
+// SatObs has a zero offset, or if an observation cannot be formatted.
+func WriteObs80Stream(w io.Writer, arcs []*observation.Arc) error {
+	for _, a := range arcs {
+		if len(a.Desig) > 12 {
+			return fmt.Errorf("WriteObs80Stream: Invalid designation (%s)",
+				a.Desig)
+		}
+		obs := append([]observation.VObs{}, a.Obs...)
+		sort.SliceStable(obs, func(i, j int) bool {
+			return obs[i].Meas().MJD < obs[j].Meas().MJD
+		})
+		for _, o := range obs {
+			s, sat := o.(*observation.SatObs)
+			if sat && s.Offset == (coord.Cart{}) {
+				return fmt.Errorf("WriteObs80Stream: Missing satellite "+
+					"offset (%s %s)", a.Desig, s.Sat)
+			}
+			line, err := FormatObs80(a.Desig, o)
+			if err != nil {
+				return err
+			}
+			line += "\n"
+			if sat {
+				line += formatSat2(line, s) + "\n"
+			}
+			if _, err := io.WriteString(w, line); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// ProcessedObs is a result of TransformObs80Parallel.
+type ProcessedObs struct {
+	Index int // index of the observation in the input
+	Desig string
+	Obs   observation.VObs
+}
+
+// TransformObs80Parallel reads observations of r as with Obs80Scanner and
+// transforms each with fn, running fn on the given number of worker
+// goroutines.
+//
+// Observatory codes are looked up with ocm.  Results are returned in input
+// order, one for each observation.  On the first parse or read error, or
+// error from fn, processing stops and the error is returned.  Of errors
+// from fn, the one for the earliest observation processed is returned.
+func TransformObs80Parallel(r io.Reader, ocm ObscodeResolver, workers int,
+	fn func(string, observation.VObs) (string, observation.VObs, error)) ([]ProcessedObs, error) {
+	if workers < 1 {
+		workers = 1
+	}
+	type result struct {
+		p   ProcessedObs
+		err error
+	}
+	jobs := make(chan ProcessedObs)
+	res := make(chan result)
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				d, o, err := fn(j.Desig, j.Obs)
+				res <- result{ProcessedObs{j.Index, d, o}, err}
+			}
+		}()
+	}
+	var scanErr error
+	go func() {
+		sc := newObs80Scanner(r, ocm)
+	scan:
+		for i := 0; sc.Scan(); i++ {
+			if scanErr = sc.Err(); scanErr != nil {
+				break
+			}
+			d, o := sc.Observation()
+			select {
+			case jobs <- ProcessedObs{i, d, o}:
+			case <-stop:
+				break scan
+			}
+		}
+		if scanErr == nil {
+			scanErr = sc.Err()
+		}
+		close(jobs)
+		wg.Wait()
+		close(res)
+	}()
+	var out []ProcessedObs
+	var fnErr error
+	errIndex := 0
+	for x := range res {
+		if x.err != nil {
+			if fnErr == nil {
+				close(stop)
+			}
+			if fnErr == nil || x.p.Index < errIndex {
+				fnErr, errIndex = x.err, x.p.Index
+			}
+			continue
+		}
+		for len(out) <= x.p.Index {
+			out = append(out, ProcessedObs{})
+		}
+		out[x.p.Index] = x.p
+	}
+	switch {
+	case scanErr != nil:
+		return nil, scanErr
+	case fnErr != nil:
+		return nil, fnErr
+	}
+	return out, nil
+}
@@ -0,0 +1,219 @@
+// Public domain.
+
+package mpcformat_test
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/soniakeys/mpcformat"
+	"github.com/soniakeys/observation"
+)
+
+func TestParseObs80Stream(t *testing.T) {
+	if pMapErr != nil {
+		t.Skip(pMapErr)
+	}
+	oc, ec := mpcformat.ParseObs80Stream(
+		strings.NewReader(o1+bad+sat+"\n"+rov+sat[81:]+o2), pMap)
+	var desigs []string
+	var nErr int
+	for oc != nil || ec != nil {
+		select {
+		case p, ok := <-oc:
+			if !ok {
+				oc = nil
+				continue
+			}
+			desigs = append(desigs, p.Desig)
+			if s, ok := p.Obs.(*observation.SatObs); ok && s.Offset.X == 0 {
+				t.Fatal("satellite obs without line 2 offset")
+			}
+			if r, ok := p.Obs.(*mpcformat.RovingObs); ok && r.Lon == 0 {
+				t.Fatal("roving obs without line 2 location")
+			}
+		case _, ok := <-ec:
+			if !ok {
+				ec = nil
+				continue
+			}
+			nErr++
+		}
+	}
+	want := []string{o1Desig, satDesig, rovDesig, o2Desig, o2Desig}
+	if strings.Join(desigs, " ") != strings.Join(want, " ") {
+		t.Fatalf("ParseObs80Stream desigs = %v, want %v", desigs, want)
+	}
+	// bad line, orphan sat line 2
+	if nErr != 2 {
+		t.Fatalf("ParseObs80Stream sent %d errors, want 2", nErr)
+	}
+}
+
+func TestParseObs80StreamOrphanLine2(t *testing.T) {
+	if pMapErr != nil {
+		t.Skip(pMapErr)
+	}
+	// a line 2 after a site observation does not lose the site observation
+	oc, ec := mpcformat.ParseObs80Stream(
+		strings.NewReader(o1+sat[81:]+o3), pMap)
+	var desigs []string
+	var nErr int
+	for oc != nil || ec != nil {
+		select {
+		case p, ok := <-oc:
+			if !ok {
+				oc = nil
+				continue
+			}
+			desigs = append(desigs, p.Desig)
+		case _, ok := <-ec:
+			if !ok {
+				ec = nil
+				continue
+			}
+			nErr++
+		}
+	}
+	want := []string{o1Desig, o3Desig, o3Desig, o3Desig}
+	if strings.Join(desigs, " ") != strings.Join(want, " ") || nErr != 1 {
+		t.Fatalf("got %v, %d errors, want %v, 1 error", desigs, nErr, want)
+	}
+}
+
+func TestObs80Scanner(t *testing.T) {
+	if pMapErr != nil {
+		t.Skip(pMapErr)
+	}
+	for _, tc := range []struct {
+		in   string
+		want []string
+	}{
+		{o1 + sat + bad + o2,
+			[]string{o1Desig, satDesig, "error", o2Desig, o2Desig}},
+		// orphan line 2 after a site observation
+		{o1 + sat[81:] + o3,
+			[]string{o1Desig, "error", o3Desig, o3Desig, o3Desig}},
+		// line 2 of the wrong kind
+		{sat[:81] + rov[81:] + o1,
+			[]string{satDesig, "error", o1Desig}},
+	} {
+		sc := mpcformat.NewObs80Scanner(strings.NewReader(tc.in), pMap)
+		var got []string
+		for sc.Scan() {
+			desig, o := sc.Observation()
+			switch {
+			case o == nil && sc.Err() == nil:
+				t.Fatal("Scan: no observation and no error")
+			case o == nil:
+				got = append(got, "error")
+			default:
+				got = append(got, desig)
+			}
+		}
+		if err := sc.Err(); err != nil {
+			t.Fatal(err)
+		}
+		if strings.Join(got, " ") != strings.Join(tc.want, " ") {
+			t.Errorf("Obs80Scanner got %v, want %v", got, tc.want)
+		}
+	}
+}
+
+func TestWriteObs80Stream(t *testing.T) {
+	if pMapErr != nil {
+		t.Skip(pMapErr)
+	}
+	var arcs []*observation.Arc
+	f := mpcformat.ArcSplitter(strings.NewReader(o3+sat), pMap)
+	for a, err := f(); err == nil; a, err = f() {
+		// copy, split function reuses the arc
+		arcs = append(arcs, &observation.Arc{Desig: a.Desig,
+			Obs: append([]observation.VObs{}, a.Obs...)})
+	}
+	if len(arcs) != 2 {
+		t.Fatalf("%d arcs", len(arcs))
+	}
+	o := arcs[0].Obs
+	o[0], o[2] = o[2], o[0]
+	var b bytes.Buffer
+	if err := mpcformat.WriteObs80Stream(&b, arcs); err != nil {
+		t.Fatal(err)
+	}
+	if o[0].Meas().MJD < o[2].Meas().MJD {
+		t.Fatal("WriteObs80Stream modified arc")
+	}
+	lines := strings.Split(b.String(), "\n")
+	if len(lines) != 6 {
+		t.Fatalf("WriteObs80Stream wrote %d lines", len(lines)-1)
+	}
+	want := strings.Split(o3+sat, "\n")
+	for i := range lines[:5] {
+		n := 32 // RA and Dec precision may differ
+		if i == 4 {
+			n = 70
+		}
+		if lines[i][:n] != want[i][:n] {
+			t.Errorf("line %d = %s, want %s", i+1, lines[i], want[i])
+		}
+	}
+	// zero offset, long designation
+	s := arcs[1].Obs[0].(*observation.SatObs)
+	s.Offset.X, s.Offset.Y, s.Offset.Z = 0, 0, 0
+	if err := mpcformat.WriteObs80Stream(&b, arcs[1:]); err == nil {
+		t.Fatal("WriteObs80Stream accepted zero offset")
+	}
+	arcs[0].Desig = "1234567890123"
+	if err := mpcformat.WriteObs80Stream(&b, arcs[:1]); err == nil {
+		t.Fatal("WriteObs80Stream accepted long designation")
+	}
+}
+
+func TestTransformObs80Parallel(t *testing.T) {
+	if pMapErr != nil {
+		t.Skip(pMapErr)
+	}
+	ocm := mpcformat.ParallaxMapResolver(pMap)
+	in := o3 + o1 + sat + o2
+	fn := func(d string, o observation.VObs) (string, observation.VObs, error) {
+		return "x" + d, o, nil
+	}
+	got, err := mpcformat.TransformObs80Parallel(strings.NewReader(in), ocm,
+		4, fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{o3Desig, o3Desig, o3Desig, o1Desig, satDesig, o2Desig,
+		o2Desig}
+	if len(got) != len(want) {
+		t.Fatalf("got %d results, want %d", len(got), len(want))
+	}
+	for i, p := range got {
+		if p.Index != i || p.Desig != "x"+want[i] {
+			t.Fatalf("result %d = %d %s, want %d x%s", i, p.Index, p.Desig,
+				i, want[i])
+		}
+	}
+	if got[0].Obs.Meas().MJD >= got[1].Obs.Meas().MJD {
+		t.Fatal("results out of order")
+	}
+	// parse error
+	if _, err = mpcformat.TransformObs80Parallel(
+		strings.NewReader(o1+bad+o2), ocm, 2, fn); err == nil {
+		t.Fatal("no parse error")
+	}
+	// fn error
+	errFn := errors.New("fn")
+	_, err = mpcformat.TransformObs80Parallel(strings.NewReader(in), ocm, 2,
+		func(d string, o observation.VObs) (string, observation.VObs, error) {
+			if d == o1Desig {
+				return "", nil, errFn
+			}
+			return d, o, nil
+		})
+	if err != errFn {
+		t.Fatalf("err = %v, want fn error", err)
+	}
+}
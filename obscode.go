@@ -3,14 +3,24 @@
 package mpcformat
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"math"
+	"net"
 	"net/http"
 	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/soniakeys/observation"
 	"github.com/soniakeys/unit"
@@ -27,35 +37,179 @@ var ObscodeDatURL = "http://www.minorplanetcenter.net/iau/lists/ObsCodes.html"
 // FetchObscodeDat gets a fresh copy of the data at ObscodeDatURL (obscode.dat)
 // and writes it to a new file with the path and file name ocdFile.
 func FetchObscodeDat(ocdFile string) error {
-	r, err := http.Get(ObscodeDatURL)
+	return FetchObscodeDatClient(http.DefaultClient, ocdFile)
+}
+
+// FetchObscodeDatClient is FetchObscodeDat using client for the request.
+// A nil client means http.DefaultClient.
+func FetchObscodeDatClient(client *http.Client, ocdFile string) error {
+	return fetchObscodeDat(context.Background(), client, ocdFile)
+}
+
+// FetchObscodeDatContext is FetchObscodeDat with a context.  Cancellation
+// or deadline of ctx aborts the request.
+func FetchObscodeDatContext(ctx context.Context, ocdFile string) error {
+	return fetchObscodeDat(ctx, http.DefaultClient, ocdFile)
+}
+
+// FetchObscodeDatWithRetry gets obscode.dat as FetchObscodeDatContext, but
+// retries on transient errors.
+//
+// Transient errors are HTTP 5xx responses, refused connections, and
+// timeouts.  Up to maxAttempts requests are made, waiting baseDelay * 2^n,
+// capped at 30 seconds, after the nth failure.  A maxAttempts less than 1
+// is taken as 1.  Cancellation of ctx stops
+// retries.
+func FetchObscodeDatWithRetry(ctx context.Context, ocdFile string,
+	maxAttempts int, baseDelay time.Duration) error {
+	return FetchObscodeDatClientWithRetry(ctx, http.DefaultClient, ocdFile,
+		maxAttempts, baseDelay)
+}
+
+// FetchObscodeDatClientWithRetry is FetchObscodeDatWithRetry using client
+// for the requests.  A nil client means http.DefaultClient.
+func FetchObscodeDatClientWithRetry(ctx context.Context, client *http.Client,
+	ocdFile string, maxAttempts int, baseDelay time.Duration) error {
+	const maxDelay = 30 * time.Second
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+	var err error
+	for n := 0; n < maxAttempts; n++ {
+		if n > 0 {
+			d := maxDelay
+			if n-1 < 30 && baseDelay<<uint(n-1) < maxDelay {
+				d = baseDelay << uint(n-1)
+			}
+			t := time.NewTimer(d)
+			select {
+			case <-ctx.Done():
+				t.Stop()
+				return ctx.Err()
+			case <-t.C:
+			}
+		}
+		if err = fetchObscodeDat(ctx, client, ocdFile); err == nil ||
+			!transientFetchErr(err) {
+			return err
+		}
+	}
+	return err
+}
+
+// fetchObscodeDat writes the data at ObscodeDatURL to ocdFile.
+//
+// The data is written to a temporary file in the directory of ocdFile then
+// renamed to ocdFile, so an existing ocdFile is either replaced by a
+// complete download or left unchanged.  The new file keeps the mode of an
+// existing ocdFile, or otherwise has the mode given by os.Create.
+func fetchObscodeDat(ctx context.Context, client *http.Client,
+	ocdFile string) error {
+	body, err := httpGet(ctx, client, ObscodeDatURL)
 	if err != nil {
 		return err
 	}
-	defer r.Body.Close()
-	f, err := os.Create(ocdFile)
+	defer body.Close()
+	f, err := createTemp(filepath.Dir(ocdFile), ".obscode")
 	if err != nil {
 		return err
 	}
-	if _, err = io.Copy(f, r.Body); err != nil {
+	tmp := f.Name()
+	if fi, serr := os.Stat(ocdFile); serr == nil {
+		err = f.Chmod(fi.Mode().Perm())
+	}
+	if err == nil {
+		_, err = io.Copy(f, body)
+	}
+	if err != nil {
 		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err = f.Close(); err != nil {
+		os.Remove(tmp)
 		return err
 	}
-	return f.Close()
+	if err = os.Rename(tmp, ocdFile); err != nil {
+		os.Remove(tmp)
+	}
+	return err
+}
+
+// createTemp creates a new file in dir as ioutil.TempFile, but with mode
+// 0666 before umask as os.Create rather than 0600.
+func createTemp(dir, prefix string) (*os.File, error) {
+	for i := 0; ; i++ {
+		name := filepath.Join(dir,
+			prefix+strconv.FormatInt(time.Now().UnixNano()+int64(i), 36))
+		f, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0666)
+		if !os.IsExist(err) || i == 10000 {
+			return f, err
+		}
+	}
+}
+
+// httpGet gets url with client, a nil client meaning http.DefaultClient.
+// A response other than 200 OK is returned as an *httpStatusError.
+// The caller must close the returned body.
+func httpGet(ctx context.Context, client *http.Client,
+	url string) (io.ReadCloser, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	r, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if r.StatusCode != http.StatusOK {
+		r.Body.Close()
+		return nil, &httpStatusError{r.StatusCode, r.Status, url}
+	}
+	return r.Body, nil
+}
+
+// httpStatusError is returned for a response other than 200 OK.
+type httpStatusError struct {
+	code   int
+	status string
+	url    string
+}
+
+func (e *httpStatusError) Error() string {
+	return "GET " + e.url + ": " + e.status
+}
+
+func transientFetchErr(err error) bool {
+	var se *httpStatusError
+	if errors.As(err, &se) {
+		return se.code >= 500
+	}
+	var ne net.Error
+	return errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.As(err, &ne) && ne.Timeout()
 }
 
 // ReadObscodeDatFile reads an MPC obscode.dat file.
 //
-// See ReadObscodeDat().
-func ReadObscodeDatFile(ocdFile string) (observation.ParallaxMap, error) {
+// See ReadObscodeDat().  With the WithFallback option, a file that cannot be
+// opened is not an error; the fallback map is returned instead.
+func ReadObscodeDatFile(ocdFile string, opts ...ObscodeOption) (observation.ParallaxMap, error) {
 	f, err := os.Open(ocdFile)
 	if err != nil {
+		if c := newObscodeConfig(opts); c.fallback != nil {
+			return MergeObscodeMaps(c.fallback, nil), nil
+		}
 		return nil, err
 	}
 	defer f.Close()
-	m, err := ReadObscodeDat(f)
+	m, err := ReadObscodeDat(f, opts...)
 	if err != nil {
 		// add filename to error message
-		err = fmt.Errorf("file %s: %s", ocdFile, err)
+		err = fmt.Errorf("file %s: %w", ocdFile, err)
 	}
 	return m, err
 }
@@ -70,66 +224,350 @@ func ReadObscodeDatFile(ocdFile string) (observation.ParallaxMap, error) {
 // Returned is a map from 3-character MPC obs codes to parallax constants.
 //
 // If rhoCosPhi and rhoSinPhi both == 0, nil is stored as the map value.
-func ReadObscodeDat(r io.Reader) (observation.ParallaxMap, error) {
-	b, err := ioutil.ReadAll(r)
-	if err != nil {
+//
+// With the WithFallback option, data read from r is merged over the
+// fallback map, and data with no readable lines is not an error.
+func ReadObscodeDat(r io.Reader, opts ...ObscodeOption) (observation.ParallaxMap, error) {
+	c := newObscodeConfig(opts)
+	recs, err := ReadObscodeRecords(r)
+	if err != nil && !(err == errObscodeUnreadable && c.fallback != nil) {
 		return nil, err
 	}
-	ocdMap := make(observation.ParallaxMap)
+	ocdMap := MergeObscodeMaps(c.fallback, nil)
+	for c, rec := range recs {
+		ocdMap[c] = rec.Parallax
+	}
+	return ocdMap, nil
+}
+
+// ParseObscodeLine parses a single line of the MPC obscode.dat file.
+//
+// Parallax constants are converted to AU.  Blank fields are taken as 0.
+// If rhoCosPhi and rhoSinPhi are both 0, pc is nil.
+func ParseObscodeLine(line string) (code string,
+	pc *observation.ParallaxConst, name string, err error) {
+	if len(line) < 30 {
+		return "", nil, "", newParseError(ErrShortLine, line, -1,
+			"ParseObscodeLine: line too short")
+	}
+
+	// scale factor = earth radius in m / 1 AU in m
+	const sf = 6.37814e6 / 149.59787e9
+
 	var longitude, rhoCosPhi, rhoSinPhi float64
+	if ts := strings.TrimSpace(line[4:13]); len(ts) != 0 {
+		longitude, err = strconv.ParseFloat(ts, 64)
+		if err != nil || longitude < 0 || longitude >= 360 {
+			return "", nil, "",
+				newParseError(ErrInvalidField, ts, 4,
+					"ParseObscodeLine: Invalid longitude (%s)", ts)
+		}
+	}
 
+	if ts := strings.TrimSpace(line[13:21]); len(ts) != 0 {
+		rhoCosPhi, err = strconv.ParseFloat(ts, 64)
+		if err != nil || rhoCosPhi < 0 || rhoCosPhi > 1 {
+			return "", nil, "",
+				newParseError(ErrInvalidField, ts, 13,
+					"ParseObscodeLine: Invalid rhoCosPhi (%s)", ts)
+		}
+		rhoCosPhi *= sf
+	}
+
+	if ts := strings.TrimSpace(line[21:30]); len(ts) != 0 {
+		rhoSinPhi, err = strconv.ParseFloat(ts, 64)
+		if err != nil || rhoSinPhi < -1 || rhoSinPhi > 1 {
+			return "", nil, "",
+				newParseError(ErrInvalidField, ts, 21,
+					"ParseObscodeLine: Invalid rhoSinPhi (%s)", ts)
+		}
+		rhoSinPhi *= sf
+	}
+
+	if rhoCosPhi != 0 || rhoSinPhi != 0 {
+		pc = &observation.ParallaxConst{
+			Longitude: unit.AngleFromDeg(longitude),
+			RhoCosPhi: rhoCosPhi,
+			RhoSinPhi: rhoSinPhi,
+		}
+	}
+	return line[0:3], pc, strings.TrimSpace(line[30:]), nil
+}
+
+var errObscodeUnreadable = errors.New("Obscode data unreadable")
+
+// ObscodeRecord holds the data of a line of obscode.dat.
+type ObscodeRecord struct {
+	Name     string                     // observatory name
+	Parallax *observation.ParallaxConst // nil as for ReadObscodeDat
+}
+
+// ReadObscodeRecords parses the format of the MPC obscode.dat file as
+// ReadObscodeDat, but returns observatory names along with parallax
+// constants.
+func ReadObscodeRecords(r io.Reader) (map[string]ObscodeRecord, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	ocdMap := make(map[string]ObscodeRecord)
 	for _, line := range strings.Split(string(b), "\n") {
-		if len(line) < 30 {
-			continue // quietly ignore extraneous lines such as <pre>
+		code, pc, name, err := ParseObscodeLine(line)
+		if err != nil {
+			// quietly ignore extraneous lines such as <pre>
+			// and column headings.
+			continue
 		}
+		ocdMap[code] = ObscodeRecord{name, pc}
+	}
+	if len(ocdMap) == 0 {
+		return nil, errObscodeUnreadable
+	}
+	return ocdMap, nil
+}
 
-		// scale factor = earth radius in m / 1 AU in m
-		const sf = 6.37814e6 / 149.59787e9
+// obscodeJSON is the JSON representation of a ParallaxConst.
+type obscodeJSON struct {
+	Longitude float64 `json:"longitude"` // degrees
+	RhoCosPhi float64 `json:"rhoCosPhi"` // AU
+	RhoSinPhi float64 `json:"rhoSinPhi"` // AU
+}
 
-		if ts := strings.TrimSpace(line[4:13]); len(ts) == 0 {
-			longitude = 0 // blank fields default to 0
-		} else {
-			longitude, err = strconv.ParseFloat(ts, 64)
-			if err != nil || longitude < 0 || longitude >= 360 {
-				// quietly ignore lines with invalid longitude,
-				// such as column heading line.
-				continue
-			}
+// MarshalObscodeJSON encodes m as a JSON object keyed by observatory code.
+//
+// Values are objects with longitude in degrees and rhoCosPhi and rhoSinPhi
+// in AU, or null for nil map values.
+func MarshalObscodeJSON(m observation.ParallaxMap) ([]byte, error) {
+	j := make(map[string]*obscodeJSON, len(m))
+	for c, p := range m {
+		if p == nil {
+			j[c] = nil
+			continue
 		}
+		j[c] = &obscodeJSON{p.Longitude.Deg(), p.RhoCosPhi, p.RhoSinPhi}
+	}
+	return json.Marshal(j)
+}
 
-		if ts := strings.TrimSpace(line[13:21]); len(ts) == 0 {
-			rhoCosPhi = 0
-		} else {
-			rhoCosPhi, err = strconv.ParseFloat(ts, 64)
-			if err != nil || rhoCosPhi < 0 || rhoCosPhi > 1 {
-				continue
-			}
-			rhoCosPhi *= sf
+// UnmarshalObscodeJSON decodes data encoded by MarshalObscodeJSON.
+func UnmarshalObscodeJSON(data []byte) (observation.ParallaxMap, error) {
+	var j map[string]*obscodeJSON
+	if err := json.Unmarshal(data, &j); err != nil {
+		return nil, err
+	}
+	m := make(observation.ParallaxMap, len(j))
+	for c, p := range j {
+		if p == nil {
+			m[c] = nil
+			continue
 		}
+		m[c] = &observation.ParallaxConst{
+			Longitude: unit.AngleFromDeg(p.Longitude),
+			RhoCosPhi: p.RhoCosPhi,
+			RhoSinPhi: p.RhoSinPhi,
+		}
+	}
+	return m, nil
+}
 
-		if ts := strings.TrimSpace(line[21:30]); len(ts) == 0 {
-			rhoSinPhi = 0
-		} else {
-			rhoSinPhi, err = strconv.ParseFloat(ts, 64)
-			if err != nil || rhoSinPhi < -1 || rhoSinPhi > 1 {
-				continue
+// MergeObscodeMaps returns a new map with the entries of base and overlay.
+// Where a code is in both, the overlay entry is used.  Either map may be nil.
+func MergeObscodeMaps(base, overlay observation.ParallaxMap) observation.ParallaxMap {
+	m := make(observation.ParallaxMap, len(base)+len(overlay))
+	for c, p := range base {
+		m[c] = p
+	}
+	for c, p := range overlay {
+		m[c] = p
+	}
+	return m
+}
+
+// DiffObscodeMaps compares two versions of an obscode map, returning sorted
+// lists of codes added in new, removed from old, and with changed values.
+// Values are compared by content, not pointer.  Either map may be nil.
+func DiffObscodeMaps(old, new observation.ParallaxMap) (added, removed, changed []string) {
+	for c, p := range new {
+		q, ok := old[c]
+		switch {
+		case !ok:
+			added = append(added, c)
+		case p == nil || q == nil:
+			if p != q {
+				changed = append(changed, c)
 			}
-			rhoSinPhi *= sf
+		case *p != *q:
+			changed = append(changed, c)
+		}
+	}
+	for c := range old {
+		if _, ok := new[c]; !ok {
+			removed = append(removed, c)
 		}
+	}
+	sort.Strings(added)
+	sort.Strings(removed)
+	sort.Strings(changed)
+	return
+}
 
-		if rhoCosPhi == 0 && rhoSinPhi == 0 {
-			ocdMap[line[0:3]] = nil
-		} else {
-			ocdMap[line[0:3]] =
-				&observation.ParallaxConst{
-					Longitude: unit.AngleFromDeg(longitude),
-					RhoCosPhi: rhoCosPhi,
-					RhoSinPhi: rhoSinPhi,
-				}
+// LookupNearestObscode finds the code in m with parallax constants nearest
+// the given constants.
+//
+// RhoCosPhi and rhoSinPhi are in AU, as in observation.ParallaxConst.
+// The returned distance is the Euclidean distance between the sites in AU,
+// computed from the cylindrical coordinates longitude, rhoCosPhi, rhoSinPhi.
+// Nil entries of m are ignored.  If m has no non-nil entries the code is
+// empty and distance is +Inf.  Ties are broken by the lesser code.
+func LookupNearestObscode(m observation.ParallaxMap, lonDeg, rhoCosPhi,
+	rhoSinPhi float64) (code string, distance float64) {
+	sl, cl := math.Sincos(lonDeg * math.Pi / 180)
+	x, y := rhoCosPhi*cl, rhoCosPhi*sl
+	distance = math.Inf(1)
+	for c, p := range m {
+		if p == nil {
+			continue
+		}
+		s, co := p.Longitude.Sincos()
+		d := math.Sqrt(math.Pow(p.RhoCosPhi*co-x, 2) +
+			math.Pow(p.RhoCosPhi*s-y, 2) +
+			math.Pow(p.RhoSinPhi-rhoSinPhi, 2))
+		if d < distance || d == distance && c < code {
+			code, distance = c, d
 		}
 	}
-	if len(ocdMap) == 0 {
-		return nil, errors.New("Obscode data unreadable")
+	return
+}
+
+// LookupNearestObscodeWithinKm finds the nearest code as
+// LookupNearestObscode, but returns an error if no code is within km
+// kilometers.
+func LookupNearestObscodeWithinKm(m observation.ParallaxMap, lonDeg,
+	rhoCosPhi, rhoSinPhi, km float64) (string, error) {
+	code, d := LookupNearestObscode(m, lonDeg, rhoCosPhi, rhoSinPhi)
+	if dk := d * auM / 1000; !(dk <= km) {
+		return "", newParseError(ErrUnknownObscode, code, -1,
+			"No observatory code within %g km", km)
 	}
-	return ocdMap, nil
+	return code, nil
+}
+
+// SearchObscodeByName returns the sorted codes of m with names containing
+// query, ignoring case.
+func SearchObscodeByName(m map[string]ObscodeRecord, query string) []string {
+	q := strings.ToLower(query)
+	return searchObscode(m, func(name string) bool {
+		return strings.Contains(strings.ToLower(name), q)
+	})
+}
+
+// SearchObscodeByNameRegexp returns the sorted codes of m with names
+// matching re.
+func SearchObscodeByNameRegexp(m map[string]ObscodeRecord, re *regexp.Regexp) []string {
+	return searchObscode(m, re.MatchString)
+}
+
+func searchObscode(m map[string]ObscodeRecord, match func(string) bool) []string {
+	var codes []string
+	for c, r := range m {
+		if match(r.Name) {
+			codes = append(codes, c)
+		}
+	}
+	sort.Strings(codes)
+	return codes
+}
+
+// ObscodeFileAge returns the time since the obscode file at path was last
+// modified.
+func ObscodeFileAge(path string) (time.Duration, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return 0, err
+	}
+	return time.Since(fi.ModTime()), nil
+}
+
+// ReadObscodeDatFileIfStale reads the obscode file at path only if it was
+// modified more than maxAge ago.
+//
+// If the file is fresher than maxAge, the returned map is nil and read is
+// false; the caller can continue to use a previously read map.  Otherwise
+// the file is read as by ReadObscodeDatFile and read is true.
+func ReadObscodeDatFileIfStale(path string, maxAge time.Duration) (m observation.ParallaxMap, read bool, err error) {
+	age, err := ObscodeFileAge(path)
+	if err != nil {
+		return nil, false, err
+	}
+	if age <= maxAge {
+		return nil, false, nil
+	}
+	m, err = ReadObscodeDatFile(path)
+	return m, true, err
+}
+
+// ConcurrentObscodeMap is an obscode map safe for concurrent use, for
+// example where one goroutine periodically refreshes the map while others
+// look up codes.
+//
+// The zero value is an empty map ready to use.  ConcurrentObscodeMap
+// implements ObscodeResolver.
+type ConcurrentObscodeMap struct {
+	mu sync.RWMutex
+	m  observation.ParallaxMap
+}
+
+// Lookup returns the parallax constants for code and true if code is in
+// the map.
+func (c *ConcurrentObscodeMap) Lookup(code string) (*observation.ParallaxConst, bool) {
+	c.mu.RLock()
+	p, ok := c.m[code]
+	c.mu.RUnlock()
+	return p, ok
+}
+
+// Resolve implements ObscodeResolver, the same as Lookup.
+func (c *ConcurrentObscodeMap) Resolve(code string) (*observation.ParallaxConst, bool) {
+	return c.Lookup(code)
+}
+
+// Update replaces the entire contents of the map with m.  The map is copied
+// so m may be modified afterward.
+func (c *ConcurrentObscodeMap) Update(m observation.ParallaxMap) {
+	m = MergeObscodeMaps(m, nil)
+	c.mu.Lock()
+	c.m = m
+	c.mu.Unlock()
+}
+
+// Snapshot returns a copy of the current contents of the map.
+func (c *ConcurrentObscodeMap) Snapshot() observation.ParallaxMap {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return MergeObscodeMaps(c.m, nil)
+}
+
+// ErrSpaceObservatory is returned by ObscodeDistance for an observatory
+// code without parallax constants.
+var ErrSpaceObservatory = errors.New("space observatory")
+
+// ObscodeDistance returns the distance in km along the surface of the
+// WGS84 ellipsoid between two ground based observatories.
+//
+// An error is returned if either code is not in m.  If either observatory
+// has nil parallax constants, the error is ErrSpaceObservatory.
+func ObscodeDistance(m map[string]ObscodeRecord, code1, code2 string) (km float64, err error) {
+	var lat, lon [2]float64
+	for i, c := range []string{code1, code2} {
+		r, ok := m[c]
+		switch {
+		case !ok:
+			return 0, newParseError(ErrUnknownObscode, c, -1,
+				"ObscodeDistance: Unknown observatory code (%s)", c)
+		case r.Parallax == nil:
+			return 0, ErrSpaceObservatory
+		}
+		lat[i], lon[i], _ = ParallaxToGeodetic(r.Parallax)
+	}
+	return geodesicDistance(lat[0], lon[0], lat[1], lon[1]) / 1000, nil
 }
@@ -4,8 +4,21 @@ package mpcformat_test
 
 import (
 	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
 	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/soniakeys/mpcformat"
 	"github.com/soniakeys/observation"
@@ -72,3 +85,534 @@ func testParallaxMap(m observation.ParallaxMap, t *testing.T) {
 		}
 	}
 }
+
+func TestReadObscodeRecords(t *testing.T) {
+	m, err := mpcformat.ReadObscodeRecords(bytes.NewBufferString(ocdSample))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m) != len(siteTestCases) {
+		t.Fatalf("ReadObscodeRecords found %d sites, want %d",
+			len(m), len(siteTestCases))
+	}
+	pm := observation.ParallaxMap{}
+	for c, r := range m {
+		pm[c] = r.Parallax
+	}
+	testParallaxMap(pm, t)
+	for c, want := range map[string]string{
+		"250": "Hubble Space Telescope",
+		"644": "Palomar Mountain/NEAT",
+		"E12": "Siding Spring Survey",
+	} {
+		if got := m[c].Name; got != want {
+			t.Fatalf("code %s name %q, want %q", c, got, want)
+		}
+	}
+}
+
+// serveObscodes points ObscodeDatURL at a local server for the duration of
+// a test.
+func serveObscodes(t *testing.T, h http.HandlerFunc) {
+	srv := httptest.NewServer(h)
+	save := mpcformat.ObscodeDatURL
+	mpcformat.ObscodeDatURL = srv.URL
+	t.Cleanup(func() {
+		mpcformat.ObscodeDatURL = save
+		srv.Close()
+	})
+}
+
+func TestFetchObscodeDatContext(t *testing.T) {
+	serveObscodes(t, func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, ocdSample)
+	})
+	dir, err := ioutil.TempDir("", "testfetch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fn := filepath.Join(dir, "obscode.dat")
+	if err := mpcformat.FetchObscodeDatContext(context.Background(), fn); err != nil {
+		t.Fatal(err)
+	}
+	m, err := mpcformat.ReadObscodeDatFile(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testParallaxMap(m, t)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := mpcformat.FetchObscodeDatContext(ctx, fn); err == nil {
+		t.Fatal("FetchObscodeDatContext ignored canceled context")
+	}
+}
+
+func TestFetchObscodeDatMode(t *testing.T) {
+	serveObscodes(t, func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, ocdSample)
+	})
+	dir, err := ioutil.TempDir("", "testfetch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// new file has the mode os.Create gives
+	ref, err := os.Create(filepath.Join(dir, "ref"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref.Close()
+	want, err := os.Stat(ref.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	fn := filepath.Join(dir, "obscode.dat")
+	if err := mpcformat.FetchObscodeDat(fn); err != nil {
+		t.Fatal(err)
+	}
+	fi, err := os.Stat(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode() != want.Mode() {
+		t.Fatalf("new file mode %v, want %v", fi.Mode(), want.Mode())
+	}
+	// existing file keeps its mode
+	if err := os.Chmod(fn, 0640); err != nil {
+		t.Fatal(err)
+	}
+	want, _ = os.Stat(fn)
+	if err := mpcformat.FetchObscodeDat(fn); err != nil {
+		t.Fatal(err)
+	}
+	if fi, err = os.Stat(fn); err != nil || fi.Mode() != want.Mode() {
+		t.Fatalf("replaced file mode %v, want %v (%v)", fi.Mode(), want.Mode(), err)
+	}
+}
+
+func TestFetchObscodeDatWithRetry(t *testing.T) {
+	fails := 2
+	serveObscodes(t, func(w http.ResponseWriter, r *http.Request) {
+		if fails > 0 {
+			fails--
+			http.Error(w, "busy", http.StatusServiceUnavailable)
+			return
+		}
+		io.WriteString(w, ocdSample)
+	})
+	dir, err := ioutil.TempDir("", "testfetch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fn := filepath.Join(dir, "obscode.dat")
+	ctx := context.Background()
+	// not enough attempts, file not written
+	if err := mpcformat.FetchObscodeDatWithRetry(ctx, fn, 1, time.Millisecond); err == nil {
+		t.Fatal("FetchObscodeDatWithRetry succeeded on 503")
+	}
+	if _, err := os.Stat(fn); !os.IsNotExist(err) {
+		t.Fatal("file written on failed fetch")
+	}
+	// maxAttempts 0 still makes one request
+	if err := mpcformat.FetchObscodeDatWithRetry(ctx, fn, 0, time.Millisecond); err == nil || fails != 0 {
+		t.Fatalf("maxAttempts 0: err %v, %d failures left", err, fails)
+	}
+	fails = 1
+	if err := mpcformat.FetchObscodeDatWithRetry(ctx, fn, 3, time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	m, err := mpcformat.ReadObscodeDatFile(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testParallaxMap(m, t)
+	if names, _ := filepath.Glob(filepath.Join(dir, "*")); len(names) != 1 {
+		t.Fatalf("temp files left: %v", names)
+	}
+}
+
+func TestFetchObscodeDatWithRetryPermanent(t *testing.T) {
+	n := 0
+	serveObscodes(t, func(w http.ResponseWriter, r *http.Request) {
+		n++
+		http.NotFound(w, r)
+	})
+	dir, err := ioutil.TempDir("", "testfetch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	err = mpcformat.FetchObscodeDatWithRetry(context.Background(),
+		filepath.Join(dir, "obscode.dat"), 3, time.Millisecond)
+	if err == nil || n != 1 {
+		t.Fatalf("404: err %v after %d requests, want error after 1", err, n)
+	}
+}
+
+func TestObscodeJSON(t *testing.T) {
+	if pMapErr != nil {
+		t.Skip(pMapErr)
+	}
+	j, err := mpcformat.MarshalObscodeJSON(pMap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(j, []byte(`"250":null`)) {
+		t.Fatalf("MarshalObscodeJSON = %s, want null for 250", j)
+	}
+	m, err := mpcformat.UnmarshalObscodeJSON(j)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m) != len(pMap) {
+		t.Fatalf("UnmarshalObscodeJSON found %d sites, want %d",
+			len(m), len(pMap))
+	}
+	testParallaxMap(m, t)
+	if _, err = mpcformat.UnmarshalObscodeJSON([]byte(`{"703":1}`)); err == nil {
+		t.Fatal("UnmarshalObscodeJSON accepted bad value")
+	}
+}
+
+func TestMergeDiffObscodeMaps(t *testing.T) {
+	if pMapErr != nil {
+		t.Skip(pMapErr)
+	}
+	p703 := *pMap["703"]
+	p703.RhoSinPhi *= 1.0001
+	overlay := observation.ParallaxMap{
+		"703": &p703,                        // changed
+		"250": pMap["250"],                  // same, nil
+		"X01": &observation.ParallaxConst{}, // added
+	}
+	m := mpcformat.MergeObscodeMaps(pMap, overlay)
+	if len(m) != len(pMap)+1 || m["703"] != &p703 || m["000"] != pMap["000"] {
+		t.Fatal("MergeObscodeMaps wrong result")
+	}
+	delete(m, "E12")
+	a, r, c := mpcformat.DiffObscodeMaps(pMap, m)
+	if !reflect.DeepEqual([][]string{a, r, c},
+		[][]string{{"X01"}, {"E12"}, {"703"}}) {
+		t.Fatalf("DiffObscodeMaps = %v, %v, %v", a, r, c)
+	}
+	if m = mpcformat.MergeObscodeMaps(nil, nil); m == nil || len(m) != 0 {
+		t.Fatal("MergeObscodeMaps(nil, nil) want empty map")
+	}
+	if a, r, c = mpcformat.DiffObscodeMaps(nil, pMap); len(a) != len(pMap) ||
+		r != nil || c != nil {
+		t.Fatalf("DiffObscodeMaps(nil, pMap) = %v, %v, %v", a, r, c)
+	}
+}
+
+func TestLookupNearestObscode(t *testing.T) {
+	if pMapErr != nil {
+		t.Skip(pMapErr)
+	}
+	// a few km from 704
+	p := mpcformat.GeodeticToParallax(33.82, 253.30, 2200)
+	code, d := mpcformat.LookupNearestObscode(pMap,
+		p.Longitude.Deg(), p.RhoCosPhi, p.RhoSinPhi)
+	if code != "704" || d == 0 {
+		t.Fatalf("LookupNearestObscode = %q, %g, want 704", code, d)
+	}
+	p = pMap["E12"]
+	code, d = mpcformat.LookupNearestObscode(pMap,
+		p.Longitude.Deg(), p.RhoCosPhi, p.RhoSinPhi)
+	if code != "E12" || d > 1e-15 {
+		t.Fatalf("LookupNearestObscode = %q, %g, want E12, 0", code, d)
+	}
+	p = mpcformat.GeodeticToParallax(33.82, 253.30, 2200)
+	if code, err := mpcformat.LookupNearestObscodeWithinKm(pMap,
+		p.Longitude.Deg(), p.RhoCosPhi, p.RhoSinPhi, 50); err != nil ||
+		code != "704" {
+		t.Fatalf("LookupNearestObscodeWithinKm(50) = %q, %v", code, err)
+	}
+	if code, err := mpcformat.LookupNearestObscodeWithinKm(pMap,
+		p.Longitude.Deg(), p.RhoCosPhi, p.RhoSinPhi, .1); err == nil ||
+		code != "" {
+		t.Fatalf("LookupNearestObscodeWithinKm(.1) = %q, %v", code, err)
+	}
+	if code, d = mpcformat.LookupNearestObscode(nil, 0, 0, 0); code != "" ||
+		!math.IsInf(d, 1) {
+		t.Fatalf("LookupNearestObscode(nil) = %q, %g", code, d)
+	}
+}
+
+func TestSearchObscodeByName(t *testing.T) {
+	m, err := mpcformat.ReadObscodeRecords(bytes.NewBufferString(ocdSample))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := mpcformat.SearchObscodeByName(m, "SURVEY"); !reflect.DeepEqual(got,
+		[]string{"703", "E12"}) {
+		t.Fatalf("SearchObscodeByName(SURVEY) = %v", got)
+	}
+	if got := mpcformat.SearchObscodeByName(m, "nowhere"); got != nil {
+		t.Fatalf("SearchObscodeByName(nowhere) = %v", got)
+	}
+	re := regexp.MustCompile(`^(Hubble|Hipparcos)`)
+	if got := mpcformat.SearchObscodeByNameRegexp(m, re); !reflect.DeepEqual(got,
+		[]string{"248", "250"}) {
+		t.Fatalf("SearchObscodeByNameRegexp = %v", got)
+	}
+}
+
+// redirectTransport sends all requests to a test server.
+type redirectTransport struct{ srv *url.URL }
+
+func (rt redirectTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	r = r.Clone(r.Context())
+	r.URL.Scheme = rt.srv.Scheme
+	r.URL.Host = rt.srv.Host
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+func TestFetchObscodeDatClient(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			io.WriteString(w, ocdSample)
+		}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+	client := &http.Client{Transport: redirectTransport{u}}
+	dir, err := ioutil.TempDir("", "testfetch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fn := filepath.Join(dir, "obscode.dat")
+	if err := mpcformat.FetchObscodeDatClient(client, fn); err != nil {
+		t.Fatal(err)
+	}
+	m, err := mpcformat.ReadObscodeDatFile(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testParallaxMap(m, t)
+}
+
+func TestFetchObscodeDatClientStatus(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(http.NotFound))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+	client := &http.Client{Transport: redirectTransport{u}}
+	dir, err := ioutil.TempDir("", "testfetch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fn := filepath.Join(dir, "obscode.dat")
+	if err := mpcformat.FetchObscodeDatClient(client, fn); err == nil {
+		t.Fatal("FetchObscodeDatClient succeeded on 404")
+	}
+	if _, err := os.Stat(fn); !os.IsNotExist(err) {
+		t.Fatal("file written on failed fetch")
+	}
+}
+
+func TestFetchObscodeDatClientWithRetry(t *testing.T) {
+	fails := 1
+	srv := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			if fails > 0 {
+				fails--
+				http.Error(w, "busy", http.StatusServiceUnavailable)
+				return
+			}
+			io.WriteString(w, ocdSample)
+		}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+	client := &http.Client{Transport: redirectTransport{u}}
+	dir, err := ioutil.TempDir("", "testfetch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fn := filepath.Join(dir, "obscode.dat")
+	if err := mpcformat.FetchObscodeDatClientWithRetry(context.Background(),
+		client, fn, 2, time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	m, err := mpcformat.ReadObscodeDatFile(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testParallaxMap(m, t)
+}
+
+func TestReadObscodeDatFileIfStale(t *testing.T) {
+	f, err := ioutil.TempFile("", "testobscode")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fn := f.Name()
+	defer os.Remove(fn)
+	io.WriteString(f, ocdSample)
+	f.Close()
+	if age, err := mpcformat.ObscodeFileAge(fn); err != nil || age > time.Hour {
+		t.Fatalf("ObscodeFileAge = %v, %v", age, err)
+	}
+	m, read, err := mpcformat.ReadObscodeDatFileIfStale(fn, time.Hour)
+	if err != nil || read || m != nil {
+		t.Fatalf("fresh file: read %t, err %v", read, err)
+	}
+	old := time.Now().Add(-2 * time.Hour)
+	if err = os.Chtimes(fn, old, old); err != nil {
+		t.Fatal(err)
+	}
+	m, read, err = mpcformat.ReadObscodeDatFileIfStale(fn, time.Hour)
+	if err != nil || !read {
+		t.Fatalf("stale file: read %t, err %v", read, err)
+	}
+	testParallaxMap(m, t)
+	if _, _, err = mpcformat.ReadObscodeDatFileIfStale(fn+".none",
+		time.Hour); err == nil {
+		t.Fatal("ReadObscodeDatFileIfStale: no error for missing file")
+	}
+}
+
+func TestConcurrentObscodeMap(t *testing.T) {
+	if pMapErr != nil {
+		t.Skip(pMapErr)
+	}
+	var c mpcformat.ConcurrentObscodeMap
+	if _, ok := c.Lookup("703"); ok {
+		t.Fatal("zero value map found 703")
+	}
+	c.Update(pMap)
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				if p, ok := c.Lookup("703"); !ok || p == nil {
+					t.Error("Lookup(703) failed")
+					return
+				}
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			c.Update(c.Snapshot())
+		}()
+	}
+	wg.Wait()
+	s := c.Snapshot()
+	delete(s, "703")
+	if _, ok := c.Resolve("703"); !ok {
+		t.Fatal("Snapshot shares map with ConcurrentObscodeMap")
+	}
+	if _, _, err := mpcformat.ParseObs80(tcSatLine1, &c); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestParseObscodeLine(t *testing.T) {
+	code, pc, name, err := mpcformat.ParseObscodeLine(
+		"703 249.267360.845315+0.533213Catalina Sky Survey")
+	if err != nil || code != "703" || name != "Catalina Sky Survey" ||
+		pc == nil || math.Abs(pc.Longitude.Deg()-249.26736) > 1e-10 {
+		t.Fatalf("ParseObscodeLine = %q, %+v, %q, %v", code, pc, name, err)
+	}
+	code, pc, name, err = mpcformat.ParseObscodeLine(
+		"250                           Hubble Space Telescope")
+	if err != nil || code != "250" || pc != nil {
+		t.Fatalf("ParseObscodeLine = %q, %+v, %q, %v", code, pc, name, err)
+	}
+	for _, line := range []string{
+		"<pre>",
+		"Code  Long.   cos      sin    Name",
+		"703 249.267361.845315+0.533213Catalina Sky Survey",
+	} {
+		if _, _, _, err = mpcformat.ParseObscodeLine(line); err == nil {
+			t.Fatalf("ParseObscodeLine accepted %q", line)
+		}
+	}
+}
+
+func TestObscodeDistance(t *testing.T) {
+	m, err := mpcformat.ReadObscodeRecords(bytes.NewBufferString(ocdSample))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Catalina to Lincoln Lab ETS, roughly 410 km
+	km, err := mpcformat.ObscodeDistance(m, "703", "704")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if km < 400 || km > 420 {
+		t.Fatalf("ObscodeDistance(703, 704) = %g km", km)
+	}
+	if km, err = mpcformat.ObscodeDistance(m, "703", "703"); err != nil ||
+		km != 0 {
+		t.Fatalf("ObscodeDistance(703, 703) = %g, %v", km, err)
+	}
+	if _, err = mpcformat.ObscodeDistance(m, "703", "250"); err != mpcformat.ErrSpaceObservatory {
+		t.Fatalf("ObscodeDistance(703, 250) err = %v", err)
+	}
+	if _, err = mpcformat.ObscodeDistance(m, "703", "XXX"); err == nil {
+		t.Fatal("ObscodeDistance accepted unknown code")
+	}
+}
+
+func TestDefaultObscodeMap(t *testing.T) {
+	d := mpcformat.DefaultObscodeMap
+	for _, c := range []string{"000", "250", "291", "500", "568", "703",
+		"704", "F51", "G96", "T05"} {
+		if _, ok := d[c]; !ok {
+			t.Fatalf("DefaultObscodeMap missing %s", c)
+		}
+	}
+	if len(d) < 50 {
+		t.Fatalf("DefaultObscodeMap has %d codes, want at least 50", len(d))
+	}
+	if p := d["T05"]; p == nil || math.Abs(p.Longitude.Deg()-203.7424) > 1e-4 {
+		t.Fatalf("DefaultObscodeMap T05 = %+v", p)
+	}
+	testParallaxMap(d, t)
+	n := len(d)
+	m, err := mpcformat.ReadObscodeDat(bytes.NewBufferString(
+		"X01 100.0000 0.50000 +0.50000 Private site"),
+		mpcformat.WithFallback(d))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m) != n+1 || m["X01"] == nil || len(d) != n {
+		t.Fatal("ReadObscodeDat WithFallback did not merge")
+	}
+	if m, err = mpcformat.ReadObscodeDat(bytes.NewBufferString("junk"),
+		mpcformat.WithFallback(d)); err != nil || len(m) != n {
+		t.Fatalf("ReadObscodeDat junk WithFallback = %d codes, %v", len(m), err)
+	}
+	if _, err = mpcformat.ReadObscodeDat(bytes.NewBufferString("junk")); err == nil {
+		t.Fatal("ReadObscodeDat accepted junk")
+	}
+	if m, err = mpcformat.ReadObscodeDatFile("/nonexistent/obscode.dat",
+		mpcformat.WithFallback(d)); err != nil || len(m) != n {
+		t.Fatalf("ReadObscodeDatFile missing WithFallback = %d codes, %v",
+			len(m), err)
+	}
+}
+
+func BenchmarkReadObscodeDat(b *testing.B) {
+	// 500 sites
+	var buf bytes.Buffer
+	buf.WriteString("Code  Long.   cos      sin    Name\n")
+	for i := 0; i < 500; i++ {
+		fmt.Fprintf(&buf, "%03d %8.4f %7.5f %+8.5f Site %d\n",
+			i, float64(i)*.7, .5+float64(i%50)*.01, float64(i%100)*.01-.5, i)
+	}
+	data := buf.Bytes()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		m, err := mpcformat.ReadObscodeDat(bytes.NewReader(data))
+		if err != nil || len(m) != 500 {
+			b.Fatal(len(m), err)
+		}
+	}
+}
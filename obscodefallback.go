@@ -0,0 +1,48 @@
+// Public domain.
+
+package mpcformat
+
+import (
+	_ "embed"
+	"strings"
+
+	"github.com/soniakeys/observation"
+)
+
+//go:embed obscode_fallback.dat
+var obscodeFallbackDat string
+
+// DefaultObscodeMap is a small built-in table of well known observatory
+// codes, for offline use and testing.  It is a snapshot in obscode.dat
+// format and may be out of date.  Prefer a current obscode.dat when
+// available.
+var DefaultObscodeMap = mustReadObscodeDat(obscodeFallbackDat)
+
+func mustReadObscodeDat(s string) observation.ParallaxMap {
+	m, err := ReadObscodeDat(strings.NewReader(s))
+	if err != nil {
+		panic(err)
+	}
+	return m
+}
+
+// ObscodeOption is an option for ReadObscodeDat and ReadObscodeDatFile.
+type ObscodeOption func(*obscodeConfig)
+
+type obscodeConfig struct {
+	fallback observation.ParallaxMap
+}
+
+func newObscodeConfig(opts []ObscodeOption) *obscodeConfig {
+	c := &obscodeConfig{}
+	for _, o := range opts {
+		o(c)
+	}
+	return c
+}
+
+// WithFallback is an option that uses m as a base layer, for example
+// DefaultObscodeMap.  Codes read are merged over m; m is not modified.
+func WithFallback(m observation.ParallaxMap) ObscodeOption {
+	return func(c *obscodeConfig) { c.fallback = m }
+}
@@ -0,0 +1,69 @@
+// Public domain.
+
+package mpcformat
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/soniakeys/observation"
+)
+
+// OccultationObs represents an occultation-derived observation.
+//
+// The embedded SiteObs holds the derived position and observing site.
+// It satisfies the observation.VObs interface.
+type OccultationObs struct {
+	observation.SiteObs
+	StarDesig   string  // designation of the occulted star
+	EventType   byte    // 'D' disappearance or 'R' reappearance
+	ChordLength float64 // km, NaN if not given
+}
+
+// ParseObs80Occultation parses an occultation observation line in the MPC
+// 80 column format.
+//
+// Note 2, column 14, must be 'E'.  Designation, date, RA, Dec, and
+// observatory code are in the usual columns and the observatory code must
+// exist in ocm with parallax constants.  In place of magnitude and band,
+// columns 56-65 hold the star designation, column 65 the event type, D or
+// R, and columns 66-72 the chord length in km, which may be blank.
+// (Column numbers here are Go-like.)
+func ParseObs80Occultation(line80 string, ocm observation.ParallaxMap) (desig string,
+	o *OccultationObs, err error) {
+	if len(line80) != 80 {
+		return "", nil, errors.New("ParseObs80Occultation requires 80 characters")
+	}
+	if line80[14] != 'E' {
+		return "", nil, fmt.Errorf("ParseObs80Occultation: note 2 = %c, want E",
+			line80[14])
+	}
+	ev := line80[65]
+	if ev != 'D' && ev != 'R' {
+		return "", nil, fmt.Errorf("ParseObs80Occultation: Invalid event type (%c)",
+			ev)
+	}
+	chord, ok := parseRadarValue(line80[66:72])
+	if !ok {
+		return "", nil, fmt.Errorf("ParseObs80Occultation: Invalid chord length (%s)",
+			line80[66:72])
+	}
+	// parse the astrometric fields without the occultation fields
+	desig, vo, err := ParseObs80(line80[:56]+strings.Repeat(" ", 21)+
+		line80[77:], ParallaxMapResolver(ocm))
+	if err != nil {
+		return "", nil, err
+	}
+	so, ok := vo.(*observation.SiteObs)
+	if !ok {
+		return "", nil, fmt.Errorf("ParseObs80Occultation: No parallax constants for observatory code (%s)",
+			line80[77:80])
+	}
+	return desig, &OccultationObs{
+		SiteObs:     *so,
+		StarDesig:   strings.TrimSpace(line80[56:65]),
+		EventType:   ev,
+		ChordLength: chord,
+	}, nil
+}
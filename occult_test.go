@@ -0,0 +1,40 @@
+// Public domain.
+
+package mpcformat_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/soniakeys/mpcformat"
+	"github.com/soniakeys/observation"
+)
+
+const tcOccult = "     K11Q14F  E2014 09 03.40285 02 53 00.70 +10 38 30.3 TYC1234  D  12.5     703"
+
+func TestParseObs80Occultation(t *testing.T) {
+	if pMapErr != nil {
+		t.Skip(pMapErr)
+	}
+	desig, o, err := mpcformat.ParseObs80Occultation(tcOccult, pMap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if desig != "K11Q14F" || o.StarDesig != "TYC1234" ||
+		o.EventType != 'D' || o.ChordLength != 12.5 ||
+		math.Abs(o.MJD-56903.40285) > 1e-6 || o.Par != pMap["703"] {
+		t.Fatalf("ParseObs80Occultation = %q, %+v", desig, o)
+	}
+	var _ observation.VObs = o
+	noChord := tcOccult[:66] + "      " + tcOccult[72:]
+	if _, o, err = mpcformat.ParseObs80Occultation(noChord, pMap); err != nil {
+		t.Fatal(err)
+	}
+	if !math.IsNaN(o.ChordLength) {
+		t.Fatalf("blank chord length = %g, want NaN", o.ChordLength)
+	}
+	badEvent := tcOccult[:65] + "X" + tcOccult[66:]
+	if _, _, err = mpcformat.ParseObs80Occultation(badEvent, pMap); err == nil {
+		t.Fatal("ParseObs80Occultation accepted event type X")
+	}
+}
@@ -0,0 +1,107 @@
+// Public domain.
+
+package mpcformat
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// OneLine holds orbital elements of the one line summary format.
+//
+// Angles are in degrees.  Epoch is MJD.
+type OneLine struct {
+	Desig string
+	Epoch float64
+	Comet bool    // true if elements are perihelion based
+	Q     float64 // perihelion distance, AU
+	A     float64 // semimajor axis, AU
+	E     float64
+	Inc   float64
+	Node  float64 // longitude of ascending node
+	Peri  float64 // argument of perihelion
+	MA    float64 // mean anomaly, NaN if not given
+	H     float64 // NaN if not given
+	G     float64 // NaN if not given
+}
+
+// ParseOneLine parses orbital elements of the one line summary format.
+//
+// Fields are separated by commas, or if the line has no commas, by white
+// space.  Fields are, in order, designation, epoch, distance, e, i, node,
+// peri, M, H, G.  Trailing fields M, H, and G may be omitted, and in the
+// comma separated form may be blank.  The epoch may be a packed epoch, a
+// Julian date, or an MJD.
+//
+// The variant is determined by eccentricity.  For e < 1 the distance field
+// is the semimajor axis and Q is computed from it.  For e >= 1 the distance
+// field is the perihelion distance and A is computed, negative for
+// hyperbolic orbits and +Inf for parabolic orbits.
+func ParseOneLine(line string) (*OneLine, error) {
+	var f []string
+	if strings.IndexByte(line, ',') >= 0 {
+		f = strings.Split(line, ",")
+		for i := range f {
+			f[i] = strings.TrimSpace(f[i])
+		}
+	} else {
+		f = strings.Fields(line)
+	}
+	if len(f) < 7 || len(f) > 10 {
+		return nil, fmt.Errorf("ParseOneLine: Invalid field count (%d)", len(f))
+	}
+	if f[0] == "" {
+		return nil, errors.New("ParseOneLine: Missing designation")
+	}
+	o := &OneLine{Desig: f[0], MA: math.NaN(), H: math.NaN(), G: math.NaN()}
+	var err error
+	if o.Epoch, err = parseOneLineEpoch(f[1]); err != nil {
+		return nil, err
+	}
+	names := [...]string{"distance", "e", "i", "node", "peri", "M", "H", "G"}
+	vals := [...]*float64{&o.A, &o.E, &o.Inc, &o.Node, &o.Peri,
+		&o.MA, &o.H, &o.G}
+	for i, s := range f[2:] {
+		if s == "" && i >= 5 {
+			continue
+		}
+		if *vals[i], err = strconv.ParseFloat(s, 64); err != nil {
+			return nil, fmt.Errorf("ParseOneLine: Invalid %s (%s)", names[i], s)
+		}
+	}
+	if o.E < 0 {
+		return nil, fmt.Errorf("ParseOneLine: Invalid e (%s)", f[3])
+	}
+	if o.E < 1 {
+		o.Q = o.A * (1 - o.E)
+	} else {
+		o.Comet = true
+		o.Q = o.A
+		if o.E == 1 {
+			o.A = math.Inf(1)
+		} else {
+			o.A = o.Q / (1 - o.E)
+		}
+	}
+	return o, nil
+}
+
+// parseOneLineEpoch parses a packed epoch, JD, or MJD, returning MJD.
+func parseOneLineEpoch(s string) (float64, error) {
+	if d, err := strconv.ParseFloat(s, 64); err == nil {
+		if d > 2400000 {
+			d = JDToMJD(d)
+		}
+		return d, nil
+	}
+	y, m, d, err := UnpackEpoch(s)
+	if err != nil || len(s) != 5 {
+		return 0, fmt.Errorf("ParseOneLine: Invalid epoch (%s)", s)
+	}
+	return TimeToMJD(time.Date(y, time.Month(m), int(d), 0, 0, 0, 0,
+		time.UTC)), nil
+}
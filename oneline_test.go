@@ -0,0 +1,57 @@
+// Public domain.
+
+package mpcformat_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/soniakeys/mpcformat"
+)
+
+func TestParseOneLine(t *testing.T) {
+	// asteroid, white space separated, packed epoch
+	o, err := mpcformat.ParseOneLine(
+		"00433 K221L 1.458 .2228 10.83 304.3 178.9 310.55 10.38 .46")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o.Desig != "00433" || o.Epoch != 59600 || o.Comet || o.A != 1.458 ||
+		math.Abs(o.Q-1.458*(1-.2228)) > 1e-12 || o.Inc != 10.83 ||
+		o.Node != 304.3 || o.Peri != 178.9 || o.MA != 310.55 ||
+		o.H != 10.38 || o.G != .46 {
+		t.Fatalf("asteroid: %+v", o)
+	}
+	// comet, comma separated, JD epoch, blank M and G
+	o, err = mpcformat.ParseOneLine(
+		"C/2019 Q4, 2458800.5, 2.0066, 3.3565, 44.05, 308.15, 209.12, , 11.4,")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o.Desig != "C/2019 Q4" || o.Epoch != 58800 || !o.Comet ||
+		o.Q != 2.0066 || math.Abs(o.A-2.0066/(1-3.3565)) > 1e-12 ||
+		!math.IsNaN(o.MA) || o.H != 11.4 || !math.IsNaN(o.G) {
+		t.Fatalf("comet: %+v", o)
+	}
+	// parabolic, MJD epoch, trailing fields omitted
+	o, err = mpcformat.ParseOneLine("CK20F030 58900 .29 1 128.9 61.0 37.3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o.Epoch != 58900 || !o.Comet || !math.IsInf(o.A, 1) || !math.IsNaN(o.H) {
+		t.Fatalf("parabolic: %+v", o)
+	}
+	for _, bad := range []string{
+		"",
+		"00433 K221L 1.458 .2228 10.83 304.3",
+		"00433 K221Lx 1.458 .2228 10.83 304.3 178.9",
+		"00433 K221L 1.458 -.2 10.83 304.3 178.9",
+		"00433 K221L 1.458 .2228 10.83 304.3 x",
+		", K221L, 1.458, .2228, 10.83, 304.3, 178.9",
+		"00433, K221L, 1.458, , 10.83, 304.3, 178.9",
+	} {
+		if _, err := mpcformat.ParseOneLine(bad); err == nil {
+			t.Errorf("ParseOneLine accepted %q", bad)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+// Public domain.
+
+package mpcformat
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// MPCPhotRecord is a single photometric measurement.
+//
+// Uncertainty is NaN when not given.
+type MPCPhotRecord struct {
+	Desig       string
+	MJD         float64 // time of observation
+	Mag         float64 // magnitude as reported, in Band
+	Band        byte
+	ObsCode     string
+	Uncertainty float64 // uncertainty of Mag, magnitudes
+}
+
+// ParseMPCPhotometry parses a photometry file.
+//
+// Lines use the fixed column layout of the 80 column observation format for
+// designation, date, and observatory code, in columns 0-12, 15-32, and 77-80.
+// The position in columns 32-56 is not read.  The photometric measurement
+// is in columns 56-62, band in column 62, and uncertainty in columns 63-68,
+// which may be blank.  (Column numbers here are Go-like.)  Blank lines are
+// ignored.
+//
+// Records parsed before an error are returned along with the error, which
+// gives the line number.
+func ParseMPCPhotometry(r io.Reader) ([]MPCPhotRecord, error) {
+	var recs []MPCPhotRecord
+	s := bufio.NewScanner(r)
+	n := 0
+	for s.Scan() {
+		n++
+		line := s.Text()
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		p, err := parsePhotLine(line)
+		if err != nil {
+			return recs, &obs80LineError{n, err}
+		}
+		recs = append(recs, p)
+	}
+	return recs, s.Err()
+}
+
+func parsePhotLine(line string) (p MPCPhotRecord, err error) {
+	if len(line) != 80 {
+		return p, errors.New("ParseMPCPhotometry requires 80 characters")
+	}
+	p.Desig = strings.TrimSpace(line[:12])
+	d := line[15:32]
+	var ok bool
+	if p.MJD, ok = ParseObs80Date(d); !ok {
+		return p, fmt.Errorf("ParseMPCPhotometry: Invalid date (%s)", d)
+	}
+	ms := strings.TrimSpace(line[56:62])
+	if p.Mag, err = strconv.ParseFloat(ms, 64); err != nil {
+		return p, fmt.Errorf("ParseMPCPhotometry: Invalid mag (%s)", ms)
+	}
+	p.Band = line[62]
+	p.Uncertainty = math.NaN()
+	if us := strings.TrimSpace(line[63:68]); us != "" {
+		if p.Uncertainty, err = strconv.ParseFloat(us, 64); err != nil {
+			return p,
+				fmt.Errorf("ParseMPCPhotometry: Invalid uncertainty (%s)", us)
+		}
+	}
+	p.ObsCode = line[77:80]
+	return p, nil
+}
@@ -0,0 +1,40 @@
+// Public domain.
+
+package mpcformat_test
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/soniakeys/mpcformat"
+)
+
+const photData = `     NE00030  C2004 09 16.15206 16 13 11.57 +20 52 23.7 21.105V 0.12         291
+
+     NE00030  C2004 09 16.16206 16 13 11.57 +20 52 23.7 20.98 R              291
+`
+
+func TestParseMPCPhotometry(t *testing.T) {
+	recs, err := mpcformat.ParseMPCPhotometry(strings.NewReader(photData))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recs) != 2 {
+		t.Fatalf("got %d records, want 2", len(recs))
+	}
+	p := recs[0]
+	if p.Desig != "NE00030" || math.Abs(p.MJD-53264.15206) > 1e-9 ||
+		p.Mag != 21.105 || p.Band != 'V' || p.ObsCode != "291" ||
+		p.Uncertainty != .12 {
+		t.Fatalf("record 0 = %+v", p)
+	}
+	if p = recs[1]; p.Band != 'R' || !math.IsNaN(p.Uncertainty) {
+		t.Fatalf("record 1 = %+v", p)
+	}
+	bad := photData + photData[:56] + "xx" + photData[58:81]
+	recs, err = mpcformat.ParseMPCPhotometry(strings.NewReader(bad))
+	if err == nil || len(recs) != 2 || !strings.HasPrefix(err.Error(), "line 4:") {
+		t.Fatalf("bad mag: %d records, error %v", len(recs), err)
+	}
+}
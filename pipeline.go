@@ -0,0 +1,135 @@
+// Public domain.
+
+package mpcformat
+
+import (
+	"io"
+
+	"github.com/soniakeys/observation"
+)
+
+// ObsSource is a source of observations.
+//
+// Next returns the next observation, or io.EOF after the last.  Other
+// errors may be line errors, after which Next may be called again, or
+// read errors, which are returned again by further calls.
+type ObsSource interface {
+	Next() (desig string, o observation.VObs, err error)
+}
+
+// ObsFilter selects observations, returning true to keep an observation.
+type ObsFilter func(desig string, o observation.VObs) bool
+
+// ObsSink is a destination for observations.
+//
+// A sink may buffer observations.  If it has a method Flush() error,
+// Flush writes any buffered observations.
+type ObsSink interface {
+	Write(desig string, o observation.VObs) error
+}
+
+type obs80Source struct{ sc *Obs80Scanner }
+
+// NewObs80Source returns an ObsSource of the observations of r in the
+// MPC 80 column format, read as by Obs80Scanner.
+//
+// Observatory codes are looked up with ocm.  Parse errors are returned as
+// line errors.
+func NewObs80Source(r io.Reader, ocm ObscodeResolver) ObsSource {
+	return obs80Source{newObs80Scanner(r, ocm)}
+}
+
+func (s obs80Source) Next() (string, observation.VObs, error) {
+	if !s.sc.Scan() {
+		if err := s.sc.Err(); err != nil {
+			return "", nil, err
+		}
+		return "", nil, io.EOF
+	}
+	if err := s.sc.Err(); err != nil {
+		return "", nil, err
+	}
+	desig, o := s.sc.Observation()
+	return desig, o, nil
+}
+
+type filterSource struct {
+	src ObsSource
+	f   ObsFilter
+}
+
+// FilterSource returns an ObsSource of the observations of src selected
+// by f.  Errors of src are returned unfiltered.
+func FilterSource(src ObsSource, f ObsFilter) ObsSource {
+	return filterSource{src, f}
+}
+
+func (s filterSource) Next() (string, observation.VObs, error) {
+	for {
+		desig, o, err := s.src.Next()
+		if err != nil || s.f(desig, o) {
+			return desig, o, err
+		}
+	}
+}
+
+// ArcGroupSink returns an ObsSink that groups consecutive observations of
+// the same designation into arcs, calling fn with each arc.
+//
+// Fn is called for an arc when an observation of a different designation
+// is written, and for the last arc by Flush.  Each arc is newly allocated.
+// An error from fn is returned by Write or Flush.
+func ArcGroupSink(fn func(*observation.Arc) error) ObsSink {
+	return &arcGroupSink{fn: fn}
+}
+
+type arcGroupSink struct {
+	fn  func(*observation.Arc) error
+	arc *observation.Arc
+}
+
+func (s *arcGroupSink) Write(desig string, o observation.VObs) error {
+	if s.arc != nil && s.arc.Desig != desig {
+		if err := s.Flush(); err != nil {
+			return err
+		}
+	}
+	if s.arc == nil {
+		s.arc = &observation.Arc{Desig: desig}
+	}
+	s.arc.Obs = append(s.arc.Obs, o)
+	return nil
+}
+
+// Flush calls fn with any arc in progress.
+func (s *arcGroupSink) Flush() error {
+	a := s.arc
+	if a == nil {
+		return nil
+	}
+	s.arc = nil
+	return s.fn(a)
+}
+
+// CopyObs writes the observations of src to dst until src returns io.EOF,
+// then flushes dst if it has a Flush method.
+//
+// The first error from src, other than io.EOF, or from dst is returned.
+func CopyObs(dst ObsSink, src ObsSource) error {
+	for {
+		desig, o, err := src.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if err = dst.Write(desig, o); err != nil {
+			return err
+		}
+	}
+	if f, ok := dst.(interface{ Flush() error }); ok {
+		return f.Flush()
+	}
+	return nil
+}
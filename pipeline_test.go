@@ -0,0 +1,65 @@
+// Public domain.
+
+package mpcformat_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/soniakeys/mpcformat"
+	"github.com/soniakeys/observation"
+)
+
+func TestCopyObs(t *testing.T) {
+	if pMapErr != nil {
+		t.Skip(pMapErr)
+	}
+	src := mpcformat.FilterSource(
+		mpcformat.NewObs80Source(bytes.NewBufferString(o1+o3+sat+o2),
+			mpcformat.ParallaxMapResolver(pMap)),
+		func(desig string, o observation.VObs) bool { return desig != o3Desig })
+	var got []arcRes
+	err := mpcformat.CopyObs(mpcformat.ArcGroupSink(
+		func(a *observation.Arc) error {
+			got = append(got, arcRes{a.Desig, len(a.Obs), true})
+			return nil
+		}), src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []arcRes{{o1Desig, 1, true}, {satDesig, 1, true}, {o2Desig, 2, true}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	// line error stops the copy
+	src = mpcformat.NewObs80Source(bytes.NewBufferString(o1+bad+o2),
+		mpcformat.ParallaxMapResolver(pMap))
+	got = nil
+	err = mpcformat.CopyObs(mpcformat.ArcGroupSink(
+		func(a *observation.Arc) error {
+			got = append(got, arcRes{a.Desig, len(a.Obs), true})
+			return nil
+		}), src)
+	if err == nil || len(got) != 0 {
+		t.Fatalf("got %v, %v", got, err)
+	}
+	// but Next may be called again
+	if d, _, err := src.Next(); err != nil || d != o2Desig {
+		t.Fatalf("after line error: %s, %v", d, err)
+	}
+	// sink error
+	errSink := errors.New("sink")
+	src = mpcformat.NewObs80Source(bytes.NewBufferString(o1+o2),
+		mpcformat.ParallaxMapResolver(pMap))
+	err = mpcformat.CopyObs(mpcformat.ArcGroupSink(
+		func(*observation.Arc) error { return errSink }), src)
+	if err != errSink {
+		t.Fatalf("err = %v, want sink error", err)
+	}
+	if _, _, err = src.Next(); err == io.EOF {
+		t.Fatal("source exhausted after first arc error")
+	}
+}
@@ -0,0 +1,170 @@
+// Public domain.
+
+package mpcformat
+
+import (
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/soniakeys/observation"
+)
+
+// RadarObs represents a radar observation.
+//
+// Delay and Doppler are NaN when not measured.  DelayUnc and DopplerUnc are
+// NaN when not given.
+type RadarObs struct {
+	MJD             float64 // time of observation
+	Delay           float64 // round-trip time delay, μs
+	Doppler         float64 // Doppler shift, Hz
+	DelayUnc        float64 // uncertainty of Delay, μs
+	DopplerUnc      float64 // uncertainty of Doppler, Hz
+	TransmitterCode string  // MPC obscode of transmitting station
+	ReceiverCode    string  // MPC obscode of receiving station
+}
+
+// ParseObs80Radar parses a radar observation line in the MPC 80 column
+// format.
+//
+// Note 2, column 14, must be 'R'.  Columns 32-55 hold the round-trip time
+// delay: a time unit code in column 32, 'u' or blank for μs, 'm' for ms, or
+// 's' for s, then a sign character and the value.  Columns 56-67 hold the
+// Doppler shift in Hz, a sign character then the value.  Either may be
+// blank, and is then NaN, but not both.  The transmitter and receiver codes
+// in columns 68-71 and 77-80 must exist in ocm.  Delay is returned in μs.
+// DelayUnc and DopplerUnc are NaN; see ParseRadarObs80 for the line 2
+// giving them.  (Column numbers here are Go-like.)
+func ParseObs80Radar(line80 string, ocm observation.ParallaxMap) (desig string,
+	o *RadarObs, err error) {
+	return parseRadar1(line80, ocm, "ParseObs80Radar:")
+}
+
+// ParseRadarObs80 parses a two-line radar observation in the MPC 80 column
+// format.
+//
+// Line 1 is parsed as by ParseObs80Radar.  Line 2 has note 2 'r' and must
+// match line 1 in designation, date, and receiver code.  It holds the
+// uncertainties of the delay and Doppler shift in the same fields as line 1.
+// DelayUnc is returned in μs.  (Column numbers here are Go-like.)
+func ParseRadarObs80(line1, line2 string, ocm observation.ParallaxMap) (desig string,
+	o *RadarObs, err error) {
+	if desig, o, err = parseRadar1(line1, ocm, "radar obs line 1"); err != nil {
+		return "", nil, err
+	}
+	if err = checkLine2(line2, desig, o.MJD, 'r', "radar"); err != nil {
+		return "", nil, err
+	}
+	if rx := line2[77:80]; rx != o.ReceiverCode {
+		return "", nil, newParseError(ErrInvalidField, rx, 77,
+			"radar obs line 2 receiver code = %s, line 1 was %s",
+			rx, o.ReceiverCode)
+	}
+	var ok bool
+	if o.DelayUnc, ok = parseRadarDelay(line2[32:56]); !ok || o.DelayUnc < 0 {
+		return "", nil, newParseError(ErrInvalidField, line2[32:56], 32,
+			"radar obs line 2 invalid delay uncertainty (%s)", line2[32:56])
+	}
+	if o.DopplerUnc, ok = parseRadarSigned(line2[56:68]); !ok || o.DopplerUnc < 0 {
+		return "", nil, newParseError(ErrInvalidField, line2[56:68], 56,
+			"radar obs line 2 invalid Doppler uncertainty (%s)", line2[56:68])
+	}
+	return desig, o, nil
+}
+
+// parseRadar1 parses a radar observation line as ParseObs80Radar.  Error
+// messages begin with prefix.
+func parseRadar1(line80 string, ocm observation.ParallaxMap,
+	prefix string) (desig string, o *RadarObs, err error) {
+	if len(line80) != 80 {
+		return "", nil, newParseError(ErrShortLine, line80, -1,
+			"%s requires 80 characters", prefix)
+	}
+	if line80[14] != 'R' {
+		return "", nil, newParseError(ErrInvalidField, line80[14:15], 14,
+			"%s note 2 = %c, want R", prefix, line80[14])
+	}
+	d := line80[15:32]
+	mjd, ok := ParseObs80Date(d)
+	if !ok {
+		return "", nil, newParseError(ErrBadDate, d, 15,
+			"%s invalid date (%s)", prefix, d)
+	}
+	o = &RadarObs{
+		MJD:             mjd,
+		DelayUnc:        math.NaN(),
+		DopplerUnc:      math.NaN(),
+		TransmitterCode: line80[68:71],
+		ReceiverCode:    line80[77:80],
+	}
+	if o.Delay, ok = parseRadarDelay(line80[32:56]); !ok {
+		return "", nil, newParseError(ErrInvalidField, line80[32:56], 32,
+			"%s invalid delay (%s)", prefix, line80[32:56])
+	}
+	if o.Doppler, ok = parseRadarSigned(line80[56:68]); !ok {
+		return "", nil, newParseError(ErrInvalidField, line80[56:68], 56,
+			"%s invalid Doppler (%s)", prefix, line80[56:68])
+	}
+	if math.IsNaN(o.Delay) && math.IsNaN(o.Doppler) {
+		return "", nil, newParseError(ErrInvalidField, line80[32:68], 32,
+			"%s no delay or Doppler", prefix)
+	}
+	for _, c := range []struct {
+		code string
+		pos  int
+	}{{o.TransmitterCode, 68}, {o.ReceiverCode, 77}} {
+		if _, ok := ocm[c.code]; !ok {
+			return "", nil, newParseError(ErrUnknownObscode, c.code, c.pos,
+				"%s unknown observatory code (%s)", prefix, c.code)
+		}
+	}
+	return strings.TrimSpace(line80[:12]), o, nil
+}
+
+// radarDelayUnits maps time unit codes of the two-line radar format to
+// multipliers giving μs.
+var radarDelayUnits = map[byte]float64{' ': 1, 'u': 1, 'm': 1e3, 's': 1e6}
+
+// parseRadarDelay parses a unit code followed by a signed value, returning
+// μs, or NaN for a blank field.
+func parseRadarDelay(f string) (float64, bool) {
+	if strings.TrimSpace(f) == "" {
+		return math.NaN(), true
+	}
+	u, ok := radarDelayUnits[f[0]]
+	if !ok {
+		return 0, false
+	}
+	v, ok := parseRadarSigned(f[1:])
+	return v * u, ok && !math.IsNaN(v)
+}
+
+// parseRadarSigned parses a sign character, '+', '-', or blank for +,
+// followed by a value.  A blank field is NaN.
+func parseRadarSigned(f string) (float64, bool) {
+	s := strings.TrimSpace(f[1:])
+	switch {
+	case s == "":
+		return math.NaN(), f[0] == ' '
+	case s[0] == '+' || s[0] == '-':
+		return 0, false
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	switch f[0] {
+	case '-':
+		return -v, err == nil
+	case '+', ' ':
+		return v, err == nil
+	}
+	return 0, false
+}
+
+// parseRadarValue parses a possibly blank field, returning NaN for blank.
+func parseRadarValue(f string) (float64, bool) {
+	f = strings.TrimSpace(f)
+	if f == "" {
+		return math.NaN(), true
+	}
+	v, err := strconv.ParseFloat(f, 64)
+	return v, err == nil
+}
@@ -0,0 +1,114 @@
+// Public domain.
+
+package mpcformat_test
+
+import (
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/soniakeys/mpcformat"
+	"github.com/soniakeys/observation"
+)
+
+// Goldstone, transmitting and receiving
+var radarMap = observation.ParallaxMap{"253": &observation.ParallaxConst{}}
+
+const (
+	tcRadar1 = "     K01Y00A  R2003 09 17.29861 u+           2345981.012-   305.2617253      253"
+	tcRadar2 = "     K01Y00A  r2003 09 17.29861 u+                 0.250+     0.0500         253"
+)
+
+func TestParseObs80Radar(t *testing.T) {
+	desig, o, err := mpcformat.ParseObs80Radar(tcRadar1, radarMap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if desig != "K01Y00A" {
+		t.Fatalf(`ParseObs80Radar desig = %q, want "K01Y00A"`, desig)
+	}
+	if math.Abs(o.MJD-52899.29861) > 1e-6 ||
+		o.Delay != 2345981.012 || o.Doppler != -305.2617 ||
+		!math.IsNaN(o.DelayUnc) || !math.IsNaN(o.DopplerUnc) ||
+		o.TransmitterCode != "253" || o.ReceiverCode != "253" {
+		t.Fatalf("ParseObs80Radar obs = %+v", o)
+	}
+	noDoppler := tcRadar1[:56] + "            " + tcRadar1[68:]
+	if _, o, err = mpcformat.ParseObs80Radar(noDoppler, radarMap); err != nil {
+		t.Fatal(err)
+	}
+	if !math.IsNaN(o.Doppler) {
+		t.Fatalf("blank Doppler = %g, want NaN", o.Doppler)
+	}
+	_, _, err = mpcformat.ParseObs80Radar(tcRadar1, pMap)
+	var pe *mpcformat.ParseError
+	if !errors.As(err, &pe) || pe.Kind != mpcformat.ErrUnknownObscode {
+		t.Fatalf("unknown station error = %#v", err)
+	}
+}
+
+func TestParseRadarObs80(t *testing.T) {
+	desig, o, err := mpcformat.ParseRadarObs80(tcRadar1, tcRadar2, radarMap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if desig != "K01Y00A" || math.Abs(o.MJD-52899.29861) > 1e-6 ||
+		o.Delay != 2345981.012 || o.Doppler != -305.2617 ||
+		o.DelayUnc != .25 || o.DopplerUnc != .05 ||
+		o.TransmitterCode != "253" || o.ReceiverCode != "253" {
+		t.Fatalf("ParseRadarObs80 = %q, %+v", desig, o)
+	}
+	// delay in ms, no Doppler
+	ms := tcRadar1[:32] + "m+           2345.981012            " + tcRadar1[68:]
+	if _, o, err = mpcformat.ParseRadarObs80(ms, tcRadar2, radarMap); err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(o.Delay-2345981.012) > 1e-6 || !math.IsNaN(o.Doppler) {
+		t.Fatalf("ms delay, blank Doppler = %g, %g", o.Delay, o.Doppler)
+	}
+	for _, bad := range []string{
+		tcRadar1[:32] + "x" + tcRadar1[33:],
+		tcRadar1[:33] + "*" + tcRadar1[34:],
+		tcRadar1[:32] + "                                    " + tcRadar1[68:],
+		tcRadar1[:68] + "254" + tcRadar1[71:],
+	} {
+		if _, _, err := mpcformat.ParseRadarObs80(bad, tcRadar2,
+			radarMap); err == nil {
+			t.Errorf("ParseRadarObs80 accepted line 1 %q", bad)
+		}
+	}
+	for _, bad := range []string{
+		tcRadar2[:14] + "s" + tcRadar2[15:],
+		tcRadar2[:5] + "K01Y00B" + tcRadar2[12:],
+		tcRadar2[:31] + "2" + tcRadar2[32:],
+		tcRadar2[:40] + "x" + tcRadar2[41:],
+		tcRadar2[:56] + "-" + tcRadar2[57:],
+		tcRadar2[:77] + "254",
+		tcRadar2[:60],
+	} {
+		if _, _, err := mpcformat.ParseRadarObs80(tcRadar1, bad,
+			radarMap); err == nil {
+			t.Errorf("ParseRadarObs80 accepted line 2 %q", bad)
+		}
+	}
+	// field errors are ParseErrors with the column of the field
+	_, _, err = mpcformat.ParseRadarObs80(tcRadar1,
+		tcRadar2[:40]+"x"+tcRadar2[41:], radarMap)
+	var pe *mpcformat.ParseError
+	if !errors.As(err, &pe) || pe.Kind != mpcformat.ErrInvalidField ||
+		pe.Position != 32 {
+		t.Fatalf("delay uncertainty error = %#v", err)
+	}
+	_, _, err = mpcformat.ParseRadarObs80(tcRadar1[:68]+"254"+tcRadar1[71:],
+		tcRadar2, radarMap)
+	if !errors.As(err, &pe) || pe.Kind != mpcformat.ErrUnknownObscode ||
+		pe.Position != 68 {
+		t.Fatalf("transmitter code error = %#v", err)
+	}
+	// ParseSat2 rejects a radar line 2
+	s := &observation.SatObs{}
+	s.MJD = o.MJD
+	if err = mpcformat.ParseSat2(tcRadar2, desig, s); err == nil {
+		t.Fatal("ParseSat2 accepted radar line 2")
+	}
+}
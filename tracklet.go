@@ -2,7 +2,17 @@
 
 package mpcformat
 
-import "sort"
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"sync"
+
+	"github.com/soniakeys/coord"
+	"github.com/soniakeys/observation"
+)
 
 // TrackletSplitter, implemented on an observation type, provides data needed
 // to split an observation arc into tracklets.
@@ -11,9 +21,28 @@ type TrackletSplitter interface {
 	Observer() string // string identifying the observer or site
 }
 
+// TrackletWeighter is an optional interface of a TrackletSplitter giving
+// a relative confidence in the observation.  Observations not implementing
+// TrackletWeighter have weight 1.
+//
+// Low weight observations separated from a higher weight cluster are split
+// from the cluster more readily than observations of equal weight.
+type TrackletWeighter interface {
+	Weight() float64
+}
+
+// TrackletSatellite is an optional interface of an observation written by
+// TrackletSet.WriteObs80.  Types wrapping an *observation.SatObs implement
+// it to return the satellite observation, so that its second line can be
+// written.
+type TrackletSatellite interface {
+	Satellite() *observation.SatObs
+}
+
 type td struct {
-	mjd   float64
-	index int
+	mjd    float64
+	index  int
+	weight float64
 }
 type dated []td
 
@@ -22,14 +51,63 @@ func (t dated) Less(i, j int) bool { return t[i].mjd < t[j].mjd }
 func (t dated) Swap(i, j int)      { t[i], t[j] = t[j], t[i] }
 
 type tk struct {
-	index []int
-	mean  float64
+	index    []int
+	mean     float64
+	observer string
 }
 type tkList []tk
 
-func (t tkList) Len() int           { return len(t) }
-func (t tkList) Less(i, j int) bool { return t[i].mean < t[j].mean }
-func (t tkList) Swap(i, j int)      { t[i], t[j] = t[j], t[i] }
+func (t tkList) Len() int { return len(t) }
+func (t tkList) Less(i, j int) bool {
+	// break ties by observer so output does not depend on map order
+	if t[i].mean != t[j].mean {
+		return t[i].mean < t[j].mean
+	}
+	return t[i].observer < t[j].observer
+}
+func (t tkList) Swap(i, j int) { t[i], t[j] = t[j], t[i] }
+
+// TrackletSplitterFull is a TrackletSplitter that also provides the
+// designation of the observed object.
+type TrackletSplitterFull interface {
+	TrackletSplitter
+	Designation() string
+}
+
+// TrackletOptions holds the time thresholds, in days, of the tracklet
+// heuristics of FindTrackletsIndexWithOptions.
+type TrackletOptions struct {
+	// Observations all within MaxDuration are a tracklet.
+	MaxDuration float64
+	// 2-5 observations within MaxShortDuration are a tracklet.
+	MaxShortDuration float64
+	// Observations within NightBoundary are considered the same night.
+	NightBoundary float64
+	// Observations all within MaxWideDuration are a tracklet when other
+	// heuristics fail to split them.
+	MaxWideDuration float64
+	// With MinObs > 1, single observation tracklets are discarded.
+	// With MinObs >= 3, two observation tracklets spanning less than half
+	// of NightBoundary are also discarded.
+	MinObs int
+	// MergeTracklets will not produce a tracklet longer than
+	// MaxMergedDuration.
+	MaxMergedDuration float64
+}
+
+// DefaultTrackletOptions returns the options used by FindTrackletsIndex:
+// 1 hour, 3 hours, 12 hours, and 6 hours, with MinObs 1, and
+// MaxMergedDuration 6 hours.
+func DefaultTrackletOptions() TrackletOptions {
+	return TrackletOptions{
+		MaxDuration:       .042,
+		MaxShortDuration:  .125,
+		NightBoundary:     .5,
+		MaxWideDuration:   .25,
+		MinObs:            1,
+		MaxMergedDuration: .25,
+	}
+}
 
 // FindTrackletsIndex splits an observation arc into tracklets.
 //
@@ -39,100 +117,600 @@ func (t tkList) Swap(i, j int)      { t[i], t[j] = t[j], t[i] }
 // conditions.  This information is not preserved in a number of MPC formats
 // so the function here uses heuristics to construct working trackets.
 func FindTrackletsIndex(ts []TrackletSplitter) [][]int {
+	return FindTrackletsIndexWithOptions(ts, DefaultTrackletOptions())
+}
+
+// FindTrackletsIndexWithOptions splits an observation arc into tracklets as
+// FindTrackletsIndex, but with the time thresholds of opts.
+func FindTrackletsIndexWithOptions(ts []TrackletSplitter, opts TrackletOptions) [][]int {
+	m := groupObservers(ts)
+	tl := make(tkList, 0, len(m))
+	for o, t1 := range m {
+		tl = append(tl, reduceTracklets(o, t1, opts, nil)...)
+	}
+	return sortTracklets(tl)
+}
+
+// FindTrackletsIndexDebug splits an observation arc into tracklets as
+// FindTrackletsIndex, writing a line to w explaining each split decision.
+// The observer, MJD of the first observation after the split, gap split
+// at, threshold exceeded, and the number of observations on each side are
+// logged.  A nil w disables logging.
+func FindTrackletsIndexDebug(ts []TrackletSplitter, w io.Writer) [][]int {
+	m := groupObservers(ts)
+	obs := make([]string, 0, len(m))
+	for o := range m {
+		obs = append(obs, o)
+	}
+	// log observers in a consistent order
+	sort.Strings(obs)
+	tl := make(tkList, 0, len(m))
+	opts := DefaultTrackletOptions()
+	for _, o := range obs {
+		tl = append(tl, reduceTracklets(o, m[o], opts, w)...)
+	}
+	return sortTracklets(tl)
+}
+
+// FindTrackletsIndexParallel splits an observation arc into tracklets as
+// FindTrackletsIndex, processing observers concurrently on the given number
+// of worker goroutines.  Results are identical to FindTrackletsIndex.
+func FindTrackletsIndexParallel(ts []TrackletSplitter, workers int) [][]int {
+	if workers < 1 {
+		workers = 1
+	}
+	m := groupObservers(ts)
+	type job struct {
+		obs string
+		set dated
+	}
+	jobs := make(chan job)
+	res := make(chan tkList)
+	opts := DefaultTrackletOptions()
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				res <- reduceTracklets(j.obs, j.set, opts, nil)
+			}
+		}()
+	}
+	go func() {
+		for o, t1 := range m {
+			jobs <- job{o, t1}
+		}
+		close(jobs)
+		wg.Wait()
+		close(res)
+	}()
+	tl := make(tkList, 0, len(m))
+	for r := range res {
+		tl = append(tl, r...)
+	}
+	return sortTracklets(tl)
+}
+
+// TrackletIterator returns a function that yields the tracklets of
+// FindTrackletsIndex one at a time, in the same order.  After the last
+// tracklet, the function returns nil, false.
+func TrackletIterator(ts []TrackletSplitter) func() ([]int, bool) {
+	m := groupObservers(ts)
+	tl := make(tkList, 0, len(m))
+	opts := DefaultTrackletOptions()
+	for o, t1 := range m {
+		tl = append(tl, reduceTracklets(o, t1, opts, nil)...)
+	}
+	sort.Stable(tl)
+	return func() ([]int, bool) {
+		if len(tl) == 0 {
+			return nil, false
+		}
+		x := tl[0].index
+		tl[0].index = nil
+		tl = tl[1:]
+		return x, true
+	}
+}
+
+// FindTrackletsIndexByDesig groups observations by designation and splits
+// each group into tracklets with FindTrackletsIndex.  Indexes of the result
+// are indexes into ts.
+func FindTrackletsIndexByDesig(ts []TrackletSplitterFull) map[string][][]int {
+	group := map[string][]int{}
+	for i, t := range ts {
+		d := t.Designation()
+		group[d] = append(group[d], i)
+	}
+	res := make(map[string][][]int, len(group))
+	for d, x := range group {
+		g := make([]TrackletSplitter, len(x))
+		for i, j := range x {
+			g[i] = ts[j]
+		}
+		tl := FindTrackletsIndex(g)
+		for _, t := range tl {
+			for i, j := range t {
+				t[i] = x[j]
+			}
+		}
+		res[d] = tl
+	}
+	return res
+}
+
+// groupObservers groups observations of ts by observer.
+func groupObservers(ts []TrackletSplitter) map[string]dated {
 	m := map[string]dated{}
 	for i, t := range ts {
 		d := t.MJD()
 		o := t.Observer()
-		m[o] = append(m[o], td{d, i})
+		w := 1.
+		if tw, ok := t.(TrackletWeighter); ok {
+			w = tw.Weight()
+		}
+		m[o] = append(m[o], td{d, i, w})
+	}
+	return m
+}
+
+// sortTracklets orders tracklets by mean date and returns the indexes.
+func sortTracklets(tl tkList) [][]int {
+	sort.Stable(tl)
+	index := make([][]int, len(tl))
+	for i := range tl {
+		index[i] = tl[i].index
+	}
+	return index
+}
+
+// reduceTracklets splits the observations of a single observer into
+// tracklets.  set is sorted in place.  Split decisions are logged to w if
+// w is not nil.
+func reduceTracklets(obs string, set dated, opts TrackletOptions, w io.Writer) tkList {
+	var tl tkList
+	logSplit := func(lf, rt dated, threshold float64) {
+		if w != nil {
+			fmt.Fprintf(w, "split observer=%s at MJD=%.5f gap=%.4gd "+
+				"threshold=%gd left=%d right=%d\n", obs, rt[0].mjd,
+				rt[0].mjd-lf[len(lf)-1].mjd, threshold, len(lf), len(rt))
+		}
 	}
-	tl := make(tkList, 0, len(m))
 	appendTl := func(set dated) {
+		switch {
+		case opts.MinObs > 1 && len(set) == 1:
+			return
+		case opts.MinObs >= 3 && len(set) == 2 &&
+			set[1].mjd-set[0].mjd < opts.NightBoundary/2:
+			return
+		}
 		t := make([]int, len(set))
 		s := 0.
 		for i, o := range set {
 			t[i] = o.index
 			s += o.mjd
 		}
-		tl = append(tl, tk{t, s / float64(len(set))})
+		tl = append(tl, tk{t, s / float64(len(set)), obs})
 		return
 	}
 	var reduce func(set dated) // but not a mathematical set, just a list.
 	reduce = func(set dated) { // set must have > 1 obs.
 		d := set[len(set)-1].mjd - set[0].mjd
 		// all obs with 1 hr (about .042 day) is a tracklet
-		if d < .042 {
+		if d < opts.MaxDuration {
 			appendTl(set)
 			return
 		}
+		// find longest gap
+		split := 1
+		next := set[1].mjd
+		longest := next - set[0].mjd
+		for s := 2; s < len(set); s++ {
+			prev := next
+			next = set[s].mjd
+			if g := next - prev; g > longest {
+				longest = g
+				split = s
+			}
+		}
+		lf := set[:split]
+		rt := set[split:]
+		// a low weight side is split off rather than merged
+		strag := straggler(lf, rt)
 		// 2-5 obs within 3 hrs make a reasonable tracklet
-		if len(set) <= 5 && d < .125 {
+		if len(set) <= 5 && d < opts.MaxShortDuration && !strag {
 			appendTl(set)
 			return
 		}
 		// only 2 obs, handle now
 		if len(set) == 2 {
 			// both must be same night
-			if d < .5 {
+			if d < opts.NightBoundary && !strag {
 				appendTl(set)
 			} else {
+				logSplit(set[:1], set[1:], opts.NightBoundary)
 				appendTl(set[:1])
 				appendTl(set[1:])
 			}
 			return
 		}
-		// split at longest gap
-		split := 1
-		next := set[1].mjd
-		longest := next - set[0].mjd
-		for s := 2; s < len(set); s++ {
-			prev := next
-			next = set[s].mjd
-			if g := next - prev; g > longest {
-				longest = g
-				split = s
-			}
-		}
-		lf := set[:split]
-		rt := set[split:]
 		// recurse immediately if each half has >= 3 positions
 		if len(lf) >= 3 && len(rt) >= 3 {
+			logSplit(lf, rt, opts.MaxDuration)
 			reduce(lf)
 			reduce(rt)
 			return
 		}
 		// if two split off from the same night, handle right away.
-		if len(lf) == 2 && len(rt) >= 2 && lf[1].mjd-lf[0].mjd < .5 {
+		if len(lf) == 2 && len(rt) >= 2 &&
+			lf[1].mjd-lf[0].mjd < opts.NightBoundary {
+			logSplit(lf, rt, opts.MaxDuration)
 			appendTl(lf)
 			reduce(rt)
 			return
 		}
-		if len(rt) == 2 && len(lf) >= 2 && rt[1].mjd-rt[0].mjd < .5 {
+		if len(rt) == 2 && len(lf) >= 2 &&
+			rt[1].mjd-rt[0].mjd < opts.NightBoundary {
+			logSplit(lf, rt, opts.MaxDuration)
 			reduce(lf)
 			appendTl(rt)
 			return
 		}
 		// if whole set has 3 obs in same night, take it as a tracklet.
-		if len(set) == 3 && d < .5 {
+		if len(set) == 3 && d < opts.NightBoundary && !strag {
 			appendTl(set)
 			return
 		}
 		// if whole set within 6 hrs, take it regardless of number of obs.
-		if d < .25 {
+		if d < opts.MaxWideDuration && !strag {
 			appendTl(set)
 			return
 		}
 		// otherwise recurse
+		logSplit(lf, rt, opts.MaxWideDuration)
 		reduce(lf)
 		reduce(rt)
 	}
-	for _, t1 := range m {
-		sort.Sort(t1)
-		reduce(t1)
+	sort.Stable(set)
+	reduce(set)
+	return tl
+}
+
+// straggler returns true if the smaller of lf and rt has a mean weight less
+// than half that of the other.
+func straggler(lf, rt dated) bool {
+	if len(lf) > len(rt) {
+		lf, rt = rt, lf
 	}
-	sort.Sort(tl)
-	index := make([][]int, len(tl))
-	for i := range tl {
-		index[i] = tl[i].index
+	return meanWeight(lf) < .5*meanWeight(rt)
+}
+
+func meanWeight(set dated) float64 {
+	s := 0.
+	for _, o := range set {
+		s += o.weight
 	}
-	return index
+	return s / float64(len(set))
+}
+
+// Tracklet describes a tracklet found by FindTracklets.
+type Tracklet struct {
+	Indices  []int   // indexes into the observation arc
+	Observer string  // common observer, or "mixed"
+	StartMJD float64 // earliest observation
+	EndMJD   float64 // latest observation
+	Duration float64 // EndMJD - StartMJD, in days
+}
+
+// FindTracklets splits an observation arc into tracklets as
+// FindTrackletsIndex, returning the tracklets with some descriptive metadata.
+func FindTracklets(ts []TrackletSplitter) []Tracklet {
+	index := FindTrackletsIndex(ts)
+	tl := make([]Tracklet, len(index))
+	for i, x := range index {
+		t := Tracklet{Indices: x}
+		for j, k := range x {
+			d := ts[k].MJD()
+			o := ts[k].Observer()
+			if j == 0 {
+				t.Observer = o
+				t.StartMJD = d
+				t.EndMJD = d
+				continue
+			}
+			if o != t.Observer {
+				t.Observer = "mixed"
+			}
+			if d < t.StartMJD {
+				t.StartMJD = d
+			}
+			if d > t.EndMJD {
+				t.EndMJD = d
+			}
+		}
+		t.Duration = t.EndMJD - t.StartMJD
+		tl[i] = t
+	}
+	return tl
+}
+
+// ScoreTracklet computes a quality score for the tracklet of ts given by
+// indices.  The score is in the range [0, 1], with 1 for three or more
+// observations covering .5 to 2 hours.  Fewer observations and shorter
+// durations score lower.  Durations over 6 hours, which suggest observations
+// from different nights, are penalized.
+func ScoreTracklet(ts []TrackletSplitter, indices []int) float64 {
+	if len(indices) == 0 {
+		return 0
+	}
+	first, last := dateRange(ts, indices)
+	var n float64 // observation count factor
+	switch len(indices) {
+	case 1:
+		n = .2
+	case 2:
+		n = .6
+	default:
+		n = 1
+	}
+	var d float64 // duration factor
+	switch h := (last - first) * 24; {
+	case h < .5:
+		d = .5 + h
+	case h <= 2:
+		d = 1
+	case h <= 6:
+		d = 1 - (h-2)/8
+	default:
+		d = .25
+	}
+	return n * d
+}
+
+// TrackletCoverage returns the fraction of an observing night of
+// nightLengthHours covered by the tracklet of ts given by indices, clamped to
+// the range [0, 1].
+func TrackletCoverage(ts []TrackletSplitter, indices []int, nightLengthHours float64) float64 {
+	if len(indices) == 0 || !(nightLengthHours > 0) {
+		return 0
+	}
+	first, last := dateRange(ts, indices)
+	return math.Min((last-first)/(nightLengthHours/24), 1)
+}
+
+// ScoredTracklet is a tracklet with a score computed by ScoreTracklet.
+type ScoredTracklet struct {
+	Tracklet
+	Score float64
+}
+
+// FindTrackletsScored splits an observation arc into tracklets as
+// FindTracklets, and returns them with scores from ScoreTracklet, sorted by
+// descending score.  Tracklets of equal score remain in date order.
+func FindTrackletsScored(ts []TrackletSplitter) []ScoredTracklet {
+	tl := FindTracklets(ts)
+	st := make([]ScoredTracklet, len(tl))
+	for i, t := range tl {
+		st[i] = ScoredTracklet{t, ScoreTracklet(ts, t.Indices)}
+	}
+	sort.SliceStable(st, func(i, j int) bool {
+		return st[i].Score > st[j].Score
+	})
+	return st
+}
+
+// MergeTracklets combines two tracklets of ts, returning the combined
+// indexes in date order.  The tracklets must have the same observer and the
+// gap between them must be less than the NightBoundary of
+// DefaultTrackletOptions.
+func MergeTracklets(ts []TrackletSplitter, a, b []int) ([]int, error) {
+	return MergeTrackletsWithOptions(ts, a, b, DefaultTrackletOptions())
+}
+
+// MergeTrackletsWithOptions combines two tracklets as MergeTracklets, with
+// the gap limited by opts.NightBoundary and the duration of the result
+// limited by opts.MaxMergedDuration.
+func MergeTrackletsWithOptions(ts []TrackletSplitter, a, b []int, opts TrackletOptions) ([]int, error) {
+	if len(a) == 0 || len(b) == 0 {
+		return nil, errors.New("MergeTracklets: Empty tracklet")
+	}
+	obs := ts[a[0]].Observer()
+	set := make(dated, 0, len(a)+len(b))
+	for _, x := range [][]int{a, b} {
+		for _, i := range x {
+			if o := ts[i].Observer(); o != obs {
+				return nil, fmt.Errorf(
+					"MergeTracklets: Observers differ (%s, %s)", obs, o)
+			}
+			set = append(set, td{ts[i].MJD(), i, 1})
+		}
+	}
+	// gap between the end of the earlier tracklet and the start of the later
+	aFirst, aLast := dateRange(ts, a)
+	bFirst, bLast := dateRange(ts, b)
+	gap := bFirst - aLast
+	if aFirst > bFirst {
+		gap = aFirst - bLast
+	}
+	if gap >= opts.NightBoundary {
+		return nil, fmt.Errorf("MergeTracklets: Gap too long (%.4f days)", gap)
+	}
+	sort.Stable(set)
+	if d := set[len(set)-1].mjd - set[0].mjd; d > opts.MaxMergedDuration {
+		return nil, fmt.Errorf(
+			"MergeTracklets: Merged duration too long (%.4f days)", d)
+	}
+	m := make([]int, len(set))
+	for i, o := range set {
+		m[i] = o.index
+	}
+	return m, nil
+}
+
+// dateRange returns the earliest and latest dates of a tracklet of ts.
+func dateRange(ts []TrackletSplitter, x []int) (first, last float64) {
+	first = ts[x[0]].MJD()
+	last = first
+	for _, i := range x[1:] {
+		d := ts[i].MJD()
+		if d < first {
+			first = d
+		}
+		if d > last {
+			last = d
+		}
+	}
+	return
+}
+
+// TrackletSet holds tracklets of multiple designations.
+//
+// The zero value is ready to use.  Designations are kept in the order first
+// added until sorted with SortByDesig.
+type TrackletSet struct {
+	desigs []string
+	m      map[string][]Tracklet
+}
+
+// Add adds tracklets for desig.
+func (s *TrackletSet) Add(desig string, tracklets []Tracklet) {
+	if s.m == nil {
+		s.m = map[string][]Tracklet{}
+	}
+	if _, ok := s.m[desig]; !ok {
+		s.desigs = append(s.desigs, desig)
+	}
+	s.m[desig] = append(s.m[desig], tracklets...)
+}
+
+// Get returns the tracklets of desig.
+func (s *TrackletSet) Get(desig string) []Tracklet { return s.m[desig] }
+
+// Designations returns the designations of the set.
+func (s *TrackletSet) Designations() []string {
+	return append([]string{}, s.desigs...)
+}
+
+// TotalCount returns the number of tracklets of all designations.
+func (s *TrackletSet) TotalCount() int {
+	n := 0
+	for _, tl := range s.m {
+		n += len(tl)
+	}
+	return n
+}
+
+// SortByDesig sorts the designations of the set.
+func (s *TrackletSet) SortByDesig() { sort.Strings(s.desigs) }
+
+// WriteObs80 writes the observations of each tracklet to w in the MPC 80
+// column format, grouped by designation and tracklet.
+//
+// Tracklet indexes are indexes into observations.  Observations must also
+// implement observation.VObs and are formatted from o.Meas() as with
+// FormatObs80, with note 2 = 'S' for *observation.SatObs and 'C' otherwise.
+// A satellite observation, an *observation.SatObs or an observation
+// implementing TrackletSatellite, must have a nonzero offset and is
+// followed by its second line as written by WriteObs80Stream.  If ocm is
+// not nil, the observatory code of each other observation, o.Meas().Qual,
+// must be in ocm.
+func (s *TrackletSet) WriteObs80(w io.Writer, observations []TrackletSplitter, ocm observation.ParallaxMap) error {
+	for _, d := range s.desigs {
+		for _, t := range s.m[d] {
+			for _, i := range t.Indices {
+				o, ok := observations[i].(observation.VObs)
+				if !ok {
+					return fmt.Errorf("WriteObs80: Observation type %T "+
+						"does not implement VObs", observations[i])
+				}
+				note2 := byte('C')
+				so, sat := o.(*observation.SatObs)
+				if ts, ok := observations[i].(TrackletSatellite); ok {
+					so = ts.Satellite()
+					sat = so != nil
+				}
+				if ocm != nil && !sat {
+					if c := o.Meas().Qual; ocm[c] == nil {
+						return fmt.Errorf("WriteObs80: Unknown obscode (%s)", c)
+					}
+				}
+				if sat {
+					if so.Offset == (coord.Cart{}) {
+						return fmt.Errorf("WriteObs80: Missing satellite "+
+							"offset (%s %s)", d, so.Sat)
+					}
+					note2 = 'S'
+				}
+				line, err := formatObs80Meas(d, note2, o.Meas())
+				if err != nil {
+					return err
+				}
+				line += "\n"
+				if sat {
+					line += formatSat2(line, so) + "\n"
+				}
+				if _, err := io.WriteString(w, line); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// obsTracklet adapts an observation.VObs to TrackletSplitter.
+type obsTracklet struct {
+	o observation.VObs
+}
+
+func (t obsTracklet) MJD() float64     { return t.o.Meas().MJD }
+func (t obsTracklet) Observer() string { return obsObserver(t.o) }
+
+// SplitTracklets splits an observation stream into tracklets.
+//
+// The stream is split into arcs by designation as with ArcSplitterChan, then
+// each arc is split with FindTrackletsIndex.  Tracklets are sent on the arc
+// channel, each as an Arc with the designation of the object.  Observations
+// are considered to have the same observer when they have the same
+// observatory code, as with ArcObservers.
+//
+// Parse errors are sent on the error channel and processing continues.
+// A fatal error is sent on the error channel and both channels are closed.
+func SplitTracklets(r io.Reader, ocm observation.ParallaxMap) (<-chan *observation.Arc, <-chan error) {
+	tc := make(chan *observation.Arc, 1)
+	ec := make(chan error, 1)
+	go func() {
+		defer close(ec)
+		defer close(tc)
+		f := ArcSplitter(r, ocm)
+		for {
+			a, err := f()
+			switch err.(type) {
+			case nil:
+				ts := make([]TrackletSplitter, len(a.Obs))
+				for i, o := range a.Obs {
+					ts[i] = obsTracklet{o}
+				}
+				for _, x := range FindTrackletsIndex(ts) {
+					t := &observation.Arc{
+						Desig: a.Desig,
+						Obs:   make([]observation.VObs, len(x)),
+					}
+					for i, j := range x {
+						t.Obs[i] = a.Obs[j]
+					}
+					tc <- t
+				}
+			case ArcError:
+				ec <- err
+			default:
+				if err != io.EOF {
+					ec <- err
+				}
+				return
+			}
+		}
+	}()
+	return tc, ec
 }
@@ -3,10 +3,16 @@
 package mpcformat_test
 
 import (
+	"bytes"
+	"fmt"
+	"math"
 	"reflect"
+	"strings"
 	"testing"
 
+	"github.com/soniakeys/coord"
 	"github.com/soniakeys/mpcformat"
+	"github.com/soniakeys/observation"
 )
 
 type testCase struct {
@@ -144,3 +150,485 @@ func TestFindTracklets(t *testing.T) {
 		}
 	}
 }
+
+func TestFindTrackletsIndexWithOptions(t *testing.T) {
+	for _, tc := range testData {
+		got := mpcformat.FindTrackletsIndexWithOptions(tc.arc,
+			mpcformat.DefaultTrackletOptions())
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Fatalf("case %s = %v, want %v", tc.desc, got, tc.want)
+		}
+	}
+	// with a shorter night, "just two obs, same night" splits
+	o := mpcformat.DefaultTrackletOptions()
+	o.NightBoundary = .3
+	arc := []mpcformat.TrackletSplitter{
+		mustMock("2015 01 26.0", ""),
+		mustMock("2015 01 26.4", ""),
+	}
+	got := mpcformat.FindTrackletsIndexWithOptions(arc, o)
+	if want := [][]int{{0}, {1}}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("NightBoundary .3: %v, want %v", got, want)
+	}
+}
+
+func TestFindTrackletsMeta(t *testing.T) {
+	arc := []mpcformat.TrackletSplitter{
+		mustMock("2015 01 26.1", "F51"),
+		mustMock("2015 01 26.0", "F51"),
+		mustMock("2015 01 27.0", "703"),
+	}
+	got := mpcformat.FindTracklets(arc)
+	if len(got) != 2 {
+		t.Fatalf("got %d tracklets, want 2", len(got))
+	}
+	tk := got[0]
+	if !reflect.DeepEqual(tk.Indices, []int{1, 0}) || tk.Observer != "F51" ||
+		tk.StartMJD != arc[1].MJD() || tk.EndMJD != arc[0].MJD() ||
+		tk.Duration != arc[0].MJD()-arc[1].MJD() {
+		t.Fatalf("tracklet 0 = %+v", tk)
+	}
+	tk = got[1]
+	if tk.Observer != "703" || tk.Duration != 0 ||
+		tk.StartMJD != arc[2].MJD() {
+		t.Fatalf("tracklet 1 = %+v", tk)
+	}
+}
+
+func TestFindTrackletsIndexDeterministic(t *testing.T) {
+	// single observations at identical times, several observers
+	arc := []mpcformat.TrackletSplitter{
+		mustMock("2015 01 26.0", "G96"),
+		mustMock("2015 01 26.0", "703"),
+		mustMock("2015 01 26.0", "F51"),
+		mustMock("2015 01 26.0", "E12"),
+		mustMock("2015 01 26.0", "691"),
+	}
+	want := [][]int{{4}, {1}, {3}, {2}, {0}}
+	for i := 0; i < 20; i++ {
+		if got := mpcformat.FindTrackletsIndex(arc); !reflect.DeepEqual(got, want) {
+			t.Fatalf("call %d: %v, want %v", i, got, want)
+		}
+	}
+}
+
+func TestFindTrackletsIndexParallel(t *testing.T) {
+	for _, tc := range testData {
+		got := mpcformat.FindTrackletsIndexParallel(tc.arc, 3)
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Fatalf("case %s = %v, want %v", tc.desc, got, tc.want)
+		}
+	}
+	arc := benchArc(20, 30)
+	want := mpcformat.FindTrackletsIndex(arc)
+	for _, w := range []int{0, 1, 4, 50} {
+		got := mpcformat.FindTrackletsIndexParallel(arc, w)
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("%d workers: result differs from FindTrackletsIndex", w)
+		}
+	}
+}
+
+// benchArc constructs an arc of nObs observations from each of nSite
+// observers, a few observations per night.
+func benchArc(nSite, nObs int) []mpcformat.TrackletSplitter {
+	arc := make([]mpcformat.TrackletSplitter, 0, nSite*nObs)
+	for s := 0; s < nSite; s++ {
+		site := fmt.Sprintf("%03d", s)
+		for i := 0; i < nObs; i++ {
+			mjd := 57000 + float64(i/4)*1.3 + float64(i%4)*.01 +
+				float64(s)*.001
+			arc = append(arc, mock{site, "", mjd})
+		}
+	}
+	return arc
+}
+
+func BenchmarkFindTrackletsIndex(b *testing.B) {
+	arc := benchArc(50, 200)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		mpcformat.FindTrackletsIndex(arc)
+	}
+}
+
+// a 1000 observation arc
+func BenchmarkFindTrackletsIndex1000(b *testing.B) {
+	arc := benchArc(5, 200)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		mpcformat.FindTrackletsIndex(arc)
+	}
+}
+
+func BenchmarkFindTrackletsIndexParallel(b *testing.B) {
+	arc := benchArc(50, 200)
+	for i := 0; i < b.N; i++ {
+		mpcformat.FindTrackletsIndexParallel(arc, 4)
+	}
+}
+
+func TestTrackletOptionsMinObs(t *testing.T) {
+	arc := []mpcformat.TrackletSplitter{
+		mustMock("2015 01 20.0", ""), // isolated
+		mustMock("2015 01 23.0", ""), // pair
+		mustMock("2015 01 23.05", ""),
+		mustMock("2015 01 26.0", ""), // triple
+		mustMock("2015 01 26.05", ""),
+		mustMock("2015 01 26.1", ""),
+	}
+	o := mpcformat.DefaultTrackletOptions()
+	for _, tc := range []struct {
+		minObs int
+		want   [][]int
+	}{
+		{1, [][]int{{0}, {1, 2}, {3, 4, 5}}},
+		{2, [][]int{{1, 2}, {3, 4, 5}}},
+		{3, [][]int{{3, 4, 5}}},
+	} {
+		o.MinObs = tc.minObs
+		got := mpcformat.FindTrackletsIndexWithOptions(arc, o)
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Fatalf("MinObs %d: %v, want %v", tc.minObs, got, tc.want)
+		}
+	}
+}
+
+func TestSplitTracklets(t *testing.T) {
+	// o3 observed again by 704 the next night
+	const o3Next = `     NE00269  C2003 01 07.41893 12 40 20.09 +18 26 46.9          21.4 Vd     704
+     NE00269  C2003 01 07.42850 12 40 20.71 +18 26 46.1          21.8 Vd     704
+`
+	tc, ec := mpcformat.SplitTracklets(
+		bytes.NewBufferString(o3+o3Next+bad+o1), pMap)
+	var got []arcRes
+	nErr := 0
+	for tc != nil || ec != nil {
+		select {
+		case a, ok := <-tc:
+			if !ok {
+				tc = nil
+				continue
+			}
+			got = append(got, arcRes{a.Desig, len(a.Obs), true})
+		case err, ok := <-ec:
+			if !ok {
+				ec = nil
+				continue
+			}
+			if _, ok := err.(mpcformat.ArcError); !ok {
+				t.Fatalf("SplitTracklets error %v type %T, want ArcError",
+					err, err)
+			}
+			nErr++
+		}
+	}
+	want := []arcRes{
+		{o3Desig, 3, true},
+		{o3Desig, 2, true},
+		{o1Desig, 1, true},
+	}
+	if !reflect.DeepEqual(got, want) || nErr != 1 {
+		t.Fatalf("SplitTracklets got %v, %d errors", got, nErr)
+	}
+}
+
+type mockDesig struct {
+	mock
+	desig string
+}
+
+func (m mockDesig) Designation() string { return m.desig }
+
+func TestFindTrackletsIndexByDesig(t *testing.T) {
+	ts := []mpcformat.TrackletSplitterFull{
+		mockDesig{mustMock("2015 01 26.0", "F51"), "A"},
+		mockDesig{mustMock("2015 01 26.0", "F51"), "B"},
+		mockDesig{mustMock("2015 01 26.01", "F51"), "A"},
+		mockDesig{mustMock("2015 01 27.0", "F51"), "B"},
+	}
+	got := mpcformat.FindTrackletsIndexByDesig(ts)
+	want := map[string][][]int{
+		"A": {{0, 2}},
+		"B": {{1}, {3}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
+
+func TestScoreTracklet(t *testing.T) {
+	arc := []mpcformat.TrackletSplitter{
+		mustMock("2015 01 26.0", ""),  // 0
+		mustMock("2015 01 26.02", ""), // 1, about .5 hr
+		mustMock("2015 01 26.04", ""), // 2, about 1 hr
+		mustMock("2015 01 26.3", ""),  // 3, over 6 hrs
+	}
+	for _, tc := range []struct {
+		x    []int
+		want float64
+	}{
+		{nil, 0},
+		{[]int{0}, .1},
+		{[]int{0, 2}, .6},
+		{[]int{0, 1, 2}, 1},
+		{[]int{0, 1, 2, 3}, .25},
+	} {
+		if got := mpcformat.ScoreTracklet(arc, tc.x); math.Abs(got-tc.want) > 1e-12 {
+			t.Errorf("ScoreTracklet %v = %g, want %g", tc.x, got, tc.want)
+		}
+	}
+}
+
+func TestFindTrackletsScored(t *testing.T) {
+	arc := []mpcformat.TrackletSplitter{
+		mustMock("2015 01 25.0", ""),
+		mustMock("2015 01 26.0", ""),
+		mustMock("2015 01 26.02", ""),
+		mustMock("2015 01 26.04", ""),
+	}
+	st := mpcformat.FindTrackletsScored(arc)
+	if len(st) != 2 || !reflect.DeepEqual(st[0].Indices, []int{1, 2, 3}) ||
+		st[0].Score != 1 || st[1].Score >= st[0].Score {
+		t.Fatalf("FindTrackletsScored = %+v", st)
+	}
+}
+
+func TestTrackletIterator(t *testing.T) {
+	for _, tc := range testData {
+		next := mpcformat.TrackletIterator(tc.arc)
+		got := [][]int{}
+		for x, ok := next(); ok; x, ok = next() {
+			got = append(got, x)
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Fatalf("case %s = %v, want %v", tc.desc, got, tc.want)
+		}
+		if x, ok := next(); x != nil || ok {
+			t.Fatalf("case %s: call after end = %v, %t", tc.desc, x, ok)
+		}
+	}
+}
+
+func TestMergeTracklets(t *testing.T) {
+	arc := []mpcformat.TrackletSplitter{
+		mustMock("2015 01 26.0", "F51"),  // 0
+		mustMock("2015 01 26.01", "F51"), // 1
+		mustMock("2015 01 26.15", "F51"), // 2
+		mustMock("2015 01 26.16", "F51"), // 3
+		mustMock("2015 01 26.16", "703"), // 4
+		mustMock("2015 01 26.4", "F51"),  // 5
+		mustMock("2015 01 27.0", "F51"),  // 6
+	}
+	got, err := mpcformat.MergeTracklets(arc, []int{3, 2}, []int{0, 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []int{0, 1, 2, 3}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("MergeTracklets = %v, want %v", got, want)
+	}
+	for _, tc := range []struct {
+		desc string
+		a, b []int
+	}{
+		{"observers differ", []int{0, 1}, []int{4}},
+		{"duration", []int{0, 1}, []int{5}},
+		{"gap", []int{5}, []int{6}},
+		{"empty", nil, []int{6}},
+	} {
+		if _, err := mpcformat.MergeTracklets(arc, tc.a, tc.b); err == nil {
+			t.Errorf("%s: no error", tc.desc)
+		}
+	}
+	// a longer limit allows the merge
+	o := mpcformat.DefaultTrackletOptions()
+	o.MaxMergedDuration = .5
+	if _, err := mpcformat.MergeTrackletsWithOptions(arc,
+		[]int{0, 1}, []int{5}, o); err != nil {
+		t.Fatal(err)
+	}
+}
+
+type mockWeight struct {
+	mock
+	w float64
+}
+
+func (m mockWeight) Weight() float64 { return m.w }
+
+func TestTrackletWeighter(t *testing.T) {
+	// "tracklet < 6hr, including somewhat isolated single obs", but with
+	// a low weight straggler.
+	arc := []mpcformat.TrackletSplitter{
+		mockWeight{mustMock("2015 01 26.0", ""), 1},
+		mockWeight{mustMock("2015 01 26.01", ""), 1},
+		mockWeight{mustMock("2015 01 26.02", ""), 1},
+		mockWeight{mustMock("2015 01 26.2", ""), .2},
+	}
+	want := [][]int{{0, 1, 2}, {3}}
+	if got := mpcformat.FindTrackletsIndex(arc); !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	// equal weights do not change the result
+	for i := range arc {
+		arc[i] = mockWeight{arc[i].(mockWeight).mock, 3}
+	}
+	want = [][]int{{0, 1, 2, 3}}
+	if got := mpcformat.FindTrackletsIndex(arc); !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
+
+func TestTrackletCoverage(t *testing.T) {
+	arc := []mpcformat.TrackletSplitter{
+		mustMock("2015 01 26.0", ""),
+		mustMock("2015 01 26.1", ""),
+		mustMock("2015 01 26.5", ""),
+	}
+	for _, tc := range []struct {
+		x     []int
+		hours float64
+		want  float64
+	}{
+		{nil, 10, 0},
+		{[]int{0}, 10, 0},
+		{[]int{1, 0}, 4.8, .5},
+		{[]int{0, 1, 2}, 10, 1},
+		{[]int{0, 1}, 0, 0},
+	} {
+		got := mpcformat.TrackletCoverage(arc, tc.x, tc.hours)
+		if math.Abs(got-tc.want) > 1e-9 {
+			t.Errorf("TrackletCoverage %v %g = %g, want %g",
+				tc.x, tc.hours, got, tc.want)
+		}
+	}
+}
+
+// siteTracklet adapts a parsed site observation to TrackletSplitter.
+type siteTracklet struct {
+	*observation.SiteObs
+}
+
+func (o siteTracklet) MJD() float64     { return o.SiteObs.MJD }
+func (o siteTracklet) Observer() string { return o.Qual }
+
+// satTracklet adapts a parsed satellite observation to TrackletSplitter.
+type satTracklet struct {
+	*observation.SatObs
+}
+
+func (o satTracklet) MJD() float64                   { return o.SatObs.MJD }
+func (o satTracklet) Observer() string               { return o.Sat }
+func (o satTracklet) Satellite() *observation.SatObs { return o.SatObs }
+
+func TestTrackletSet(t *testing.T) {
+	var obs []mpcformat.TrackletSplitter
+	for _, line := range strings.Split(o3+o1, "\n") {
+		if line == "" {
+			continue
+		}
+		_, o, err := mpcformat.ParseObs80(line, mpcformat.ParallaxMapResolver(pMap))
+		if err != nil {
+			t.Fatal(err)
+		}
+		obs = append(obs, siteTracklet{o.(*observation.SiteObs)})
+	}
+	var s mpcformat.TrackletSet
+	s.Add(o3Desig, mpcformat.FindTracklets(obs[:3]))
+	s.Add(o1Desig, []mpcformat.Tracklet{{Indices: []int{3}}})
+	s.Add(o1Desig, []mpcformat.Tracklet{{Indices: []int{3}}})
+	if n := s.TotalCount(); n != 3 {
+		t.Fatalf("TotalCount = %d, want 3", n)
+	}
+	if n := len(s.Get(o1Desig)); n != 2 {
+		t.Fatalf("Get(%s) has %d tracklets, want 2", o1Desig, n)
+	}
+	if d := s.Designations(); !reflect.DeepEqual(d,
+		[]string{o3Desig, o1Desig}) {
+		t.Fatalf("Designations = %v", d)
+	}
+	s.SortByDesig()
+	if d := s.Designations(); !reflect.DeepEqual(d,
+		[]string{o1Desig, o3Desig}) {
+		t.Fatalf("sorted Designations = %v", d)
+	}
+	var b bytes.Buffer
+	if err := s.WriteObs80(&b, obs, pMap); err != nil {
+		t.Fatal(err)
+	}
+	var want string
+	for _, i := range []int{3, 3, 0, 1, 2} {
+		d := o3Desig
+		if i == 3 {
+			d = o1Desig
+		}
+		line, err := mpcformat.FormatObs80(d, obs[i].(siteTracklet).SiteObs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want += line + "\n"
+	}
+	if b.String() != want {
+		t.Fatalf("WriteObs80 got\n%s\nwant\n%s", b.String(), want)
+	}
+	if err := s.WriteObs80(&b, obs, observation.ParallaxMap{}); err == nil {
+		t.Fatal("WriteObs80 with unknown obscode: no error")
+	}
+	// satellite observations keep line 2
+	sc := mpcformat.NewObs80Scanner(strings.NewReader(sat), pMap)
+	if !sc.Scan() {
+		t.Fatal(sc.Err())
+	}
+	_, o := sc.Observation()
+	so := o.(*observation.SatObs)
+	sats := []mpcformat.TrackletSplitter{satTracklet{so}}
+	var ss mpcformat.TrackletSet
+	ss.Add("03620", mpcformat.FindTracklets(sats))
+	b.Reset()
+	if err := ss.WriteObs80(&b, sats, pMap); err != nil {
+		t.Fatal(err)
+	}
+	var sb bytes.Buffer
+	err := mpcformat.WriteObs80Stream(&sb, []*observation.Arc{
+		{Desig: "03620", Obs: []observation.VObs{so}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.String() != sb.String() {
+		t.Fatalf("WriteObs80 got\n%s\nwant\n%s", b.String(), sb.String())
+	}
+	so.Offset = coord.Cart{}
+	if err := ss.WriteObs80(&b, sats, pMap); err == nil {
+		t.Fatal("WriteObs80 with zero satellite offset: no error")
+	}
+	mocks := []mpcformat.TrackletSplitter{mustMock("2015 01 26.0", "")}
+	var ms mpcformat.TrackletSet
+	ms.Add("x", mpcformat.FindTracklets(mocks))
+	if err := ms.WriteObs80(&b, mocks, nil); err == nil {
+		t.Fatal("WriteObs80 with non-VObs: no error")
+	}
+}
+
+func TestFindTrackletsIndexDebug(t *testing.T) {
+	for _, tc := range testData {
+		got := mpcformat.FindTrackletsIndexDebug(tc.arc, nil)
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Fatalf("case %s = %v, want %v", tc.desc, got, tc.want)
+		}
+	}
+	arc := []mpcformat.TrackletSplitter{
+		mustMock("2015 01 26.0", "F51"),
+		mustMock("2015 01 26.01", "F51"),
+		mustMock("2015 01 26.02", "F51"),
+		mustMock("2015 01 27.0", "F51"),
+		mustMock("2015 01 27.01", "F51"),
+		mustMock("2015 01 27.02", "F51"),
+	}
+	var b bytes.Buffer
+	mpcformat.FindTrackletsIndexDebug(arc, &b)
+	want := "split observer=F51 at MJD=57049.00000 gap=0.98d " +
+		"threshold=0.042d left=3 right=3\n"
+	if b.String() != want {
+		t.Fatalf("got %q, want %q", b.String(), want)
+	}
+}